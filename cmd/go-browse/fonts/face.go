@@ -0,0 +1,67 @@
+package fonts
+
+import (
+	"unicode/utf8"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// Face is a typeface set at a particular size, measured in pixels
+type Face struct {
+	Family string
+	Size   float64
+	face   font.Face
+}
+
+func newFace(face font.Face, family string, size float64) *Face {
+	return &Face{
+		Family: family,
+		Size:   size,
+		face:   face,
+	}
+}
+
+// FontFace returns the underlying face, for drawing text with
+func (f *Face) FontFace() font.Face {
+	return f.face
+}
+
+// Advance returns how far the pen moves when drawing a piece of text, including kerning
+// between its characters
+func (f *Face) Advance(text string) float64 {
+	return toFloat(font.MeasureString(f.face, text))
+}
+
+// GlyphAdvance returns the advance of a single character
+func (f *Face) GlyphAdvance(r rune) float64 {
+	advance, ok := f.face.GlyphAdvance(r)
+	if !ok {
+		advance, _ = f.face.GlyphAdvance(utf8.RuneError)
+	}
+	return toFloat(advance)
+}
+
+// Kern returns the adjustment to the advance between two adjacent characters
+func (f *Face) Kern(r0, r1 rune) float64 {
+	return toFloat(f.face.Kern(r0, r1))
+}
+
+// Ascent returns how far the face reaches above the baseline
+func (f *Face) Ascent() float64 {
+	return toFloat(f.face.Metrics().Ascent)
+}
+
+// Descent returns how far the face reaches below the baseline
+func (f *Face) Descent() float64 {
+	return toFloat(f.face.Metrics().Descent)
+}
+
+// XHeight returns the height of lower-case letters like x
+func (f *Face) XHeight() float64 {
+	return toFloat(f.face.Metrics().XHeight)
+}
+
+func toFloat(x fixed.Int26_6) float64 {
+	return float64(x) / 64
+}
@@ -0,0 +1,289 @@
+package fonts
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/gomonobolditalic"
+	"golang.org/x/image/font/gofont/gomonoitalic"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+)
+
+// Style is an enum of the values of the font-style property we can select faces by
+type Style int
+
+const (
+	// Normal corresponds to font-style: normal
+	Normal Style = iota
+	// Italic corresponds to font-style: italic and oblique
+	Italic
+)
+
+// Description is what a font is asked for by: the properties of the font a box is set in
+type Description struct {
+	Families []string // font-family, in order of preference
+	Size     float64  // font-size in pixels
+	Weight   int      // font-weight, from 1 to 1000
+	Style    Style
+}
+
+// typeface is a single font file, with the family, weight and style it declares
+type typeface struct {
+	font   *sfnt.Font
+	family string
+	weight int
+	style  Style
+}
+
+// faceKey identifies a typeface set at a size
+type faceKey struct {
+	typeface *typeface
+	size     float64
+}
+
+// Collection is a set of typefaces that descriptions are resolved against
+type Collection struct {
+	families map[string][]*typeface // keyed by lower-cased family name
+	generic  map[string]string      // maps generic families like serif onto a loaded family
+	fallback string                 // the family used when nothing else matches
+	faces    map[faceKey]*Face
+}
+
+// NewCollection creates a Collection holding the bundled Go fonts, which stand in for
+// every generic family until fonts are loaded that say otherwise
+func NewCollection() *Collection {
+	c := &Collection{
+		families: make(map[string][]*typeface),
+		generic: map[string]string{
+			"serif":      "go",
+			"sans-serif": "go",
+			"system-ui":  "go",
+			"cursive":    "go",
+			"fantasy":    "go",
+			"monospace":  "go mono",
+		},
+		fallback: "go",
+		faces:    make(map[faceKey]*Face),
+	}
+
+	for _, ttf := range [][]byte{
+		goregular.TTF, gobold.TTF, goitalic.TTF, gobolditalic.TTF,
+		gomono.TTF, gomonobold.TTF, gomonoitalic.TTF, gomonobolditalic.TTF,
+	} {
+		if err := c.Add(ttf); err != nil {
+			panic(err) // the bundled fonts are known to be valid
+		}
+	}
+
+	return c
+}
+
+// Default is the collection text is laid out and painted with
+var Default = NewCollection()
+
+// Add parses a TrueType or OpenType font file, or a collection of them, and adds its faces
+func (c *Collection) Add(src []byte) error {
+	collection, err := opentype.ParseCollection(src)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < collection.NumFonts(); i++ {
+		f, err := collection.Font(i)
+		if err != nil {
+			return err
+		}
+
+		t, err := newTypeface(f)
+		if err != nil {
+			return err
+		}
+
+		key := strings.ToLower(t.family)
+		c.families[key] = append(c.families[key], t)
+	}
+
+	return nil
+}
+
+// LoadDirectory adds every .ttf, .otf, .ttc and .otc file in a directory and its
+// subdirectories. Files that fail to parse are skipped and reported together.
+func (c *Collection) LoadDirectory(dir string) error {
+	failed := make([]string, 0)
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".ttf", ".otf", ".ttc", ".otc":
+		default:
+			return nil
+		}
+
+		src, err := ioutil.ReadFile(path)
+		if err == nil {
+			err = c.Add(src)
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", path, err))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to load fonts: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// SetGeneric maps a generic family like serif or monospace onto a loaded family
+func (c *Collection) SetGeneric(generic, family string) {
+	c.generic[strings.ToLower(generic)] = strings.ToLower(family)
+}
+
+// Resolve returns the face that best matches a description. The first family with any
+// faces wins, then the face closest in style and weight is picked from it, following the
+// CSS font matching algorithm.
+func (c *Collection) Resolve(description Description) *Face {
+	candidates := c.families[c.fallback]
+	for _, family := range description.Families {
+		key := strings.ToLower(family)
+		if generic, ok := c.generic[key]; ok {
+			key = generic
+		}
+		if typefaces, ok := c.families[key]; ok {
+			candidates = typefaces
+			break
+		}
+	}
+
+	best := candidates[0]
+	for _, candidate := range candidates[1:] {
+		if betterMatch(candidate, best, description) {
+			best = candidate
+		}
+	}
+
+	return c.face(best, description.Size)
+}
+
+// betterMatch returns true if a typeface matches a description more closely than another
+func betterMatch(t, other *typeface, description Description) bool {
+	if (t.style == description.Style) != (other.style == description.Style) {
+		return t.style == description.Style
+	}
+
+	distance := weightDistance(t.weight, description.Weight)
+	otherDistance := weightDistance(other.weight, description.Weight)
+	return distance < otherDistance
+}
+
+// weightDistance measures how far a typeface's weight is from the desired weight. Lighter
+// weights are preferred for light and regular text and heavier ones for bold text, so a
+// match on the wrong side counts as further away.
+func weightDistance(weight, desired int) float64 {
+	distance := math.Abs(float64(weight - desired))
+	if (desired <= 450 && weight > desired) || (desired > 450 && weight < desired) {
+		distance += 1000
+	}
+	return distance
+}
+
+// face returns the Face for a typeface at a size, creating it the first time it's needed
+func (c *Collection) face(t *typeface, size float64) *Face {
+	if size <= 0 {
+		size = 16
+	}
+
+	key := faceKey{typeface: t, size: size}
+	if face, ok := c.faces[key]; ok {
+		return face
+	}
+
+	// at 72 DPI a point is a pixel, so the size can be used as is
+	opened, err := opentype.NewFace(t.font, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingNone,
+	})
+	if err != nil {
+		panic(err) // only happens for invalid options
+	}
+
+	face := newFace(opened, t.family, size)
+	c.faces[key] = face
+	return face
+}
+
+// newTypeface reads the family, weight and style a font declares in its name table
+func newTypeface(f *sfnt.Font) (*typeface, error) {
+	var buf sfnt.Buffer
+
+	family, err := f.Name(&buf, sfnt.NameIDTypographicFamily)
+	if err != nil || family == "" {
+		family, err = f.Name(&buf, sfnt.NameIDFamily)
+		if err != nil {
+			return nil, fmt.Errorf("font has no family name: %s", err)
+		}
+	}
+
+	subfamily, err := f.Name(&buf, sfnt.NameIDTypographicSubfamily)
+	if err != nil || subfamily == "" {
+		subfamily, _ = f.Name(&buf, sfnt.NameIDSubfamily)
+	}
+
+	weight, style := parseSubfamily(subfamily)
+	return &typeface{
+		font:   f,
+		family: family,
+		weight: weight,
+		style:  style,
+	}, nil
+}
+
+// subfamilyWeights maps the words used in subfamily names to font weights, with compound
+// words first so that "semibold" isn't read as "bold"
+var subfamilyWeights = []struct {
+	word   string
+	weight int
+}{
+	{"extralight", 200}, {"ultralight", 200}, {"extrabold", 800}, {"ultrabold", 800},
+	{"semibold", 600}, {"demibold", 600}, {"hairline", 100}, {"regular", 400},
+	{"medium", 500}, {"light", 300}, {"black", 900}, {"heavy", 900}, {"thin", 100},
+	{"bold", 700}, {"book", 400},
+}
+
+// parseSubfamily guesses the weight and style of a font from a subfamily name like
+// "Bold Italic" or "SemiBold"
+func parseSubfamily(subfamily string) (int, Style) {
+	name := strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(subfamily))
+
+	style := Normal
+	if strings.Contains(name, "italic") || strings.Contains(name, "oblique") {
+		style = Italic
+	}
+
+	for _, w := range subfamilyWeights {
+		if strings.Contains(name, w.word) {
+			return w.weight, style
+		}
+	}
+	return 400, style
+}
@@ -2,9 +2,10 @@ package main
 
 import (
 	"fmt"
-	"io/ioutil"
 	"log"
+	"os"
 
+	"github.com/bern/go-browse/cmd/go-browse/fonts"
 	"github.com/bern/go-browse/cmd/go-browse/models"
 	"github.com/bern/go-browse/cmd/go-browse/utils"
 )
@@ -13,14 +14,20 @@ func main() {
 	// tests.DrawSomething()
 	// createBasicTree()
 	// createBasicParser()
-	parseHTMLFile("test_files/index2.html")
+	htmlPath := "test_files/index2.html"
+	if len(os.Args) > 1 {
+		htmlPath = os.Args[1]
+	}
+	loadFonts("fonts")
+
+	parseHTMLFile(htmlPath)
 	fmt.Println()
-	parseCSSFile("test_files/styles2.css")
+	printStylesheet(htmlPath)
 	fmt.Println()
-	generateStyleTree("test_files/index2.html", "test_files/styles2.css")
+	generateStyleTree(htmlPath)
 	fmt.Println()
-	generateLayoutTree("test_files/index2.html", "test_files/styles2.css")
-	//fmt.Println()
+	generateLayoutTree(htmlPath)
+	paintLayoutTree(htmlPath, "out.png")
 }
 
 func createBasicTree() {
@@ -61,65 +68,81 @@ func createBasicParser() {
 }
 
 func parseHTMLFile(path string) {
-	dat, err := ioutil.ReadFile(path)
-	if err != nil {
-		log.Fatal("failed to open ", path)
+	document := loadDocument(path)
+	utils.PrintNode(document.Root, 0)
+	for _, warning := range document.Warnings {
+		fmt.Println("Warning:", warning)
 	}
-	parentNode := utils.ParseHTML(path, string(dat))
-	utils.PrintNode(parentNode, 0)
 }
 
-func parseCSSFile(path string) {
-	dat, err := ioutil.ReadFile(path)
-	if err != nil {
-		log.Fatal("failed to open ", path)
+func loadFonts(dir string) {
+	if _, err := os.Stat(dir); err != nil {
+		return
+	}
+	if err := fonts.Default.LoadDirectory(dir); err != nil {
+		fmt.Println("Warning:", err)
 	}
-	stylesheet := utils.ParseCSS(path, string(dat))
-	utils.PrintStylesheet(stylesheet)
 }
 
-func generateStyleTree(htmlPath, cssPath string) {
-	dat, err := ioutil.ReadFile(htmlPath)
+func loadDocument(path string) utils.Document {
+	document, err := utils.LoadDocument(path)
 	if err != nil {
-		log.Fatal("failed to open ", htmlPath)
+		log.Fatal("failed to open ", path)
 	}
-	parentNode := utils.ParseHTML(htmlPath, string(dat))
+	return document
+}
 
-	dat, err = ioutil.ReadFile(cssPath)
-	if err != nil {
-		log.Fatal("failed to open ", cssPath)
-	}
-	stylesheet := utils.ParseCSS(cssPath, string(dat))
+func printStylesheet(htmlPath string) {
+	document := loadDocument(htmlPath)
+	utils.PrintStylesheet(document.Stylesheet)
+}
 
-	styleTree := utils.StyleTree(parentNode, stylesheet)
+func generateStyleTree(htmlPath string) {
+	document := loadDocument(htmlPath)
+
+	styleTree := utils.StyleTree(document.Root, document.Stylesheet)
 	utils.PrintStyledNode(styleTree, 0)
 }
 
-func generateLayoutTree(htmlPath, cssPath string) {
-	dat, err := ioutil.ReadFile(htmlPath)
-	if err != nil {
-		log.Fatal("failed to open ", htmlPath)
-	}
-	parentNode := utils.ParseHTML(htmlPath, string(dat))
+func generateLayoutTree(htmlPath string) {
+	document := loadDocument(htmlPath)
 
-	dat, err = ioutil.ReadFile(cssPath)
+	styleTree := utils.StyleTree(document.Root, document.Stylesheet)
+
+	layoutTree, err := utils.BuildLayoutTree(styleTree)
 	if err != nil {
-		log.Fatal("failed to open ", cssPath)
+		log.Fatal(err)
 	}
-	stylesheet := utils.ParseCSS(cssPath, string(dat))
+	layoutTreePtr := &layoutTree
+	layoutTreePtr.Layout(models.Dimensions{
+		Content: models.Rectangle{
+			Width:  models.FromPixels(1024),
+			Height: models.FromPixels(768),
+		},
+	})
 
-	styleTree := utils.StyleTree(parentNode, stylesheet)
+	utils.PrintLayoutBox(*layoutTreePtr, 0)
+}
 
-	layoutTree := utils.BuildLayoutTree(styleTree)
+func paintLayoutTree(htmlPath, outPath string) {
+	document := loadDocument(htmlPath)
+
+	styleTree := utils.StyleTree(document.Root, document.Stylesheet)
+
+	layoutTree, err := utils.BuildLayoutTree(styleTree)
+	if err != nil {
+		log.Fatal(err)
+	}
 	layoutTreePtr := &layoutTree
 	layoutTreePtr.Layout(models.Dimensions{
 		Content: models.Rectangle{
-			X:      0,
-			Y:      0,
-			Width:  1024,
-			Height: 768,
+			Width:  models.FromPixels(1024),
+			Height: models.FromPixels(768),
 		},
 	})
 
-	utils.PrintLayoutBox(*layoutTreePtr, 0)
+	err = utils.PaintPNG(*layoutTreePtr, 1024, 768, outPath)
+	if err != nil {
+		log.Fatal("failed to paint ", outPath, ": ", err)
+	}
 }
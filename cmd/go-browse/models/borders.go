@@ -0,0 +1,49 @@
+package models
+
+// borderWidthKeywords maps the border width keywords onto pixels
+var borderWidthKeywords = map[string]float64{
+	"thin":   1,
+	"medium": 3,
+	"thick":  5,
+}
+
+// BorderSides are the sides of a border, in the order the border properties list them
+var BorderSides = []string{"top", "right", "bottom", "left"}
+
+// computeBorderWidths resolves the width of each side of a border to pixels. A side whose
+// style is none or hidden has no width at all, whatever border-width says.
+func computeBorderWidths(values PropertyMap) {
+	for _, side := range BorderSides {
+		width := "border-" + side + "-width"
+
+		if !HasBorder(BorderStyle(StyledNode{SpecifiedValues: values}, side)) {
+			if _, ok := values[width]; ok {
+				values[width] = NewLength(0, Px)
+			}
+			continue
+		}
+
+		value, ok := values[width]
+		if !ok {
+			value, _ = InitialValue(width)
+		}
+		if px, ok := borderWidthKeywords[value.Keyword]; ok && value.ValueType == KeywordValue {
+			value = NewLength(px, Px)
+		}
+		values[width] = value
+	}
+}
+
+// BorderStyle returns the border-style keyword of one side of a node's border
+func BorderStyle(node StyledNode, side string) string {
+	style := node.Lookup([]string{"border-" + side + "-style"}, NewKeyword("none"))
+	if style.ValueType != KeywordValue {
+		return "none"
+	}
+	return style.Keyword
+}
+
+// HasBorder returns true if a border style is drawn and takes up space
+func HasBorder(style string) bool {
+	return style != "none" && style != "hidden"
+}
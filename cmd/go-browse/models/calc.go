@@ -0,0 +1,190 @@
+package models
+
+import "strings"
+
+// CalcOperator informs us of what a node in a math expression does with its arguments
+type CalcOperator int
+
+const (
+	// CalcLeaf is a number, length or percentage held in Value
+	CalcLeaf CalcOperator = iota
+	// CalcSum adds its arguments together
+	CalcSum
+	// CalcNegate negates its only argument, for subtraction
+	CalcNegate
+	// CalcProduct multiplies its arguments together
+	CalcProduct
+	// CalcInvert takes the reciprocal of its only argument, for division
+	CalcInvert
+	// CalcMin is the smallest of its arguments
+	CalcMin
+	// CalcMax is the largest of its arguments
+	CalcMax
+	// CalcClamp is its second argument, kept between its first and third
+	CalcClamp
+)
+
+// CalcNode is a node in the expression tree of calc(), min(), max() or clamp()
+type CalcNode struct {
+	Operator CalcOperator
+	Value    Value // CalcLeaf
+	Args     []CalcNode
+}
+
+// IsNumber returns true if an expression evaluates to a plain number rather than a length
+func (c CalcNode) IsNumber() bool {
+	switch c.Operator {
+	case CalcLeaf:
+		return c.Value.ValueType == NumberValue
+	case CalcProduct:
+		for _, arg := range c.Args {
+			if !arg.IsNumber() {
+				return false
+			}
+		}
+		return true
+	}
+	return c.Args[0].IsNumber()
+}
+
+// Evaluate computes the value of an expression, resolving its leaves to pixels or plain
+// numbers with resolve. It fails if any leaf can't be resolved.
+func (c CalcNode) Evaluate(resolve func(Value) (float64, bool)) (float64, bool) {
+	if c.Operator == CalcLeaf {
+		return resolve(c.Value)
+	}
+
+	args := make([]float64, 0, len(c.Args))
+	for _, arg := range c.Args {
+		value, ok := arg.Evaluate(resolve)
+		if !ok {
+			return 0, false
+		}
+		args = append(args, value)
+	}
+
+	result := args[0]
+	switch c.Operator {
+	case CalcSum:
+		for _, arg := range args[1:] {
+			result += arg
+		}
+	case CalcNegate:
+		result = -result
+	case CalcProduct:
+		for _, arg := range args[1:] {
+			result *= arg
+		}
+	case CalcInvert:
+		if result == 0 {
+			return 0, false
+		}
+		result = 1 / result
+	case CalcMin:
+		for _, arg := range args[1:] {
+			if arg < result {
+				result = arg
+			}
+		}
+	case CalcMax:
+		for _, arg := range args[1:] {
+			if arg > result {
+				result = arg
+			}
+		}
+	case CalcClamp:
+		// the minimum wins over the maximum if they cross
+		result = args[1]
+		if args[2] < result {
+			result = args[2]
+		}
+		if args[0] > result {
+			result = args[0]
+		}
+	}
+	return result, true
+}
+
+// Simplify replaces the leaves that resolve can handle with pixel lengths or numbers, and
+// returns a single leaf if the whole expression could be computed
+func (c CalcNode) Simplify(resolve func(Value) (float64, bool)) CalcNode {
+	if value, ok := c.Evaluate(resolve); ok {
+		if c.IsNumber() {
+			return CalcNode{Operator: CalcLeaf, Value: NewNumber(value)}
+		}
+		return CalcNode{Operator: CalcLeaf, Value: NewLength(value, Px)}
+	}
+
+	if c.Operator == CalcLeaf {
+		return c
+	}
+
+	simplified := CalcNode{Operator: c.Operator, Args: make([]CalcNode, 0, len(c.Args))}
+	for _, arg := range c.Args {
+		simplified.Args = append(simplified.Args, arg.Simplify(resolve))
+	}
+	return simplified
+}
+
+// String serializes an expression back into CSS, without the calc() around it
+func (c CalcNode) String() string {
+	switch c.Operator {
+	case CalcLeaf:
+		return c.Value.String()
+	case CalcSum:
+		var sb strings.Builder
+		for i, arg := range c.Args {
+			if i > 0 {
+				if arg.Operator == CalcNegate {
+					sb.WriteString(" - ")
+					sb.WriteString(arg.Args[0].nested())
+					continue
+				}
+				if arg.Operator == CalcLeaf && arg.Value.Number < 0 {
+					negated := arg.Value
+					negated.Number = -negated.Number
+					sb.WriteString(" - ")
+					sb.WriteString(negated.String())
+					continue
+				}
+				sb.WriteString(" + ")
+			}
+			sb.WriteString(arg.nested())
+		}
+		return sb.String()
+	case CalcNegate:
+		return "-1 * " + c.Args[0].nested()
+	case CalcProduct:
+		var sb strings.Builder
+		for i, arg := range c.Args {
+			if i > 0 {
+				if arg.Operator == CalcInvert {
+					sb.WriteString(" / ")
+					sb.WriteString(arg.Args[0].nested())
+					continue
+				}
+				sb.WriteString(" * ")
+			}
+			sb.WriteString(arg.nested())
+		}
+		return sb.String()
+	case CalcInvert:
+		return "1 / " + c.Args[0].nested()
+	}
+
+	names := map[CalcOperator]string{CalcMin: "min", CalcMax: "max", CalcClamp: "clamp"}
+	args := make([]string, 0, len(c.Args))
+	for _, arg := range c.Args {
+		args = append(args, arg.String())
+	}
+	return names[c.Operator] + "(" + strings.Join(args, ", ") + ")"
+}
+
+// nested serializes an argument, adding parentheses if it is itself a sum or product
+func (c CalcNode) nested() string {
+	switch c.Operator {
+	case CalcSum, CalcNegate, CalcProduct, CalcInvert:
+		return "(" + c.String() + ")"
+	}
+	return c.String()
+}
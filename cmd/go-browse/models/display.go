@@ -0,0 +1,35 @@
+package models
+
+import "github.com/bern/go-browse/cmd/go-browse/fonts"
+
+// DisplayCommandType informs us of what kind of drawing a DisplayCommand performs
+type DisplayCommandType int
+
+const (
+	// SolidColor fills a rectangle with a single color
+	SolidColor DisplayCommandType = iota
+	// DrawText draws a run of text with its left end on a baseline
+	DrawText
+	// FillPolygon fills the convex polygon outlined by a list of points
+	FillPolygon
+)
+
+// Point is a position on the canvas
+type Point struct {
+	X LayoutUnit
+	Y LayoutUnit
+}
+
+// DisplayCommand represents a single drawing operation produced by the painter
+type DisplayCommand struct {
+	CommandType DisplayCommandType
+	Color       Color
+	Rect        Rectangle
+	Text        string      // DrawText
+	Face        *fonts.Face // DrawText
+	Baseline    LayoutUnit  // DrawText
+	Points      []Point     // FillPolygon
+}
+
+// DisplayList is an ordered list of drawing operations, painted back to front
+type DisplayList []DisplayCommand
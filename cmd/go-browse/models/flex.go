@@ -0,0 +1,701 @@
+package models
+
+import (
+	"sort"
+	"strings"
+)
+
+// flexAxes is how a flex container lays out its items: which way its main axis runs, whether
+// items wrap onto several lines, and the sizes of its content box along each axis
+type flexAxes struct {
+	row         bool // the main axis is horizontal
+	reverse     bool // items start from the right or the bottom
+	wrap        bool // items can wrap onto several lines
+	wrapReverse bool // lines stack from the bottom or the right
+
+	mainGap  LayoutUnit // space between items on a line
+	crossGap LayoutUnit // space between lines
+
+	mainSize      LayoutUnit
+	definiteMain  bool // whether mainSize is known before the items are laid out
+	crossSize     LayoutUnit
+	definiteCross bool
+}
+
+// flexItem is a child of a flex container while the container sizes and places it. Sizes
+// are of the item's content box.
+type flexItem struct {
+	box    *LayoutBox
+	edges  Dimensions // margins, borders and padding, with auto margins as zero
+	auto   autoMargins
+	order  float64
+	grow   float64
+	shrink float64
+	align  string // the item's align-self, with auto resolved
+
+	base         LayoutUnit // the flex base size, what the item is flexed from
+	hypothetical LayoutUnit // the base size within the item's min and max main sizes
+	minMain      LayoutUnit
+	maxMain      LayoutUnit
+	main         LayoutUnit // main size after flexing
+	frozen       bool       // the main size can't change any more
+
+	cross     LayoutUnit
+	stretched bool
+	baseline  LayoutUnit // from the top of the margin box to the first baseline
+
+	// where the margin box goes, from the main-start and cross-start edges of the container
+	mainPosition  LayoutUnit
+	crossPosition LayoutUnit
+}
+
+// flexLine is a row or column of items in a flex container
+type flexLine struct {
+	items    []*flexItem
+	cross    LayoutUnit
+	position LayoutUnit // from the cross-start edge of the container
+	baseline LayoutUnit // the largest baseline of the baseline-aligned items
+}
+
+// LayoutFlexChildren lays out the children of a flex container as flex items, following the
+// flex layout algorithm from CSS Flexible Box Layout, and sets the container's content height
+// to the space its lines take up. Items are ordered, collected into lines, flexed to fill
+// their lines, then aligned along both axes.
+func (lb *LayoutBox) LayoutFlexChildren() {
+	d := &lb.Dimensions
+	f := lb.flexAxes()
+	items := lb.flexItems(f)
+
+	if !f.definiteMain {
+		// a column without a set height is as tall as its items, within its min and max height
+		used := f.gaps(f.mainGap, len(items))
+		for _, item := range items {
+			used += item.hypothetical + f.mainEdges(item)
+		}
+		f.mainSize = lb.clampHeight(used)
+	}
+
+	lines := f.collectLines(items)
+	for _, line := range lines {
+		f.resolveFlexibleLengths(line)
+	}
+
+	for _, item := range items {
+		lb.hypotheticalCrossSize(f, item)
+	}
+	lb.crossSizeLines(&f, lines)
+
+	container := lb.GetStyledNode()
+	for _, line := range lines {
+		f.justifyLine(container, line)
+		for _, item := range line.items {
+			lb.alignItem(f, line, item)
+		}
+	}
+
+	for _, item := range items {
+		mainOuter, crossOuter := item.main+f.mainEdges(item), item.cross+f.crossEdges(item)
+		mainPosition, crossPosition := item.mainPosition, item.crossPosition
+		if f.reverse {
+			mainPosition = f.mainSize - mainPosition - mainOuter
+		}
+		if f.wrapReverse {
+			crossPosition = f.crossSize - crossPosition - crossOuter
+		}
+
+		if f.row {
+			var height *LayoutUnit
+			if item.stretched {
+				height = &item.cross
+			}
+			item.box.layoutAt(d.Content.X+mainPosition, d.Content.Y+crossPosition, item.main, height, item.edges)
+		} else {
+			main := item.main
+			item.box.layoutAt(d.Content.X+crossPosition, d.Content.Y+mainPosition, item.cross, &main, item.edges)
+		}
+	}
+
+	if f.row {
+		d.Content.Height = f.crossSize
+	} else {
+		d.Content.Height = f.mainSize
+	}
+}
+
+// flexAxes reads the direction, wrapping and gaps of a flex container
+func (lb *LayoutBox) flexAxes() flexAxes {
+	styledNode := lb.GetStyledNode()
+	direction := styledNode.Lookup([]string{"flex-direction"}, NewKeyword("row")).Keyword
+	wrap := styledNode.Lookup([]string{"flex-wrap"}, NewKeyword("nowrap")).Keyword
+
+	f := flexAxes{
+		row:         direction != "column" && direction != "column-reverse",
+		reverse:     strings.HasSuffix(direction, "-reverse"),
+		wrap:        wrap == "wrap" || wrap == "wrap-reverse",
+		wrapReverse: wrap == "wrap-reverse",
+	}
+
+	lengths := lb.childLengths()
+	columnGap, rowGap := lb.resolveGaps(lb.Dimensions.Content.Width, lengths)
+
+	if f.row {
+		f.mainGap, f.crossGap = columnGap, rowGap
+		f.mainSize, f.definiteMain = lb.Dimensions.Content.Width, true
+		f.crossSize, f.definiteCross = lengths.containerHeight, lengths.definiteHeight
+	} else {
+		f.mainGap, f.crossGap = rowGap, columnGap
+		f.mainSize, f.definiteMain = lengths.containerHeight, lengths.definiteHeight
+		f.crossSize, f.definiteCross = lb.Dimensions.Content.Width, true
+	}
+	return f
+}
+
+// resolveGaps resolves a container's column-gap and row-gap. Column gaps are percentages of
+// width, and row gaps of the height in lengths if it is known.
+func (lb *LayoutBox) resolveGaps(width LayoutUnit, lengths lengthContext) (LayoutUnit, LayoutUnit) {
+	rowGap := lb.gap("row-gap", 0)
+	if lengths.definiteHeight {
+		rowGap = lb.gap("row-gap", lengths.containerHeight)
+	}
+	return lb.gap("column-gap", width), rowGap
+}
+
+// gap resolves row-gap or column-gap, where normal means no gap
+func (lb *LayoutBox) gap(name string, base LayoutUnit) LayoutUnit {
+	gap := lb.length(lb.GetStyledNode().Lookup([]string{name}, NewKeyword("normal")), base)
+	return maxUnit(gap, 0)
+}
+
+// gaps returns the space taken up by the gaps between count items or lines
+func (f flexAxes) gaps(gap LayoutUnit, count int) LayoutUnit {
+	if count < 2 {
+		return 0
+	}
+	return gap * LayoutUnit(count-1)
+}
+
+// mainEdges returns the size of an item's margins, borders and padding along the main axis
+func (f flexAxes) mainEdges(item *flexItem) LayoutUnit {
+	if f.row {
+		return item.edges.edgeWidth()
+	}
+	return item.edges.edgeHeight()
+}
+
+// crossEdges returns the size of an item's margins, borders and padding along the cross axis
+func (f flexAxes) crossEdges(item *flexItem) LayoutUnit {
+	if f.row {
+		return item.edges.edgeHeight()
+	}
+	return item.edges.edgeWidth()
+}
+
+// flexItems turns the children of a flex container into flex items in order-modified
+// document order, and works out how big each one would like to be
+func (lb *LayoutBox) flexItems(f flexAxes) []*flexItem {
+	container := lb.GetStyledNode()
+	lengths := lb.childLengths()
+	alignItems := container.Lookup([]string{"align-items"}, NewKeyword("normal")).Keyword
+
+	items := make([]*flexItem, 0, len(lb.Children))
+	for _, child := range lb.Children {
+		child.lengths = lengths
+		styledNode := child.GetStyledNode()
+
+		item := &flexItem{
+			box:    child,
+			order:  styledNode.Lookup([]string{"order"}, NewNumber(0)).Number,
+			grow:   styledNode.Lookup([]string{"flex-grow"}, NewNumber(0)).Number,
+			shrink: styledNode.Lookup([]string{"flex-shrink"}, NewNumber(1)).Number,
+			align:  styledNode.Lookup([]string{"align-self"}, NewKeyword("auto")).Keyword,
+		}
+		if item.align == "auto" {
+			item.align = alignItems
+		}
+		item.edges, item.auto = child.boxEdges(lb.Dimensions.Content.Width)
+		items = append(items, item)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].order < items[j].order
+	})
+
+	for _, item := range items {
+		lb.flexBaseSize(f, item)
+	}
+	return items
+}
+
+// flexBaseSize works out the size an item is flexed from and its hypothetical main size, the
+// size it would have if it didn't flex. Items in a column get their width first, since their
+// height depends on it: the width of the container if they stretch across a single line, and
+// the width of their content otherwise. Their content is only measured once.
+func (lb *LayoutBox) flexBaseSize(f flexAxes, item *flexItem) {
+	box := item.box
+	styledNode := box.GetStyledNode()
+	base := lb.Dimensions.Content.Width
+
+	sizeProperty, minProperty := "width", "min-width"
+	if f.row {
+		item.minMain, item.maxMain = box.widthLimits(base)
+	} else {
+		sizeProperty, minProperty = "height", "min-height"
+		item.minMain, item.maxMain = box.heightLimits()
+		item.cross = box.fitContentWidth(f.crossSize-item.edges.edgeWidth(), base)
+		if !f.wrap && item.stretches(f) {
+			item.cross = maxUnit(box.clampWidth(f.crossSize-item.edges.edgeWidth(), base), 0)
+		}
+	}
+
+	// percentages along the main axis are of the container's main size
+	resolve := func(v Value) (LayoutUnit, bool) {
+		if f.row {
+			return box.lengths.resolveLength(v, base)
+		}
+		return box.resolveHeight(v)
+	}
+	measured, hasMeasured := LayoutUnit(0), false
+	contentSize := func() LayoutUnit {
+		if !hasMeasured {
+			if f.row {
+				_, measured = box.intrinsicWidths()
+			} else {
+				measured = box.contentHeight(item.cross, item.edges)
+			}
+			hasMeasured = true
+		}
+		return measured
+	}
+
+	size := styledNode.Lookup([]string{sizeProperty}, NewKeyword("auto"))
+	specified, hasSize := resolve(size)
+
+	basis := styledNode.Lookup([]string{"flex-basis"}, NewKeyword("auto"))
+	if basis.IsAuto() {
+		basis = size
+	}
+	if resolved, ok := resolve(basis); ok {
+		item.base = maxUnit(resolved, 0)
+	} else {
+		item.base = contentSize()
+	}
+
+	// an item with an auto minimum size doesn't shrink below its content, unless it scrolls
+	overflow := styledNode.Lookup([]string{"overflow"}, NewKeyword("visible"))
+	if styledNode.Lookup([]string{minProperty}, NewKeyword("auto")).IsAuto() && (overflow.IsKeyword("visible") || overflow.IsKeyword("clip")) {
+		minimum := contentSize()
+		if f.row {
+			minimum, _ = box.contentWidths()
+		}
+		if hasSize {
+			minimum = minUnit(minimum, specified)
+		}
+		item.minMain = minUnit(minimum, item.maxMain)
+	}
+
+	item.hypothetical = item.clampMain(item.base)
+}
+
+// clampMain applies an item's min and max main sizes to a size, with the minimum winning
+func (item *flexItem) clampMain(size LayoutUnit) LayoutUnit {
+	return maxUnit(minUnit(size, item.maxMain), item.minMain)
+}
+
+// collectLines puts items on lines. A container that wraps starts a new line whenever the
+// next item wouldn't fit; one that doesn't puts them all on one line.
+func (f flexAxes) collectLines(items []*flexItem) []*flexLine {
+	lines := make([]*flexLine, 0)
+	if len(items) == 0 {
+		return lines
+	}
+
+	line := &flexLine{}
+	used := LayoutUnit(0)
+	for _, item := range items {
+		outer := item.hypothetical + f.mainEdges(item)
+		if f.wrap && len(line.items) > 0 && used+f.mainGap+outer > f.mainSize {
+			lines = append(lines, line)
+			line, used = &flexLine{}, 0
+		}
+		if len(line.items) > 0 {
+			used += f.mainGap
+		}
+		line.items = append(line.items, item)
+		used += outer
+	}
+	return append(lines, line)
+}
+
+// resolveFlexibleLengths grows or shrinks the items on a line so they fill it, in proportion
+// to their flex-grow factors, or their flex-shrink factors scaled by their base sizes. Items
+// that hit their min or max main size are frozen there and the rest flex again.
+func (f flexAxes) resolveFlexibleLengths(line *flexLine) {
+	items := line.items
+
+	used := f.gaps(f.mainGap, len(items))
+	for _, item := range items {
+		used += item.hypothetical + f.mainEdges(item)
+	}
+	growing := used < f.mainSize
+
+	factor := func(item *flexItem) float64 {
+		if growing {
+			return item.grow
+		}
+		return item.shrink
+	}
+
+	for _, item := range items {
+		item.main = item.hypothetical
+		item.frozen = factor(item) == 0 ||
+			(growing && item.base > item.hypothetical) || (!growing && item.base < item.hypothetical)
+	}
+
+	// freeSpace is what's left of the line once frozen items take their sizes and the rest
+	// take their base sizes
+	freeSpace := func() LayoutUnit {
+		free := f.mainSize - f.gaps(f.mainGap, len(items))
+		for _, item := range items {
+			free -= f.mainEdges(item)
+			if item.frozen {
+				free -= item.main
+			} else {
+				free -= item.base
+			}
+		}
+		return free
+	}
+	initialFree := freeSpace()
+
+	for {
+		unfrozen := make([]*flexItem, 0, len(items))
+		factors, scaledShrink := 0.0, 0.0
+		for _, item := range items {
+			if !item.frozen {
+				unfrozen = append(unfrozen, item)
+				factors += factor(item)
+				scaledShrink += item.shrink * float64(item.base)
+			}
+		}
+		if len(unfrozen) == 0 {
+			break
+		}
+
+		// factors adding up to less than one only hand out that fraction of the free space
+		free := freeSpace()
+		if factors < 1 {
+			if limited := initialFree.Scale(factors); absUnit(limited) < absUnit(free) {
+				free = limited
+			}
+		}
+
+		violation := LayoutUnit(0)
+		targets := make([]LayoutUnit, len(unfrozen))
+		for i, item := range unfrozen {
+			target := item.base
+			switch {
+			case growing && free > 0 && factors > 0:
+				target += free.Scale(item.grow / factors)
+			case !growing && free < 0 && scaledShrink > 0:
+				target += free.Scale(item.shrink * float64(item.base) / scaledShrink)
+			}
+			targets[i] = target
+			item.main = maxUnit(item.clampMain(target), 0)
+			violation += item.main - target
+		}
+
+		// freeze everything if nothing was clamped, otherwise only the items clamped the
+		// way that matters most
+		for i, item := range unfrozen {
+			switch {
+			case violation == 0:
+				item.frozen = true
+			case violation > 0 && item.main > targets[i]:
+				item.frozen = true
+			case violation < 0 && item.main < targets[i]:
+				item.frozen = true
+			}
+		}
+	}
+}
+
+func absUnit(u LayoutUnit) LayoutUnit {
+	if u < 0 {
+		return -u
+	}
+	return u
+}
+
+// hypotheticalCrossSize works out how big an item is across the line once it has its main
+// size. Items in a row are laid out at their width to find their height and baseline.
+func (lb *LayoutBox) hypotheticalCrossSize(f flexAxes, item *flexItem) {
+	if !f.row {
+		return
+	}
+
+	measured := item.box.measure(item.main, item.edges)
+	item.cross = measured.height
+	item.baseline = measured.baseline
+}
+
+// baselineAligned returns true if an item is aligned by its baseline, which only rows do
+func (f flexAxes) baselineAligned(item *flexItem) bool {
+	return f.row && !f.wrapReverse && strings.HasSuffix(item.align, "baseline") && !item.auto.top && !item.auto.bottom
+}
+
+// crossSizeLines works out how big each line is across the container, places the lines
+// according to align-content, and stretches the items that stretch to fill their line
+func (lb *LayoutBox) crossSizeLines(f *flexAxes, lines []*flexLine) {
+	for _, line := range lines {
+		// a single line fills a container whose cross size is known
+		if !f.wrap && f.definiteCross {
+			line.cross = f.crossSize
+			continue
+		}
+
+		above, below, largest := LayoutUnit(0), LayoutUnit(0), LayoutUnit(0)
+		for _, item := range line.items {
+			outer := item.cross + f.crossEdges(item)
+			if f.baselineAligned(item) {
+				above = maxUnit(above, item.baseline)
+				below = maxUnit(below, outer-item.baseline)
+			} else {
+				largest = maxUnit(largest, outer)
+			}
+		}
+		line.baseline = above
+		line.cross = maxUnit(largest, above+below)
+
+		if !f.wrap {
+			line.cross = lb.clampHeight(line.cross)
+		}
+	}
+
+	used := f.gaps(f.crossGap, len(lines))
+	for _, line := range lines {
+		used += line.cross
+	}
+	if !f.definiteCross {
+		f.crossSize = lb.clampHeight(used)
+	}
+
+	// align-content only applies to containers that wrap
+	offset, between := LayoutUnit(0), LayoutUnit(0)
+	if f.wrap && len(lines) > 0 {
+		free := f.crossSize - used
+		mode := f.crossAlignment(lb.GetStyledNode().Lookup([]string{"align-content"}, NewKeyword("normal")).Keyword)
+		if (mode == "normal" || mode == "stretch") && free > 0 {
+			extra := free / LayoutUnit(len(lines))
+			for _, line := range lines {
+				line.cross += extra
+			}
+		} else {
+			offset, between = distributeSpace(mode, free, len(lines))
+		}
+	}
+
+	position := offset
+	for _, line := range lines {
+		line.position = position
+		position += line.cross + f.crossGap + between
+
+		for _, item := range line.items {
+			lb.stretchItem(*f, line, item)
+		}
+	}
+}
+
+// stretchItem makes an item as big as its line across the container, if it stretches: when
+// its align-self is stretch or normal, it has no size of its own across the container and
+// none of its margins across the container are auto
+func (lb *LayoutBox) stretchItem(f flexAxes, line *flexLine, item *flexItem) {
+	if !item.stretches(f) {
+		return
+	}
+
+	box := item.box
+	size := line.cross - f.crossEdges(item)
+	if f.row {
+		item.cross = maxUnit(box.clampHeight(size), 0)
+	} else {
+		item.cross = maxUnit(box.clampWidth(size, lb.Dimensions.Content.Width), 0)
+	}
+	item.stretched = true
+}
+
+// stretches returns true if an item is stretched across its line, as stretchItem describes
+func (item *flexItem) stretches(f flexAxes) bool {
+	if item.align != "normal" && item.align != "stretch" {
+		return false
+	}
+
+	styledNode := item.box.GetStyledNode()
+	if f.row {
+		return !item.auto.top && !item.auto.bottom && styledNode.Lookup([]string{"height"}, NewKeyword("auto")).IsAuto()
+	}
+	return !item.auto.left && !item.auto.right && styledNode.Lookup([]string{"width"}, NewKeyword("auto")).IsAuto()
+}
+
+// justifyLine places the items on a line along the main axis. Auto margins take up any space
+// left over first, and justify-content distributes whatever they don't.
+func (f flexAxes) justifyLine(container StyledNode, line *flexLine) {
+	free := f.mainSize - f.gaps(f.mainGap, len(line.items))
+	autoCount := 0
+	for _, item := range line.items {
+		free -= item.main + f.mainEdges(item)
+		_, _, startAuto, endAuto := f.mainAutoMargins(item)
+		if startAuto {
+			autoCount++
+		}
+		if endAuto {
+			autoCount++
+		}
+	}
+
+	offset, between := LayoutUnit(0), LayoutUnit(0)
+	if autoCount > 0 {
+		share := free / LayoutUnit(autoCount)
+		for _, item := range line.items {
+			start, end, startAuto, endAuto := f.mainAutoMargins(item)
+			if startAuto && endAuto {
+				shareAutoMargins(2*share, start, end, true, true)
+			} else {
+				shareAutoMargins(share, start, end, startAuto, endAuto)
+			}
+		}
+	} else {
+		mode := container.Lookup([]string{"justify-content"}, NewKeyword("normal")).Keyword
+		offset, between = distributeSpace(f.mainAlignment(mode), free, len(line.items))
+	}
+
+	position := offset
+	for _, item := range line.items {
+		item.mainPosition = position
+		position += item.main + f.mainEdges(item) + f.mainGap + between
+	}
+}
+
+// mainAutoMargins returns the item's margins at the physical start and end of the main axis,
+// and whether each is auto
+func (f flexAxes) mainAutoMargins(item *flexItem) (*LayoutUnit, *LayoutUnit, bool, bool) {
+	if f.row {
+		return &item.edges.Margin.Left, &item.edges.Margin.Right, item.auto.left, item.auto.right
+	}
+	return &item.edges.Margin.Top, &item.edges.Margin.Bottom, item.auto.top, item.auto.bottom
+}
+
+// crossAutoMargins does the same as mainAutoMargins for the cross axis
+func (f flexAxes) crossAutoMargins(item *flexItem) (*LayoutUnit, *LayoutUnit, bool, bool) {
+	if f.row {
+		return &item.edges.Margin.Top, &item.edges.Margin.Bottom, item.auto.top, item.auto.bottom
+	}
+	return &item.edges.Margin.Left, &item.edges.Margin.Right, item.auto.left, item.auto.right
+}
+
+// shareAutoMargins splits free space evenly between whichever of two margins are auto
+func shareAutoMargins(free LayoutUnit, start, end *LayoutUnit, startAuto, endAuto bool) {
+	if free <= 0 {
+		return
+	}
+	if startAuto && endAuto {
+		*start += free / 2
+		*end += free - free/2
+		return
+	}
+	if startAuto {
+		*start += free
+	}
+	if endAuto {
+		*end += free
+	}
+}
+
+// alignItem places an item across its line. Auto margins take up any space left over first,
+// and align-self decides where the item goes if there aren't any.
+func (lb *LayoutBox) alignItem(f flexAxes, line *flexLine, item *flexItem) {
+	free := line.cross - item.cross - f.crossEdges(item)
+
+	offset := LayoutUnit(0)
+	start, end, startAuto, endAuto := f.crossAutoMargins(item)
+	switch {
+	case startAuto || endAuto:
+		shareAutoMargins(free, start, end, startAuto, endAuto)
+	case f.baselineAligned(item):
+		offset = line.baseline - item.baseline
+	default:
+		switch f.crossAlignment(item.align) {
+		case "flex-end":
+			offset = free
+		case "center":
+			offset = free / 2
+		}
+	}
+
+	item.crossPosition = line.position + offset
+}
+
+// mainAlignment turns the justify-content keywords that refer to physical directions into
+// flex-start or flex-end, which depend on the direction items are laid out in
+func (f flexAxes) mainAlignment(mode string) string {
+	switch mode {
+	case "start", "left", "right", "end":
+		if (f.row && mode == "right") || mode == "end" {
+			mode = "flex-end"
+		} else {
+			mode = "flex-start"
+		}
+		if f.reverse {
+			return oppositeAlignment(mode)
+		}
+	}
+	return mode
+}
+
+// crossAlignment does the same as mainAlignment for align-self and align-content, whose
+// start and end flip when lines wrap in reverse
+func (f flexAxes) crossAlignment(mode string) string {
+	switch mode {
+	case "start", "self-start", "end", "self-end":
+		mode = "flex-" + strings.TrimPrefix(mode, "self-")
+		if f.wrapReverse {
+			return oppositeAlignment(mode)
+		}
+	}
+	return mode
+}
+
+func oppositeAlignment(mode string) string {
+	if mode == "flex-start" {
+		return "flex-end"
+	}
+	return "flex-start"
+}
+
+// distributeSpace returns where the first of count boxes starts and the extra space between
+// each pair of them when free space is distributed according to a justify-content or
+// align-content keyword. Spreading negative space falls back to packing the boxes together.
+func distributeSpace(mode string, free LayoutUnit, count int) (LayoutUnit, LayoutUnit) {
+	switch mode {
+	case "flex-end":
+		return free, 0
+	case "center":
+		return free / 2, 0
+	case "space-between":
+		if free > 0 && count > 1 {
+			return 0, free / LayoutUnit(count-1)
+		}
+	case "space-around":
+		if free > 0 {
+			each := free / LayoutUnit(count)
+			return each / 2, each
+		}
+		return free / 2, 0
+	case "space-evenly":
+		if free > 0 {
+			each := free / LayoutUnit(count+1)
+			return each, each
+		}
+		return free / 2, 0
+	}
+	return 0, 0
+}
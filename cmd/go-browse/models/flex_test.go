@@ -0,0 +1,231 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// styledBox is a box for an element with the given computed values
+func styledBox(boxType BoxType, values PropertyMap, children ...*LayoutBox) *LayoutBox {
+	box := NewLayoutBox(boxType, &StyledNode{SpecifiedValues: values})
+	box.Children = children
+	return &box
+}
+
+// layoutRoot lays a box out as the root of a 1024x768 viewport
+func layoutRoot(box *LayoutBox) {
+	box.Layout(Dimensions{Content: Rectangle{Width: FromPixels(1024), Height: FromPixels(768)}})
+}
+
+// TestResolveFlexibleLengths checks the main sizes items on a line flex to
+func TestResolveFlexibleLengths(t *testing.T) {
+	// max is zero for an item without a max main size
+	type spec struct{ base, min, max, grow, shrink float64 }
+	tests := []struct {
+		name     string
+		mainSize float64
+		gap      float64
+		items    []spec
+		want     []float64
+	}{
+		{"grow evenly", 400, 0, []spec{{100, 0, 0, 1, 1}, {100, 0, 0, 1, 1}}, []float64{200, 200}},
+		{"grow by factor", 400, 0, []spec{{0, 0, 0, 1, 1}, {0, 0, 0, 3, 1}}, []float64{100, 300}},
+		{"gaps aren't shared out", 410, 10, []spec{{0, 0, 0, 1, 1}, {0, 0, 0, 1, 1}}, []float64{200, 200}},
+		{"no growing without a factor", 400, 0, []spec{{100, 0, 0, 0, 1}, {100, 0, 0, 0, 1}}, []float64{100, 100}},
+		{"shrink scaled by base size", 200, 0, []spec{{100, 0, 0, 0, 1}, {300, 0, 0, 0, 1}}, []float64{50, 150}},
+		{"max size freezes a growing item", 400, 0, []spec{{0, 0, 50, 1, 1}, {0, 0, 0, 1, 1}}, []float64{50, 350}},
+		{"min size freezes a shrinking item", 200, 0, []spec{{200, 150, 0, 0, 1}, {200, 0, 0, 0, 1}}, []float64{150, 50}},
+		{
+			// the first pass clamps one item down and one up; more is added than taken away,
+			// so only the item held at its minimum freezes and the other two flex again
+			"min and max in the same pass", 300, 0,
+			[]spec{{0, 0, 50, 1, 1}, {0, 0, 0, 1, 1}, {0, 200, 0, 1, 1}},
+			[]float64{50, 50, 200},
+		},
+		{"growth factors below one", 400, 0, []spec{{0, 0, 0, 0.25, 1}, {0, 0, 0, 0.25, 1}}, []float64{100, 100}},
+		{"shrink factors below one", 300, 0, []spec{{200, 0, 0, 0, 0.5}, {200, 0, 0, 0, 0}}, []float64{150, 200}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := flexAxes{row: true, mainSize: FromPixels(test.mainSize), definiteMain: true, mainGap: FromPixels(test.gap)}
+			line := &flexLine{}
+			for _, s := range test.items {
+				item := &flexItem{base: FromPixels(s.base), minMain: FromPixels(s.min), maxMain: noLimit, grow: s.grow, shrink: s.shrink}
+				if s.max > 0 {
+					item.maxMain = FromPixels(s.max)
+				}
+				item.hypothetical = item.clampMain(item.base)
+				line.items = append(line.items, item)
+			}
+
+			f.resolveFlexibleLengths(line)
+
+			for i, item := range line.items {
+				if item.main != FromPixels(test.want[i]) {
+					t.Errorf("item %d is %v, want %v", i, item.main, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+// TestDistributeSpace checks justify-content and align-content spacing, including negative
+// free space, which the space-* keywords can't spread out
+func TestDistributeSpace(t *testing.T) {
+	tests := []struct {
+		mode            string
+		free            float64
+		count           int
+		offset, between float64
+	}{
+		{"flex-start", 300, 3, 0, 0},
+		{"flex-end", 300, 3, 300, 0},
+		{"center", 300, 3, 150, 0},
+		{"space-between", 300, 4, 0, 100},
+		{"space-around", 300, 3, 50, 100},
+		{"space-evenly", 400, 3, 100, 100},
+		{"space-between", 300, 1, 0, 0},
+		{"flex-end", -60, 3, -60, 0},
+		{"center", -60, 3, -30, 0},
+		{"space-between", -60, 3, 0, 0},
+		{"space-around", -60, 3, -30, 0},
+		{"space-evenly", -60, 3, -30, 0},
+	}
+
+	for _, test := range tests {
+		offset, between := distributeSpace(test.mode, FromPixels(test.free), test.count)
+		if offset != FromPixels(test.offset) || between != FromPixels(test.between) {
+			t.Errorf("distributeSpace(%s, %v, %d) = %v, %v, want %v, %v",
+				test.mode, test.free, test.count, offset, between, test.offset, test.between)
+		}
+	}
+}
+
+// TestFlexPositions lays out flex containers and checks where their items' content boxes
+// end up, in particular that reversed directions and wrap-reverse mirror the layout
+func TestFlexPositions(t *testing.T) {
+	type position struct{ x, y, width float64 }
+	square := PropertyMap{"width": NewLength(50, Px), "height": NewLength(20, Px)}
+	tests := []struct {
+		name      string
+		container PropertyMap
+		items     []PropertyMap // nil for a 50x20 item
+		want      []position
+	}{
+		{
+			name:      "row with gap",
+			container: PropertyMap{"width": NewLength(300, Px), "column-gap": NewLength(10, Px)},
+			items:     []PropertyMap{nil, nil, nil},
+			want:      []position{{0, 0, 50}, {60, 0, 50}, {120, 0, 50}},
+		},
+		{
+			name:      "row-reverse with gap",
+			container: PropertyMap{"width": NewLength(300, Px), "column-gap": NewLength(10, Px), "flex-direction": NewKeyword("row-reverse")},
+			items:     []PropertyMap{nil, nil, nil},
+			want:      []position{{250, 0, 50}, {190, 0, 50}, {130, 0, 50}},
+		},
+		{
+			name: "row-reverse packed to the left",
+			container: PropertyMap{"width": NewLength(300, Px), "column-gap": NewLength(10, Px),
+				"flex-direction": NewKeyword("row-reverse"), "justify-content": NewKeyword("left")},
+			items: []PropertyMap{nil, nil, nil},
+			want:  []position{{120, 0, 50}, {60, 0, 50}, {0, 0, 50}},
+		},
+		{
+			name: "column-reverse with gap",
+			container: PropertyMap{"width": NewLength(300, Px), "height": NewLength(200, Px), "row-gap": NewLength(10, Px),
+				"flex-direction": NewKeyword("column-reverse")},
+			items: []PropertyMap{square, square, square},
+			want:  []position{{0, 180, 50}, {0, 150, 50}, {0, 120, 50}},
+		},
+		{
+			name:      "wrap",
+			container: PropertyMap{"width": NewLength(120, Px), "flex-wrap": NewKeyword("wrap")},
+			items:     []PropertyMap{nil, nil, nil},
+			want:      []position{{0, 0, 50}, {50, 0, 50}, {0, 20, 50}},
+		},
+		{
+			name:      "wrap-reverse",
+			container: PropertyMap{"width": NewLength(120, Px), "flex-wrap": NewKeyword("wrap-reverse")},
+			items:     []PropertyMap{nil, nil, nil},
+			want:      []position{{0, 20, 50}, {50, 20, 50}, {0, 0, 50}},
+		},
+		{
+			// the lines share the extra height, and items sit at the bottom of theirs
+			name:      "wrap-reverse with stretched lines",
+			container: PropertyMap{"width": NewLength(120, Px), "height": NewLength(100, Px), "flex-wrap": NewKeyword("wrap-reverse")},
+			items:     []PropertyMap{nil, nil, nil},
+			want:      []position{{0, 80, 50}, {50, 80, 50}, {0, 30, 50}},
+		},
+		{
+			name:      "order",
+			container: PropertyMap{"width": NewLength(300, Px)},
+			items: []PropertyMap{
+				{"width": NewLength(50, Px), "height": NewLength(20, Px), "order": NewNumber(1)},
+				{"width": NewLength(50, Px), "height": NewLength(20, Px)},
+			},
+			want: []position{{50, 0, 50}, {0, 0, 50}},
+		},
+		{
+			// an item with an auto margin across a column doesn't stretch, and the margin takes
+			// up the space instead
+			name:      "column stretch and auto margins",
+			container: PropertyMap{"width": NewLength(300, Px), "flex-direction": NewKeyword("column")},
+			items: []PropertyMap{
+				{"height": NewLength(20, Px)},
+				{"height": NewLength(20, Px), "margin-left": NewKeyword("auto")},
+			},
+			want: []position{{0, 0, 300}, {300, 20, 0}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			items := make([]*LayoutBox, 0, len(test.items))
+			for _, values := range test.items {
+				if values == nil {
+					values = square
+				}
+				items = append(items, styledBox(BlockNode, values))
+			}
+			layoutRoot(styledBox(FlexNode, test.container, items...))
+
+			for i, item := range items {
+				content := item.Dimensions.Content
+				got := position{content.X.Pixels(), content.Y.Pixels(), content.Width.Pixels()}
+				if got != test.want[i] {
+					t.Errorf("item %d is at %+v, want %+v", i, got, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+// TestNestedFlexTime checks that deeply nested flex containers lay out in about the time
+// their size calls for. Each container lays its items out more than once, so without the
+// layout caches the work doubles with every level and these never finish.
+func TestNestedFlexTime(t *testing.T) {
+	for _, direction := range []string{"row", "column"} {
+		t.Run(direction, func(t *testing.T) {
+			box := styledBox(BlockNode, PropertyMap{"height": NewLength(10, Px)})
+			for depth := 0; depth < 40; depth++ {
+				box = styledBox(FlexNode, PropertyMap{"flex-direction": NewKeyword(direction)}, box)
+			}
+
+			done := make(chan struct{})
+			go func() {
+				layoutRoot(box)
+				close(done)
+			}()
+			select {
+			case <-done:
+				if height := box.Dimensions.Content.Height; height != FromPixels(10) {
+					t.Errorf("outermost container is %v tall, want 10", height)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("laying out 40 nested flex containers didn't finish")
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"strings"
+
+	"github.com/bern/go-browse/cmd/go-browse/fonts"
+)
+
+// absoluteFontSizes maps the font-size keywords onto pixels
+var absoluteFontSizes = map[string]float64{
+	"xx-small":  9,
+	"x-small":   10,
+	"small":     13,
+	"medium":    16,
+	"large":     18,
+	"x-large":   24,
+	"xx-large":  32,
+	"xxx-large": 48,
+}
+
+// FontFor resolves the font-family, font-size, font-weight and font-style of a StyledNode
+// to a face in the default font collection
+func FontFor(node StyledNode) *fonts.Face {
+	return fonts.Default.Resolve(FontDescription(node))
+}
+
+// FontDescription reads the font properties of a StyledNode
+func FontDescription(node StyledNode) fonts.Description {
+	description := fonts.Description{
+		Families: make([]string, 0),
+		Size:     16,
+		Weight:   400,
+		Style:    fonts.Normal,
+	}
+
+	if family := node.value("font-family"); family != nil {
+		for _, item := range family.Items() {
+			description.Families = append(description.Families, familyName(item))
+		}
+	}
+
+	if size := node.value("font-size"); size != nil {
+		switch {
+		case size.ValueType == LengthValue && size.Unit == Px:
+			description.Size = size.Number
+		case size.ValueType == KeywordValue:
+			if px, ok := absoluteFontSizes[size.Keyword]; ok {
+				description.Size = px
+			}
+		}
+	}
+
+	// the weight is a number once computed, but a node that hasn't been may still have a keyword
+	if weight := node.value("font-weight"); weight != nil {
+		if computed := computeFontWeight(*weight, 400); computed.ValueType == NumberValue {
+			description.Weight = int(computed.Number)
+		}
+	}
+
+	if style := node.value("font-style"); style != nil && (style.IsKeyword("italic") || style.IsKeyword("oblique")) {
+		description.Style = fonts.Italic
+	}
+
+	return description
+}
+
+// FontWeight returns the computed font-weight of a set of values, or 400 if it isn't set
+func FontWeight(values PropertyMap) float64 {
+	if weight, ok := values["font-weight"]; ok && weight.ValueType == NumberValue {
+		return weight.Number
+	}
+	return 400
+}
+
+// computeFontWeight resolves a font-weight to a number. bolder and lighter step to the next
+// weight from the parent's, following the table in CSS Fonts §2.2, so they add up when nested
+// and never go the wrong way.
+func computeFontWeight(v Value, parent float64) Value {
+	switch v.Keyword {
+	case "normal":
+		return NewNumber(400)
+	case "bold":
+		return NewNumber(700)
+	case "bolder":
+		switch {
+		case parent < 350:
+			return NewNumber(400)
+		case parent < 550:
+			return NewNumber(700)
+		}
+		return NewNumber(maxFloat(parent, 900))
+	case "lighter":
+		switch {
+		case parent < 100:
+			return NewNumber(parent)
+		case parent < 550:
+			return NewNumber(100)
+		case parent < 750:
+			return NewNumber(400)
+		}
+		return NewNumber(700)
+	}
+	return v
+}
+
+// familyName returns the name of one entry in a font-family list, which may be quoted or
+// a run of unquoted identifiers like Times New Roman
+func familyName(value Value) string {
+	switch value.ValueType {
+	case StringValue:
+		return value.Text
+	case ListValue:
+		words := make([]string, 0, len(value.Values))
+		for _, word := range value.Values {
+			words = append(words, word.String())
+		}
+		return strings.Join(words, " ")
+	}
+	return value.String()
+}
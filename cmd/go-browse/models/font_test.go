@@ -0,0 +1,43 @@
+package models
+
+import "testing"
+
+// TestRelativeFontWeights checks that bolder and lighter are computed from the parent's
+// weight, so they add up when nested
+func TestRelativeFontWeights(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []Value // from the root down
+		want    float64
+	}{
+		{"bolder than normal", []Value{NewKeyword("bolder")}, 700},
+		{"nested bolder", []Value{NewKeyword("bolder"), NewKeyword("bolder")}, 900},
+		{"bolder than thin", []Value{NewNumber(100), NewKeyword("bolder")}, 400},
+		{"bolder than black", []Value{NewNumber(900), NewKeyword("bolder")}, 900},
+		{"bolder than heavier than black", []Value{NewNumber(950), NewKeyword("bolder")}, 950},
+		{"bolder than semibold", []Value{NewNumber(600), NewKeyword("bolder")}, 900},
+		{"lighter than normal", []Value{NewKeyword("lighter")}, 100},
+		{"lighter than bold", []Value{NewKeyword("bold"), NewKeyword("lighter")}, 400},
+		{"lighter than black", []Value{NewNumber(900), NewKeyword("lighter")}, 700},
+		{"lighter than hairline", []Value{NewNumber(50), NewKeyword("lighter")}, 50},
+		{"nested lighter", []Value{NewNumber(900), NewKeyword("lighter"), NewKeyword("lighter")}, 400},
+		{"inherited", []Value{NewKeyword("bold"), NewKeyword("bolder"), NewKeyword("inherit")}, 900},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var parent PropertyMap
+			for _, weight := range test.weights {
+				values := PropertyMap{"font-weight": weight}
+				if weight.IsKeyword("inherit") {
+					values["font-weight"] = parent["font-weight"]
+				}
+				ComputeValues(values, parent, 0)
+				parent = values
+			}
+			if got := FontWeight(parent); got != test.want {
+				t.Errorf("font-weight computes to %v, want %v", got, test.want)
+			}
+		})
+	}
+}
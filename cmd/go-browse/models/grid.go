@@ -0,0 +1,1152 @@
+package models
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// maxGridTracks is the most tracks a grid has along each axis. Line numbers, spans and
+// repeat() counts are clamped to it, as the Grid spec allows, so that page CSS can't ask for
+// a grid too big to hold in memory.
+const maxGridTracks = 10000
+
+// gridTrack is the sizing function of a row or column of a grid: the smallest size it can
+// take and the largest it would like to be. A fixed size is both.
+type gridTrack struct {
+	min Value
+	max Value
+}
+
+// trackList is the tracks along one axis of a grid, along with the names of the lines between
+// them. lines has one more entry than tracks: the names of the line before each track, then
+// the names of the last line.
+type trackList struct {
+	tracks  []gridTrack
+	autoFit []bool // tracks repeated by auto-fit, which collapse if no item ends up in them
+	lines   [][]string
+}
+
+// gridArea is a rectangle of cells in a grid, from its start lines to its end lines. Lines
+// are counted from zero.
+type gridArea struct {
+	rowStart, rowEnd       int
+	columnStart, columnEnd int
+}
+
+// gridItem is a child of a grid container while the container places, sizes and aligns it
+type gridItem struct {
+	box   *LayoutBox
+	edges Dimensions // margins, borders and padding, with auto margins as zero
+	auto  autoMargins
+	order float64
+
+	// the first track the item is in along each axis, or -1 until it is placed, and how many
+	// tracks it spans
+	row, column         int
+	rowSpan, columnSpan int
+}
+
+// sizedTrack is a track while the grid sizes and positions it
+type sizedTrack struct {
+	gridTrack
+	base      LayoutUnit
+	limit     LayoutUnit // the growth limit, or noLimit while it is infinite
+	collapsed bool       // an empty auto-fit track, which takes no space and has no gaps
+	position  LayoutUnit // from the start of the container's content box
+}
+
+// gridAxis is the tracks along one axis of a grid and the names of the lines between them
+type gridAxis struct {
+	tracks   []sizedTrack
+	names    map[string][]int
+	explicit int // how many of the tracks are explicit
+	gap      LayoutUnit
+	lengths  lengthContext
+}
+
+// trackSpan is the part of the grid an item covers along one axis, and how much room it
+// needs there
+type trackSpan struct {
+	start, span            int
+	minContent, maxContent LayoutUnit
+}
+
+// grid is a grid container's grid and the items placed in it
+type grid struct {
+	columns gridAxis
+	rows    gridAxis
+	items   []*gridItem
+}
+
+// LayoutGridChildren lays out the children of a grid container as grid items, following CSS
+// Grid Layout: items are placed in the grid, the columns and then the rows are sized to fit
+// them, and each item is laid out in its grid area. Sets the container's content height to the
+// height of the rows if it doesn't have a height of its own.
+func (lb *LayoutBox) LayoutGridChildren() {
+	d := &lb.Dimensions
+	container := lb.GetStyledNode()
+	lengths := lb.childLengths()
+	g := lb.buildGrid(d.Content.Width, lengths)
+
+	justifyContent := container.Lookup([]string{"justify-content"}, NewKeyword("normal")).Keyword
+	g.columns.size(g.columnSpans(), d.Content.Width, true, stretchesTracks(justifyContent))
+	g.columns.position(d.Content.Width, justifyContent)
+
+	justifyItems := container.Lookup([]string{"justify-items"}, NewKeyword("normal")).Keyword
+	alignItems := container.Lookup([]string{"align-items"}, NewKeyword("normal")).Keyword
+
+	// rows are as tall as their items are when laid out at the width of their columns
+	rowSpans := make([]trackSpan, 0, len(g.items))
+	for _, item := range g.items {
+		area := g.columns.extent(item.column, item.columnSpan)
+		item.box.lengths = lengthContext{viewport: lengths.viewport}
+		width := item.width(area, justifyItems)
+		height := item.box.measure(width, item.edges).height + item.edges.edgeHeight()
+		rowSpans = append(rowSpans, trackSpan{start: item.row, span: item.rowSpan, minContent: height, maxContent: height})
+	}
+
+	alignContent := container.Lookup([]string{"align-content"}, NewKeyword("normal")).Keyword
+	height := lengths.containerHeight
+	g.rows.size(rowSpans, height, lengths.definiteHeight, stretchesTracks(alignContent))
+	if !lengths.definiteHeight {
+		height = lb.clampHeight(g.rows.total())
+		if stretchesTracks(alignContent) {
+			g.rows.stretchAutoTracks(height)
+		}
+	}
+	g.rows.position(height, alignContent)
+
+	for _, item := range g.items {
+		column := g.columns.extent(item.column, item.columnSpan)
+		row := g.rows.extent(item.row, item.rowSpan)
+		area := Rectangle{X: d.Content.X + column.X, Y: d.Content.Y + row.X, Width: column.Width, Height: row.Width}
+		item.layout(area, lengths.viewport, justifyItems, alignItems)
+	}
+
+	d.Content.Height = height
+}
+
+// gridContentWidths returns the min-content and max-content widths of a grid container: the
+// widths of its columns when each is as narrow as its items allow, and when each is as wide
+// as its items would like
+func (lb *LayoutBox) gridContentWidths() (LayoutUnit, LayoutUnit) {
+	g := lb.buildGrid(0, lb.childLengths())
+	spans := g.columnSpans()
+
+	g.columns.initialize(0, false)
+	g.columns.resolveIntrinsicSizes(spans)
+	minContent := g.columns.total()
+
+	g.columns.maximize(0, false)
+	g.columns.expandFlexibleTracks(spans, 0, false)
+	return minContent, g.columns.total()
+}
+
+// buildGrid reads a grid container's templates, turns its children into grid items and places
+// them in the grid. width is the container's content width, which auto-fill and auto-fit
+// repeat into, and lengths the context its children resolve lengths in.
+func (lb *LayoutBox) buildGrid(width LayoutUnit, lengths lengthContext) *grid {
+	styledNode := lb.GetStyledNode()
+	none := NewKeyword("none")
+
+	columnGap, rowGap := lb.resolveGaps(width, lengths)
+	g := &grid{
+		columns: gridAxis{gap: columnGap, lengths: lengths},
+		rows:    gridAxis{gap: rowGap, lengths: lengths},
+	}
+
+	columns := g.columns.repeatTracks(styledNode.Lookup([]string{"grid-template-columns"}, none), width, true)
+	rows := g.rows.repeatTracks(styledNode.Lookup([]string{"grid-template-rows"}, none), lengths.containerHeight, lengths.definiteHeight)
+	areas, areaRows, areaColumns := gridAreas(styledNode.Lookup([]string{"grid-template-areas"}, none))
+
+	g.columns.nameLines(columns, minInt(maxInt(len(columns.tracks), areaColumns), maxGridTracks))
+	g.rows.nameLines(rows, minInt(maxInt(len(rows.tracks), areaRows), maxGridTracks))
+	for name, area := range areas {
+		g.rows.addName(name+"-start", area.rowStart)
+		g.rows.addName(name+"-end", area.rowEnd)
+		g.columns.addName(name+"-start", area.columnStart)
+		g.columns.addName(name+"-end", area.columnEnd)
+	}
+
+	for _, child := range lb.Children {
+		child.lengths = lengths
+		item := &gridItem{
+			box:   child,
+			order: child.GetStyledNode().Lookup([]string{"order"}, NewNumber(0)).Number,
+		}
+		item.edges, item.auto = child.boxEdges(width)
+		item.row, item.rowSpan = g.rows.placement(child, "grid-row-start", "grid-row-end")
+		item.column, item.columnSpan = g.columns.placement(child, "grid-column-start", "grid-column-end")
+		g.items = append(g.items, item)
+	}
+	sort.SliceStable(g.items, func(i, j int) bool {
+		return g.items[i].order < g.items[j].order
+	})
+
+	flow := styledNode.Lookup([]string{"grid-auto-flow"}, NewKeyword("row"))
+	rowCount, columnCount := placeItems(g.items, g.rows.explicit, g.columns.explicit, flow)
+
+	g.columns.buildTracks(columns, columnCount, styledNode.Lookup([]string{"grid-auto-columns"}, NewKeyword("auto")))
+	g.rows.buildTracks(rows, rowCount, styledNode.Lookup([]string{"grid-auto-rows"}, NewKeyword("auto")))
+	g.columns.collapseEmptyTracks(columns, g.spans(true))
+	g.rows.collapseEmptyTracks(rows, g.spans(false))
+	return g
+}
+
+// columnSpans returns where each item is along the columns and the widths of its content
+func (g *grid) columnSpans() []trackSpan {
+	spans := make([]trackSpan, 0, len(g.items))
+	for _, item := range g.items {
+		minContent, maxContent := item.box.outerIntrinsicWidths()
+		spans = append(spans, trackSpan{start: item.column, span: item.columnSpan, minContent: minContent, maxContent: maxContent})
+	}
+	return spans
+}
+
+// spans returns where each item is along the columns, or the rows, without its size
+func (g *grid) spans(columns bool) []trackSpan {
+	spans := make([]trackSpan, 0, len(g.items))
+	for _, item := range g.items {
+		if columns {
+			spans = append(spans, trackSpan{start: item.column, span: item.columnSpan})
+		} else {
+			spans = append(spans, trackSpan{start: item.row, span: item.rowSpan})
+		}
+	}
+	return spans
+}
+
+// parseTrackList reads a grid-template-columns or grid-template-rows value. An auto-fill or
+// auto-fit repeat() is repeated the given number of times, and the tracks it repeats are
+// returned as well so the caller can work out how many repetitions fit.
+func parseTrackList(v Value, repetitions int) (trackList, *trackList) {
+	list := trackList{lines: [][]string{nil}}
+	var repeated *trackList
+	if v.IsKeyword("none") {
+		return list, nil
+	}
+
+	for _, item := range v.Items() {
+		switch {
+		case item.ValueType == LineNamesValue:
+			list.name(item)
+		case item.IsFunction("repeat"):
+			tracks, _ := parseTrackList(item.Values[1], 0)
+			count := int(math.Min(item.Values[0].Number, maxGridTracks))
+			autoFit := item.Values[0].IsKeyword("auto-fit")
+			if item.Values[0].ValueType == KeywordValue {
+				repeated, count = &tracks, repetitions
+			}
+			for n := 0; n < count && len(list.tracks) < maxGridTracks; n++ {
+				list.extend(tracks, autoFit)
+			}
+		default:
+			list.add(parseTrackSize(item), false)
+		}
+	}
+	list.truncate(maxGridTracks)
+	return list, repeated
+}
+
+// parseTrackSize reads the size of a single track: a length, percentage, fr, keyword, minmax()
+// or fit-content()
+func parseTrackSize(v Value) gridTrack {
+	switch {
+	case v.IsFunction("minmax"):
+		return gridTrack{min: v.Values[0], max: v.Values[1]}
+	case isFlexible(v):
+		// a flexible track can't be smaller than its content
+		return gridTrack{min: NewKeyword("auto"), max: v}
+	}
+	return gridTrack{min: v, max: v}
+}
+
+// name adds line names to the last line of a track list
+func (t *trackList) name(names Value) {
+	last := len(t.lines) - 1
+	for _, name := range names.Values {
+		t.lines[last] = append(t.lines[last], name.Keyword)
+	}
+}
+
+// add appends a track to a track list
+func (t *trackList) add(track gridTrack, autoFit bool) {
+	t.tracks = append(t.tracks, track)
+	t.autoFit = append(t.autoFit, autoFit)
+	t.lines = append(t.lines, nil)
+}
+
+// extend appends the tracks and line names of another track list, whose first line is the
+// same as this list's last
+func (t *trackList) extend(other trackList, autoFit bool) {
+	for i, track := range other.tracks {
+		t.lines[len(t.lines)-1] = append(t.lines[len(t.lines)-1], other.lines[i]...)
+		t.add(track, autoFit)
+	}
+	t.lines[len(t.lines)-1] = append(t.lines[len(t.lines)-1], other.lines[len(other.tracks)]...)
+}
+
+// truncate drops the tracks past the first count, along with the names of the lines after them
+func (t *trackList) truncate(count int) {
+	if len(t.tracks) > count {
+		t.tracks, t.autoFit, t.lines = t.tracks[:count], t.autoFit[:count], t.lines[:count+1]
+	}
+}
+
+// isFlexible returns true for a track size in fr
+func isFlexible(v Value) bool {
+	return v.ValueType == LengthValue && v.Unit == Fr
+}
+
+// isIntrinsic returns true for a track size that depends on the items in the track
+func isIntrinsic(v Value) bool {
+	return v.IsAuto() || v.IsKeyword("min-content") || v.IsKeyword("max-content") || v.IsFunction("fit-content")
+}
+
+// breadth resolves a fixed track size, with percentages taken of available. Percentages don't
+// resolve if the space isn't definite, and behave like auto instead.
+func (a *gridAxis) breadth(v Value, available LayoutUnit, definite bool) (LayoutUnit, bool) {
+	if isFlexible(v) || isIntrinsic(v) || (usesPercentage(v) && !definite) {
+		return 0, false
+	}
+	return a.lengths.resolveLength(v, available)
+}
+
+// repeatTracks reads a track template, repeating an auto-fill or auto-fit repeat() as many
+// times as fit in available without overflowing it, or once if available isn't definite.
+func (a *gridAxis) repeatTracks(v Value, available LayoutUnit, definite bool) trackList {
+	list, repeated := parseTrackList(v, 0)
+	if repeated == nil {
+		return list
+	}
+
+	// tracks count with their fixed size, or their fixed minimum if they grow
+	fixed := func(tracks []gridTrack) (LayoutUnit, int) {
+		sum := LayoutUnit(0)
+		for _, track := range tracks {
+			size, ok := a.breadth(track.max, available, definite)
+			if !ok {
+				size, _ = a.breadth(track.min, available, definite)
+			}
+			sum += size
+		}
+		return sum, len(tracks)
+	}
+
+	repetitions := 1
+	fixedSum, fixedCount := fixed(list.tracks)
+	repeatSum, repeatCount := fixed(repeated.tracks)
+	if step := repeatSum + a.gap*LayoutUnit(repeatCount); definite && step > 0 {
+		room := available - fixedSum - a.gap*LayoutUnit(fixedCount-1)
+		repetitions = minInt(maxInt(int(room/step), 1), maxGridTracks)
+	}
+
+	list, _ = parseTrackList(v, repetitions)
+	return list
+}
+
+// gridAreas works out the rectangle each named area covers from grid-template-areas, along
+// with how many rows and columns the template has. A template whose rows have different
+// numbers of cells, or with a name that doesn't fill a rectangle, is ignored.
+func gridAreas(v Value) (map[string]gridArea, int, int) {
+	areas := make(map[string]gridArea)
+	if v.ValueType != StringValue && v.ValueType != ListValue {
+		return areas, 0, 0
+	}
+
+	rows := v.Items()
+	columns := -1
+	for r, row := range rows {
+		cells := gridAreaCells(row.Text)
+		if columns >= 0 && len(cells) != columns {
+			return map[string]gridArea{}, 0, 0
+		}
+		columns = len(cells)
+
+		for c, name := range cells {
+			if name == "" {
+				continue
+			}
+			area, ok := areas[name]
+			if !ok {
+				area = gridArea{rowStart: r, rowEnd: r + 1, columnStart: c, columnEnd: c + 1}
+			}
+			area.rowEnd, area.columnEnd = maxInt(area.rowEnd, r+1), maxInt(area.columnEnd, c+1)
+			areas[name] = area
+		}
+	}
+
+	// every cell in an area's bounding box has to belong to it
+	for name, area := range areas {
+		for r := area.rowStart; r < area.rowEnd; r++ {
+			cells := gridAreaCells(rows[r].Text)
+			for c := area.columnStart; c < area.columnEnd; c++ {
+				if cells[c] != name {
+					return map[string]gridArea{}, 0, 0
+				}
+			}
+		}
+	}
+	return areas, len(rows), columns
+}
+
+// gridAreaCells splits a row of grid-template-areas into the names of its cells. A run of dots
+// is a cell that isn't in any area, and has an empty name.
+func gridAreaCells(row string) []string {
+	cells := make([]string, 0)
+	for _, cell := range strings.Fields(row) {
+		if strings.Trim(cell, ".") == "" {
+			cell = ""
+		}
+		cells = append(cells, strings.ToLower(cell))
+	}
+	return cells
+}
+
+// nameLines records the line names of an explicit grid that is count tracks long
+func (a *gridAxis) nameLines(list trackList, count int) {
+	a.names = make(map[string][]int)
+	a.explicit = count
+	for line, names := range list.lines {
+		for _, name := range names {
+			a.addName(name, line)
+		}
+	}
+}
+
+// addName gives a line a name, keeping the lines with each name in order
+func (a *gridAxis) addName(name string, line int) {
+	lines := append(a.names[name], line)
+	sort.Ints(lines)
+	a.names[name] = lines
+}
+
+// gridLine is one side of an item's position along an axis, as set by a property like
+// grid-row-start: a line number, a line name with an optional number, or a span
+type gridLine struct {
+	number int // counts from the end if negative, and is zero if not given
+	name   string
+	span   int // set for span, and zero otherwise
+}
+
+// parseGridLine reads a grid-row-start, grid-column-end or similar value
+func parseGridLine(v Value) gridLine {
+	line := gridLine{}
+	isSpan := false
+	for _, item := range v.Items() {
+		switch {
+		case item.IsKeyword("span"):
+			isSpan = true
+		case item.ValueType == NumberValue:
+			line.number = int(math.Max(math.Min(item.Number, maxGridTracks), -maxGridTracks))
+		case item.ValueType == KeywordValue && !item.IsAuto():
+			line.name = item.Keyword
+		}
+	}
+
+	if isSpan {
+		return gridLine{span: maxInt(line.number, 1)}
+	}
+	return line
+}
+
+// resolveLine finds the line a gridLine refers to, if it refers to one. side is start or end:
+// a name that isn't a line name can refer to the start or end line of a named area.
+func (a *gridAxis) resolveLine(line gridLine, side string) (int, bool) {
+	if line.name != "" {
+		lines, ok := a.names[line.name+"-"+side]
+		if !ok || line.number != 0 {
+			lines = a.names[line.name]
+		}
+
+		n := line.number
+		if n == 0 {
+			n = 1
+		}
+		switch {
+		case n > 0 && n <= len(lines):
+			return lines[n-1], true
+		case n < 0 && -n <= len(lines):
+			return lines[len(lines)+n], true
+		}
+		return 0, false
+	}
+
+	switch {
+	case line.number > 0:
+		return line.number - 1, true
+	case line.number < 0:
+		return maxInt(a.explicit+1+line.number, 0), true
+	}
+	return 0, false
+}
+
+// placement works out where an item goes along an axis from its start and end properties: the
+// first track it is in, or -1 if that is left to auto-placement, and how many tracks it spans
+func (a *gridAxis) placement(box *LayoutBox, startProperty, endProperty string) (int, int) {
+	styledNode := box.GetStyledNode()
+	start := parseGridLine(styledNode.Lookup([]string{startProperty}, NewKeyword("auto")))
+	end := parseGridLine(styledNode.Lookup([]string{endProperty}, NewKeyword("auto")))
+	startLine, hasStart := a.resolveLine(start, "start")
+	endLine, hasEnd := a.resolveLine(end, "end")
+
+	switch {
+	case hasStart && hasEnd:
+		if endLine < startLine {
+			startLine, endLine = endLine, startLine
+		}
+		return clampSpan(startLine, maxInt(endLine-startLine, 1))
+	case hasStart:
+		return clampSpan(startLine, maxInt(end.span, 1))
+	case hasEnd:
+		span := maxInt(start.span, 1)
+		if endLine < span {
+			return 0, maxInt(endLine, 1)
+		}
+		return endLine - span, span
+	}
+	return -1, maxInt(maxInt(start.span, end.span), 1)
+}
+
+// clampSpan keeps the tracks an item spans within the first maxGridTracks, moving an item
+// that starts past the last of them back onto it
+func clampSpan(start, span int) (int, int) {
+	start = minInt(start, maxGridTracks-1)
+	return start, minInt(span, maxGridTracks-maxInt(start, 0))
+}
+
+// placeItems gives every item a place in the grid, following the auto-placement algorithm.
+// Items with a definite position go there, then items locked to a row (or a column, when
+// grid-auto-flow is column) go in the first gap in it, then the rest fill the grid in order.
+// dense packing looks for a gap from the start of the grid for every item, instead of from
+// the last item placed. Returns how many rows and columns the grid ends up with.
+func placeItems(items []*gridItem, rows, columns int, flow Value) (int, int) {
+	byColumn, dense := false, false
+	for _, keyword := range flow.Items() {
+		byColumn = byColumn || keyword.IsKeyword("column")
+		dense = dense || keyword.IsKeyword("dense")
+	}
+
+	// major is the axis the grid fills along, and minor the one it wraps across
+	major := func(item *gridItem) (*int, int) {
+		if byColumn {
+			return &item.column, item.columnSpan
+		}
+		return &item.row, item.rowSpan
+	}
+	minor := func(item *gridItem) (*int, int) {
+		if byColumn {
+			return &item.row, item.rowSpan
+		}
+		return &item.column, item.columnSpan
+	}
+	majorCount, minorCount := rows, columns
+	if byColumn {
+		majorCount, minorCount = columns, rows
+	}
+
+	// the grid is wide enough for every item with a definite position across it, and for
+	// every span
+	for _, item := range items {
+		start, span := minor(item)
+		minorCount = maxInt(minorCount, maxInt(*start, 0)+span)
+	}
+
+	// the cells items take up are kept as rectangles rather than one by one, so a big span
+	// costs no more than a small one
+	type cells struct{ majorStart, majorEnd, minorStart, minorEnd int }
+	taken := make([]cells, 0, len(items))
+	blocker := func(majorStart, majorSpan, minorStart, minorSpan int) (cells, bool) {
+		for _, c := range taken {
+			if c.majorStart < majorStart+majorSpan && majorStart < c.majorEnd &&
+				c.minorStart < minorStart+minorSpan && minorStart < c.minorEnd {
+				return c, true
+			}
+		}
+		return cells{}, false
+	}
+	occupy := func(item *gridItem) {
+		majorStart, majorSpan := major(item)
+		minorStart, minorSpan := minor(item)
+		taken = append(taken, cells{*majorStart, *majorStart + majorSpan, *minorStart, *minorStart + minorSpan})
+		majorCount = maxInt(majorCount, *majorStart+majorSpan)
+		minorCount = maxInt(minorCount, *minorStart+minorSpan)
+	}
+
+	for _, item := range items {
+		if item.row >= 0 && item.column >= 0 {
+			occupy(item)
+		}
+	}
+
+	cursors := make(map[int]int)
+	for _, item := range items {
+		majorStart, majorSpan := major(item)
+		minorStart, minorSpan := minor(item)
+		if *majorStart < 0 || *minorStart >= 0 {
+			continue
+		}
+		position := 0
+		if !dense {
+			position = cursors[*majorStart]
+		}
+		// a position that overlaps an item skips straight past it
+		for {
+			c, blocked := blocker(*majorStart, majorSpan, position, minorSpan)
+			if !blocked {
+				break
+			}
+			position = c.minorEnd
+		}
+		*minorStart = position
+		cursors[*majorStart] = position + minorSpan
+		occupy(item)
+	}
+
+	cursorMajor, cursorMinor := 0, 0
+	for _, item := range items {
+		majorStart, majorSpan := major(item)
+		minorStart, minorSpan := minor(item)
+		if *majorStart >= 0 {
+			continue
+		}
+		if dense {
+			cursorMajor, cursorMinor = 0, 0
+		}
+
+		if *minorStart >= 0 {
+			// an item locked across the grid moves on to the next line if the cursor is past it
+			if *minorStart < cursorMinor {
+				cursorMajor++
+			}
+			for {
+				c, blocked := blocker(cursorMajor, majorSpan, *minorStart, minorSpan)
+				if !blocked {
+					break
+				}
+				cursorMajor = c.majorEnd
+			}
+			cursorMinor = *minorStart
+		} else {
+			for {
+				c, blocked := blocker(cursorMajor, majorSpan, cursorMinor, minorSpan)
+				if !blocked && cursorMinor+minorSpan <= minorCount {
+					break
+				}
+				if blocked {
+					cursorMinor = c.minorEnd
+				} else {
+					cursorMinor++
+				}
+				if cursorMinor+minorSpan > minorCount {
+					cursorMajor, cursorMinor = cursorMajor+1, 0
+				}
+			}
+			*minorStart = cursorMinor
+		}
+		*majorStart = cursorMajor
+		occupy(item)
+	}
+
+	// auto-placement can run past the last track a grid may have, so items that end up there
+	// are pulled back into it
+	for _, item := range items {
+		item.row, item.rowSpan = clampSpan(item.row, item.rowSpan)
+		item.column, item.columnSpan = clampSpan(item.column, item.columnSpan)
+	}
+	majorCount, minorCount = minInt(majorCount, maxGridTracks), minInt(minorCount, maxGridTracks)
+
+	if byColumn {
+		return minorCount, majorCount
+	}
+	return majorCount, minorCount
+}
+
+// buildTracks lays out count tracks along an axis: the explicit tracks, then implicit tracks
+// sized by grid-auto-rows or grid-auto-columns, cycling through its sizes
+func (a *gridAxis) buildTracks(list trackList, count int, auto Value) {
+	implicit := make([]gridTrack, 0)
+	for _, size := range auto.Items() {
+		implicit = append(implicit, parseTrackSize(size))
+	}
+
+	a.tracks = make([]sizedTrack, count)
+	for i := range a.tracks {
+		switch {
+		case i < len(list.tracks):
+			a.tracks[i].gridTrack = list.tracks[i]
+		case i < a.explicit:
+			// tracks that only grid-template-areas creates are sized like implicit ones
+			a.tracks[i].gridTrack = implicit[0]
+		default:
+			a.tracks[i].gridTrack = implicit[(i-a.explicit)%len(implicit)]
+		}
+	}
+}
+
+// collapseEmptyTracks collapses the auto-fit tracks that no item is in
+func (a *gridAxis) collapseEmptyTracks(list trackList, spans []trackSpan) {
+	used := make([]bool, len(a.tracks))
+	for _, span := range spans {
+		for i := span.start; i < span.start+span.span; i++ {
+			used[i] = true
+		}
+	}
+	for i, autoFit := range list.autoFit {
+		a.tracks[i].collapsed = autoFit && !used[i]
+	}
+}
+
+// size runs the track sizing algorithm along an axis. available is the space the tracks
+// share, if definite, and stretch makes auto tracks take up whatever space is left.
+func (a *gridAxis) size(spans []trackSpan, available LayoutUnit, definite, stretch bool) {
+	a.initialize(available, definite)
+	a.resolveIntrinsicSizes(spans)
+	a.maximize(available, definite)
+	a.expandFlexibleTracks(spans, available, definite)
+	if stretch && definite {
+		a.stretchAutoTracks(available)
+	}
+}
+
+// initialize sets each track's base size to its fixed minimum and its growth limit to its
+// fixed maximum. Intrinsic minimums start at zero and intrinsic maximums at no limit.
+func (a *gridAxis) initialize(available LayoutUnit, definite bool) {
+	for i := range a.tracks {
+		t := &a.tracks[i]
+		t.base, t.limit = 0, noLimit
+		if t.collapsed {
+			t.limit = 0
+			continue
+		}
+		if base, ok := a.breadth(t.min, available, definite); ok {
+			t.base = base
+		}
+		if limit, ok := a.breadth(t.max, available, definite); ok {
+			t.limit = maxUnit(limit, t.base)
+		}
+		if isFlexible(t.max) {
+			t.limit = t.base
+		}
+	}
+}
+
+// resolveIntrinsicSizes grows tracks with intrinsic sizes to fit the items in them, starting
+// with the items that span one track. An item spanning several tracks hands the room it needs
+// beyond them out evenly between the intrinsic ones. Items in flexible tracks only affect the
+// base sizes of those tracks, since they are sized later.
+func (a *gridAxis) resolveIntrinsicSizes(spans []trackSpan) {
+	sorted := append([]trackSpan(nil), spans...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].span < sorted[j].span
+	})
+
+	for _, span := range sorted {
+		tracks := a.tracks[span.start : span.start+span.span]
+		gaps := a.gap * LayoutUnit(span.span-1)
+
+		if a.crossesFlexibleTrack(span) {
+			flexible := make([]*sizedTrack, 0)
+			base := gaps
+			for i := range tracks {
+				base += tracks[i].base
+				if isFlexible(tracks[i].max) && isIntrinsic(tracks[i].min) {
+					flexible = append(flexible, &tracks[i])
+				}
+			}
+			growTracks(flexible, span.minContent-base, func(t *sizedTrack) *LayoutUnit { return &t.base })
+			continue
+		}
+
+		// base sizes grow to fit the item's min-content size, or max-content for max-content
+		// tracks
+		growing, base := make([]*sizedTrack, 0), gaps
+		for i := range tracks {
+			t := &tracks[i]
+			base += t.base
+			if isIntrinsic(t.min) && !t.collapsed {
+				growing = append(growing, t)
+			}
+		}
+		contribution := span.minContent
+		if len(growing) == span.span && allKeyword(growing, true, "max-content") {
+			contribution = span.maxContent
+		}
+		growTracks(growing, contribution-base, func(t *sizedTrack) *LayoutUnit { return &t.base })
+
+		// growth limits grow to fit its max-content size, or min-content for min-content
+		// tracks, where infinite limits count as the base size
+		growing, limit := make([]*sizedTrack, 0), gaps
+		for i := range tracks {
+			t := &tracks[i]
+			if t.limit == noLimit {
+				limit += t.base
+			} else {
+				limit += t.limit
+			}
+			if isIntrinsic(t.max) && !t.collapsed {
+				growing = append(growing, t)
+			}
+		}
+		contribution = span.maxContent
+		if len(growing) == span.span && allKeyword(growing, false, "min-content") {
+			contribution = span.minContent
+		}
+		for _, t := range growing {
+			if t.limit == noLimit {
+				t.limit = t.base
+			}
+		}
+		growTracks(growing, contribution-limit, func(t *sizedTrack) *LayoutUnit { return &t.limit })
+	}
+
+	// limits that are still infinite become the base size, and fit-content() caps the rest
+	for i := range a.tracks {
+		t := &a.tracks[i]
+		if t.limit == noLimit {
+			t.limit = t.base
+		}
+		if t.max.IsFunction("fit-content") {
+			if ceiling, ok := a.breadth(t.max.Values[0], 0, false); ok {
+				t.limit = minUnit(t.limit, ceiling)
+			}
+		}
+		t.limit = maxUnit(t.limit, t.base)
+	}
+}
+
+// crossesFlexibleTrack returns true if an item spans a track with an fr maximum
+func (a *gridAxis) crossesFlexibleTrack(span trackSpan) bool {
+	for _, t := range a.tracks[span.start : span.start+span.span] {
+		if isFlexible(t.max) {
+			return true
+		}
+	}
+	return false
+}
+
+// allKeyword returns true if every track's minimum, or maximum if min isn't set, is keyword
+func allKeyword(tracks []*sizedTrack, min bool, keyword string) bool {
+	for _, t := range tracks {
+		size := t.max
+		if min {
+			size = t.min
+		}
+		if !size.IsKeyword(keyword) {
+			return false
+		}
+	}
+	return true
+}
+
+// growTracks shares extra space evenly between some tracks, growing the size size returns
+func growTracks(tracks []*sizedTrack, extra LayoutUnit, size func(*sizedTrack) *LayoutUnit) {
+	if extra <= 0 || len(tracks) == 0 {
+		return
+	}
+	share := extra / LayoutUnit(len(tracks))
+	for i, t := range tracks {
+		grow := share
+		if i == len(tracks)-1 {
+			grow = extra - share*LayoutUnit(len(tracks)-1)
+		}
+		*size(t) += grow
+	}
+}
+
+// maximize grows tracks towards their growth limits, sharing out the free space evenly if it
+// is definite, and all the way if it isn't
+func (a *gridAxis) maximize(available LayoutUnit, definite bool) {
+	if !definite {
+		for i := range a.tracks {
+			if !isFlexible(a.tracks[i].max) {
+				a.tracks[i].base = a.tracks[i].limit
+			}
+		}
+		return
+	}
+
+	for free := available - a.total(); free > 0; free = available - a.total() {
+		growing := make([]*sizedTrack, 0)
+		for i := range a.tracks {
+			if t := &a.tracks[i]; t.base < t.limit && !isFlexible(t.max) {
+				growing = append(growing, t)
+			}
+		}
+		if len(growing) == 0 {
+			return
+		}
+
+		// hand out the same amount to every track, or as much as the closest to its limit takes
+		share := free / LayoutUnit(len(growing))
+		for _, t := range growing {
+			share = minUnit(share, t.limit-t.base)
+		}
+		if share <= 0 {
+			return
+		}
+		for _, t := range growing {
+			t.base += share
+		}
+	}
+}
+
+// expandFlexibleTracks sizes the tracks with fr maximums. In definite space they share what
+// the other tracks leave in proportion to their factors, except that a track whose share is
+// smaller than its base size keeps its base size and drops out. In indefinite space an fr is
+// as big as it has to be for every flexible track to fit its items.
+func (a *gridAxis) expandFlexibleTracks(spans []trackSpan, available LayoutUnit, definite bool) {
+	flexible := make([]*sizedTrack, 0)
+	for i := range a.tracks {
+		if isFlexible(a.tracks[i].max) && !a.tracks[i].collapsed {
+			flexible = append(flexible, &a.tracks[i])
+		}
+	}
+	if len(flexible) == 0 {
+		return
+	}
+
+	var fraction float64
+	if definite {
+		leftover := available - a.gaps()
+		for i := range a.tracks {
+			if !isFlexible(a.tracks[i].max) {
+				leftover -= a.tracks[i].base
+			}
+		}
+		fraction = findFrSize(flexible, leftover)
+	} else {
+		for _, t := range flexible {
+			fraction = maxFloat(fraction, float64(t.base)/maxFloat(t.max.Number, 1))
+		}
+		for _, span := range spans {
+			if !a.crossesFlexibleTrack(span) {
+				continue
+			}
+			tracks := make([]*sizedTrack, 0)
+			leftover := span.maxContent - a.gap*LayoutUnit(span.span-1)
+			for i := span.start; i < span.start+span.span; i++ {
+				if t := &a.tracks[i]; isFlexible(t.max) {
+					tracks = append(tracks, t)
+				} else {
+					leftover -= t.base
+				}
+			}
+			fraction = maxFloat(fraction, findFrSize(tracks, leftover))
+		}
+	}
+
+	for _, t := range flexible {
+		t.base = maxUnit(t.base, LayoutUnit(fraction*t.max.Number))
+		t.limit = maxUnit(t.limit, t.base)
+	}
+}
+
+// findFrSize works out how big an fr is when flexible tracks share space between them. A
+// track whose share would be smaller than its base size keeps that size instead, and the rest
+// share what it leaves. Factors adding up to less than one count as one.
+func findFrSize(tracks []*sizedTrack, space LayoutUnit) float64 {
+	inflexible := make(map[*sizedTrack]bool)
+	for {
+		leftover, factors := space, 0.0
+		for _, t := range tracks {
+			if inflexible[t] {
+				leftover -= t.base
+			} else {
+				factors += t.max.Number
+			}
+		}
+		fraction := float64(maxUnit(leftover, 0)) / maxFloat(factors, 1)
+
+		done := true
+		for _, t := range tracks {
+			if !inflexible[t] && LayoutUnit(fraction*t.max.Number) < t.base {
+				inflexible[t], done = true, false
+			}
+		}
+		if done {
+			return fraction
+		}
+	}
+}
+
+// stretchAutoTracks shares the space left over in available evenly between the tracks with
+// an auto maximum
+func (a *gridAxis) stretchAutoTracks(available LayoutUnit) {
+	auto := make([]*sizedTrack, 0)
+	for i := range a.tracks {
+		if a.tracks[i].max.IsAuto() && !a.tracks[i].collapsed {
+			auto = append(auto, &a.tracks[i])
+		}
+	}
+	growTracks(auto, available-a.total(), func(t *sizedTrack) *LayoutUnit { return &t.base })
+}
+
+// total returns how much space the tracks and the gaps between them take up
+func (a *gridAxis) total() LayoutUnit {
+	total := a.gaps()
+	for _, t := range a.tracks {
+		total += t.base
+	}
+	return total
+}
+
+// gaps returns how much space the gaps between tracks take up. Collapsed tracks don't have
+// gaps around them.
+func (a *gridAxis) gaps() LayoutUnit {
+	count := 0
+	for _, t := range a.tracks {
+		if !t.collapsed {
+			count++
+		}
+	}
+	if count < 2 {
+		return 0
+	}
+	return a.gap * LayoutUnit(count-1)
+}
+
+// stretchesTracks returns true for the justify-content and align-content values that stretch
+// auto tracks to fill the container
+func stretchesTracks(mode string) bool {
+	return mode == "normal" || mode == "stretch"
+}
+
+// position places the tracks along an axis, distributing the space they leave in available
+// according to justify-content or align-content
+func (a *gridAxis) position(available LayoutUnit, mode string) {
+	count := 0
+	for _, t := range a.tracks {
+		if !t.collapsed {
+			count++
+		}
+	}
+
+	offset, between := LayoutUnit(0), LayoutUnit(0)
+	if count > 0 {
+		offset, between = distributeSpace(gridContentAlignment(mode), available-a.total(), count)
+	}
+
+	position := offset
+	for i := range a.tracks {
+		t := &a.tracks[i]
+		t.position = position
+		if !t.collapsed {
+			position += t.base + a.gap + between
+		}
+	}
+}
+
+// gridContentAlignment turns the justify-content and align-content keywords that name a side
+// into the flex-start and flex-end distributeSpace takes. Grids don't reverse, so start is
+// always the top or the left.
+func gridContentAlignment(mode string) string {
+	switch mode {
+	case "start", "left", "flex-start":
+		return "flex-start"
+	case "end", "right", "flex-end":
+		return "flex-end"
+	}
+	return mode
+}
+
+// extent returns where a run of tracks starts and how long it is, as the X and Width of a
+// Rectangle
+func (a *gridAxis) extent(start, span int) Rectangle {
+	first, last := a.tracks[start], a.tracks[start+span-1]
+	return Rectangle{X: first.position, Width: last.position + last.base - first.position}
+}
+
+// width returns how wide an item's content box is in a grid area of a given width. Items
+// without a width of their own stretch to fill it, unless justify-self, or the container's
+// justify-items, says otherwise or a margin is auto, in which case they fit their content.
+func (item *gridItem) width(area Rectangle, justifyItems string) LayoutUnit {
+	box := item.box
+	available := area.Width - item.edges.edgeWidth()
+	if width, ok := box.lengths.resolveLength(box.GetStyledNode().Lookup([]string{"width"}, NewKeyword("auto")), area.Width); ok {
+		return box.clampWidth(width, area.Width)
+	}
+	if item.auto.left || item.auto.right || item.justify(justifyItems) != "stretch" {
+		return box.fitContentWidth(available, area.Width)
+	}
+	return maxUnit(box.clampWidth(available, area.Width), 0)
+}
+
+// justify returns where an item goes across its grid area, given the container's
+// justify-items
+func (item *gridItem) justify(justifyItems string) string {
+	mode := item.box.GetStyledNode().Lookup([]string{"justify-self"}, NewKeyword("auto")).Keyword
+	if mode == "auto" {
+		mode = justifyItems
+	}
+	return selfAlignment(mode)
+}
+
+// selfAlignment reduces a justify-self or align-self value to where an item goes in its grid
+// area: start, end, center or stretch
+func selfAlignment(mode string) string {
+	switch mode {
+	case "normal", "stretch", "legacy":
+		return "stretch"
+	case "end", "self-end", "flex-end", "right":
+		return "end"
+	case "center":
+		return "center"
+	}
+	return "start"
+}
+
+// layout lays out an item in its grid area. Auto margins take up any space the item leaves
+// first, then justify-self and align-self decide where in the area it goes.
+func (item *gridItem) layout(area Rectangle, viewport Rectangle, justifyItems, alignItems string) {
+	box := item.box
+	styledNode := box.GetStyledNode()
+	box.lengths = lengthContext{viewport: viewport, containerHeight: area.Height, definiteHeight: true}
+	item.edges, item.auto = box.boxEdges(area.Width)
+
+	width := item.width(area, justifyItems)
+	x := alignInArea(area.Width-width-item.edges.edgeWidth(), item.justify(justifyItems),
+		&item.edges.Margin.Left, &item.edges.Margin.Right, item.auto.left, item.auto.right)
+
+	alignSelf := styledNode.Lookup([]string{"align-self"}, NewKeyword("auto")).Keyword
+	if alignSelf == "auto" {
+		alignSelf = alignItems
+	}
+	align := selfAlignment(alignSelf)
+
+	// an item stretches to the height of its area unless it has a height or auto margins
+	var height *LayoutUnit
+	content := area.Height - item.edges.edgeHeight()
+	if align == "stretch" && !item.auto.top && !item.auto.bottom && styledNode.Lookup([]string{"height"}, NewKeyword("auto")).IsAuto() {
+		stretched := maxUnit(box.clampHeight(content), 0)
+		height = &stretched
+	} else {
+		content -= box.measure(width, item.edges).height
+		if align == "stretch" {
+			align = "start"
+		}
+	}
+	if height != nil {
+		content -= *height
+	}
+	y := alignInArea(content, align, &item.edges.Margin.Top, &item.edges.Margin.Bottom, item.auto.top, item.auto.bottom)
+
+	box.layoutAt(area.X+x, area.Y+y, width, height, item.edges)
+}
+
+// alignInArea returns how far into its area an item goes along one axis, given the free space it
+// leaves there. Auto margins take up the space if there are any.
+func alignInArea(free LayoutUnit, align string, start, end *LayoutUnit, startAuto, endAuto bool) LayoutUnit {
+	if startAuto || endAuto {
+		shareAutoMargins(free, start, end, startAuto, endAuto)
+		return 0
+	}
+	switch align {
+	case "end":
+		return free
+	case "center":
+		return free / 2
+	}
+	return 0
+}
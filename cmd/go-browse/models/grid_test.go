@@ -0,0 +1,352 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func px(n float64) Value {
+	return NewLength(n, Px)
+}
+
+func fr(n float64) Value {
+	return NewLength(n, Fr)
+}
+
+func spaced(values ...Value) Value {
+	return NewList(SpaceSeparated, values)
+}
+
+func repeat(count Value, tracks ...Value) Value {
+	return NewFunction("repeat", []Value{count, spaced(tracks...)})
+}
+
+// autoItem is a grid item left to auto-placement along both axes
+func autoItem(rowSpan, columnSpan int) *gridItem {
+	return &gridItem{row: -1, column: -1, rowSpan: rowSpan, columnSpan: columnSpan}
+}
+
+// TestPlaceItems checks that sparse auto-placement only moves forward through the grid, while
+// dense packing goes back to fill the holes earlier items left
+func TestPlaceItems(t *testing.T) {
+	type cell struct{ row, column int }
+	tests := []struct {
+		name          string
+		flow          Value
+		rows, columns int // the size of the explicit grid
+		items         []*gridItem
+		cells         []cell
+		wantRows      int
+		wantColumns   int
+	}{
+		{
+			name:        "sparse",
+			flow:        NewKeyword("row"),
+			columns:     4,
+			items:       []*gridItem{autoItem(1, 1), autoItem(1, 4), autoItem(1, 1), autoItem(1, 1)},
+			cells:       []cell{{0, 0}, {1, 0}, {2, 0}, {2, 1}},
+			wantRows:    3,
+			wantColumns: 4,
+		},
+		{
+			name:        "dense",
+			flow:        spaced(NewKeyword("row"), NewKeyword("dense")),
+			columns:     4,
+			items:       []*gridItem{autoItem(1, 1), autoItem(1, 4), autoItem(1, 1), autoItem(1, 1)},
+			cells:       []cell{{0, 0}, {1, 0}, {0, 1}, {0, 2}},
+			wantRows:    2,
+			wantColumns: 4,
+		},
+		{
+			name:        "sparse by column",
+			flow:        NewKeyword("column"),
+			rows:        2,
+			items:       []*gridItem{autoItem(1, 1), autoItem(2, 1), autoItem(1, 1)},
+			cells:       []cell{{0, 0}, {0, 1}, {0, 2}},
+			wantRows:    2,
+			wantColumns: 3,
+		},
+		{
+			name:        "dense by column",
+			flow:        spaced(NewKeyword("column"), NewKeyword("dense")),
+			rows:        2,
+			items:       []*gridItem{autoItem(1, 1), autoItem(2, 1), autoItem(1, 1)},
+			cells:       []cell{{0, 0}, {0, 1}, {1, 0}},
+			wantRows:    2,
+			wantColumns: 2,
+		},
+		{
+			name:    "around a placed item",
+			flow:    NewKeyword("row"),
+			columns: 3,
+			items: []*gridItem{
+				autoItem(1, 1),
+				{row: 0, column: 1, rowSpan: 1, columnSpan: 2},
+				autoItem(1, 1),
+			},
+			cells:       []cell{{0, 0}, {0, 1}, {1, 0}},
+			wantRows:    2,
+			wantColumns: 3,
+		},
+		{
+			name:    "locked to a row",
+			flow:    NewKeyword("row"),
+			columns: 2,
+			items: []*gridItem{
+				{row: 1, column: 0, rowSpan: 1, columnSpan: 1},
+				{row: 1, column: -1, rowSpan: 1, columnSpan: 1},
+				autoItem(1, 1),
+			},
+			cells:       []cell{{1, 0}, {1, 1}, {0, 0}},
+			wantRows:    2,
+			wantColumns: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rows, columns := placeItems(test.items, test.rows, test.columns, test.flow)
+			if rows != test.wantRows || columns != test.wantColumns {
+				t.Errorf("grid is %d rows by %d columns, want %d by %d", rows, columns, test.wantRows, test.wantColumns)
+			}
+			for i, item := range test.items {
+				if got := (cell{item.row, item.column}); got != test.cells[i] {
+					t.Errorf("item %d is at %v, want %v", i, got, test.cells[i])
+				}
+			}
+		})
+	}
+}
+
+// TestRepeatTracks checks how many tracks an auto-fill or auto-fit repeat() turns into
+func TestRepeatTracks(t *testing.T) {
+	autoFill, autoFit := NewKeyword("auto-fill"), NewKeyword("auto-fit")
+	tests := []struct {
+		name      string
+		template  Value
+		available float64
+		definite  bool
+		gap       float64
+		tracks    int
+	}{
+		{"fills the space", repeat(autoFill, px(100)), 450, true, 0, 4},
+		{"gaps between repetitions", repeat(autoFill, px(100)), 450, true, 10, 4},
+		{"gaps leave room for one fewer", repeat(autoFill, px(100)), 420, true, 10, 3},
+		{"exact fit", repeat(autoFill, px(100)), 400, true, 0, 4},
+		{"fixed tracks take their share", spaced(px(50), repeat(autoFill, px(100))), 400, true, 0, 4},
+		{"several tracks repeated", repeat(autoFill, px(50), px(100)), 400, true, 0, 4},
+		{"minimum of minmax()", repeat(autoFill, NewFunction("minmax", []Value{px(120), fr(1)})), 400, true, 0, 3},
+		{"percentages", repeat(autoFill, NewPercentage(25)), 400, true, 0, 4},
+		{"auto-fit repeats like auto-fill", repeat(autoFit, px(100)), 450, true, 10, 4},
+		{"at least once", repeat(autoFill, px(100)), 50, true, 0, 1},
+		{"once in indefinite space", repeat(autoFill, px(100)), 450, false, 0, 1},
+		{"fixed count", repeat(NewNumber(3), px(100)), 1000, true, 0, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			axis := gridAxis{gap: FromPixels(test.gap)}
+			list := axis.repeatTracks(test.template, FromPixels(test.available), test.definite)
+			if len(list.tracks) != test.tracks {
+				t.Errorf("repeated into %d tracks, want %d", len(list.tracks), test.tracks)
+			}
+		})
+	}
+}
+
+// TestCollapseEmptyTracks checks that only the auto-fit tracks no item is in collapse, and
+// that collapsed tracks don't have gaps around them
+func TestCollapseEmptyTracks(t *testing.T) {
+	axis := gridAxis{gap: FromPixels(10)}
+	list := axis.repeatTracks(spaced(repeat(NewKeyword("auto-fit"), px(100)), px(50)), FromPixels(450), true)
+	axis.tracks = make([]sizedTrack, len(list.tracks)+1)
+
+	axis.collapseEmptyTracks(list, []trackSpan{{start: 0, span: 1}})
+
+	collapsed := make([]bool, len(axis.tracks))
+	for i, track := range axis.tracks {
+		collapsed[i] = track.collapsed
+	}
+	// three repetitions fit beside the 50px track, then there is an implicit track
+	want := []bool{false, true, true, false, false}
+	if !reflect.DeepEqual(collapsed, want) {
+		t.Errorf("collapsed tracks are %v, want %v", collapsed, want)
+	}
+	if gaps := axis.gaps(); gaps != FromPixels(20) {
+		t.Errorf("gaps take up %v, want 20", gaps)
+	}
+}
+
+// TestResolveLine checks line numbers counted from either end, and line names
+func TestResolveLine(t *testing.T) {
+	names := func(names ...string) Value {
+		return NewLineNames(names)
+	}
+	list, _ := parseTrackList(spaced(names("a"), px(50), names("b"), px(50), names("c", "b"), px(50), names("d")), 0)
+	axis := gridAxis{}
+	axis.nameLines(list, len(list.tracks))
+	axis.addName("main-start", 1)
+	axis.addName("main-end", 3)
+
+	tests := []struct {
+		name  string
+		line  gridLine
+		side  string
+		want  int
+		found bool
+	}{
+		{"first line", gridLine{number: 1}, "start", 0, true},
+		{"third line", gridLine{number: 3}, "start", 2, true},
+		{"last line", gridLine{number: -1}, "end", 3, true},
+		{"first line from the end", gridLine{number: -4}, "start", 0, true},
+		{"before the first line", gridLine{number: -10}, "start", 0, true},
+		{"auto", gridLine{}, "start", 0, false},
+		{"name", gridLine{name: "a"}, "start", 0, true},
+		{"first of a repeated name", gridLine{name: "b"}, "start", 1, true},
+		{"second of a repeated name", gridLine{name: "b", number: 2}, "start", 2, true},
+		{"last of a repeated name", gridLine{name: "b", number: -1}, "start", 2, true},
+		{"name counted from the end", gridLine{name: "b", number: -2}, "start", 1, true},
+		{"not enough lines with a name", gridLine{name: "b", number: 3}, "start", 0, false},
+		{"unknown name", gridLine{name: "x"}, "start", 0, false},
+		{"area start", gridLine{name: "main"}, "start", 1, true},
+		{"area end", gridLine{name: "main"}, "end", 3, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			line, found := axis.resolveLine(test.line, test.side)
+			if line != test.want || found != test.found {
+				t.Errorf("resolveLine(%+v, %s) = %d, %v, want %d, %v", test.line, test.side, line, found, test.want, test.found)
+			}
+		})
+	}
+}
+
+// TestPlacement checks where grid-column-start and grid-column-end put an item
+func TestPlacement(t *testing.T) {
+	list, _ := parseTrackList(spaced(NewLineNames([]string{"a"}), px(50), NewLineNames([]string{"b"}), px(50),
+		NewLineNames([]string{"c"}), px(50), NewLineNames([]string{"d"})), 0)
+	axis := gridAxis{}
+	axis.nameLines(list, len(list.tracks))
+
+	span := func(n float64) Value {
+		return spaced(NewKeyword("span"), NewNumber(n))
+	}
+	auto := NewKeyword("auto")
+	tests := []struct {
+		name        string
+		start, end  Value
+		first, span int
+	}{
+		{"names", NewKeyword("b"), NewKeyword("d"), 1, 2},
+		{"numbers", NewNumber(1), NewNumber(-1), 0, 3},
+		{"reversed", NewNumber(3), NewNumber(1), 0, 2},
+		{"same line", NewNumber(2), NewNumber(2), 1, 1},
+		{"span to an end", span(2), NewKeyword("c"), 0, 2},
+		{"span past the start", span(3), NewNumber(2), 0, 1},
+		{"span from a start", NewNumber(2), span(2), 1, 2},
+		{"auto", auto, auto, -1, 1},
+		{"auto span", span(3), auto, -1, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			box := NewLayoutBox(BlockNode, &StyledNode{SpecifiedValues: PropertyMap{
+				"grid-column-start": test.start,
+				"grid-column-end":   test.end,
+			}})
+			first, span := axis.placement(&box, "grid-column-start", "grid-column-end")
+			if first != test.first || span != test.span {
+				t.Errorf("placed at %d spanning %d, want %d spanning %d", first, span, test.first, test.span)
+			}
+		})
+	}
+}
+
+// TestFindFrSize checks how big an fr comes out, including when a track's share is smaller
+// than its base size and it is frozen at that size
+func TestFindFrSize(t *testing.T) {
+	track := func(factor, base float64) *sizedTrack {
+		return &sizedTrack{gridTrack: gridTrack{min: NewKeyword("auto"), max: fr(factor)}, base: FromPixels(base)}
+	}
+	tests := []struct {
+		name   string
+		tracks []*sizedTrack
+		space  float64
+		want   float64
+	}{
+		{"equal shares", []*sizedTrack{track(1, 0), track(1, 0)}, 200, 100},
+		{"by factor", []*sizedTrack{track(1, 0), track(2, 0)}, 300, 100},
+		{"base sizes that fit", []*sizedTrack{track(1, 50), track(1, 0)}, 200, 100},
+		{"frozen track", []*sizedTrack{track(1, 150), track(1, 0)}, 200, 50},
+		{"frozen track with a factor", []*sizedTrack{track(1, 150), track(1, 0), track(2, 0)}, 300, 50},
+		{"frozen in turn", []*sizedTrack{track(1, 120), track(1, 90), track(1, 0)}, 240, 30},
+		{"no space left", []*sizedTrack{track(1, 150), track(1, 0)}, 100, 0},
+		{"factors below one", []*sizedTrack{track(0.5, 0)}, 200, 200},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := LayoutUnit(findFrSize(test.tracks, FromPixels(test.space)))
+			if got != FromPixels(test.want) {
+				t.Errorf("an fr is %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// TestGridLimits checks that line numbers, spans and repeat() counts too big to hold in
+// memory are clamped to maxGridTracks
+func TestGridLimits(t *testing.T) {
+	huge := 100000000.0
+	if line := parseGridLine(NewNumber(huge)); line.number != maxGridTracks {
+		t.Errorf("line %v is read as %d, want %d", huge, line.number, maxGridTracks)
+	}
+	if line := parseGridLine(NewNumber(-huge)); line.number != -maxGridTracks {
+		t.Errorf("line %v is read as %d, want %d", -huge, line.number, -maxGridTracks)
+	}
+	if line := parseGridLine(spaced(NewKeyword("span"), NewNumber(huge))); line.span != maxGridTracks {
+		t.Errorf("span %v is read as %d, want %d", huge, line.span, maxGridTracks)
+	}
+
+	for _, template := range []Value{
+		repeat(NewNumber(huge), px(1)),
+		repeat(NewNumber(huge), px(1), px(2)),
+		spaced(px(1), repeat(NewNumber(maxGridTracks), px(1))),
+	} {
+		if list, _ := parseTrackList(template, 0); len(list.tracks) != maxGridTracks || len(list.lines) != maxGridTracks+1 {
+			t.Errorf("%v has %d tracks and %d lines, want %d and %d", template, len(list.tracks), len(list.lines), maxGridTracks, maxGridTracks+1)
+		}
+	}
+	axis := gridAxis{}
+	if list := axis.repeatTracks(repeat(NewKeyword("auto-fill"), px(1)), FromPixels(huge), true); len(list.tracks) != maxGridTracks {
+		t.Errorf("auto-fill repeated into %d tracks, want %d", len(list.tracks), maxGridTracks)
+	}
+
+	// a whole grid built from page styles like these stays within the limit along both axes
+	child := NewLayoutBox(BlockNode, &StyledNode{SpecifiedValues: PropertyMap{
+		"grid-column-start": NewNumber(1),
+		"grid-column-end":   NewNumber(huge),
+		"grid-row-start":    spaced(NewKeyword("span"), NewNumber(huge)),
+	}})
+	container := NewLayoutBox(GridNode, &StyledNode{SpecifiedValues: PropertyMap{
+		"grid-template-rows": repeat(NewNumber(huge), px(1)),
+	}})
+	container.Children = []*LayoutBox{&child, autoBox(), autoBox()}
+	g := container.buildGrid(FromPixels(100), lengthContext{})
+	// the child reaches line maxGridTracks, the last one a number can name
+	if len(g.columns.tracks) != maxGridTracks-1 || len(g.rows.tracks) != maxGridTracks {
+		t.Errorf("grid has %d columns and %d rows, want %d and %d", len(g.columns.tracks), len(g.rows.tracks), maxGridTracks-1, maxGridTracks)
+	}
+	for i, item := range g.items {
+		if item.column+item.columnSpan > maxGridTracks || item.row+item.rowSpan > maxGridTracks {
+			t.Errorf("item %d at row %d column %d spanning %d by %d is past the last track", i, item.row, item.column, item.rowSpan, item.columnSpan)
+		}
+	}
+}
+
+// autoBox is a box with no grid placement of its own
+func autoBox() *LayoutBox {
+	box := NewLayoutBox(BlockNode, &StyledNode{SpecifiedValues: PropertyMap{}})
+	return &box
+}
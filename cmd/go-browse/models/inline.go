@@ -0,0 +1,569 @@
+package models
+
+import (
+	"strings"
+
+	"github.com/bern/go-browse/cmd/go-browse/fonts"
+)
+
+// LineBox is a single line of an inline formatting context
+type LineBox struct {
+	Rect     Rectangle
+	Baseline LayoutUnit // y coordinate the line's text sits on
+}
+
+// InlineFragment is the part of an inline box that falls on a single line. An inline box
+// split across lines only has its left edges on its first fragment and its right edges
+// on its last.
+type InlineFragment struct {
+	Dimensions Dimensions
+	Baseline   LayoutUnit // y coordinate of the baseline of the line the fragment is on
+	Text       string     // the text on this line, for text boxes
+	Line       int        // index of the line box in the containing anonymous block
+}
+
+// inlineItemType informs us of what an inlineItem contributes to a line
+type inlineItemType int
+
+const (
+	// wordItem is a run of text that can't be broken
+	wordItem inlineItemType = iota
+	// spaceItem is white space between words
+	spaceItem
+	// openItem is the start of an inline element, carrying its left margin, border and padding
+	openItem
+	// closeItem is the end of an inline element, carrying its right margin, border and padding
+	closeItem
+	// breakItem forces a line break, from a <br> or a preserved newline
+	breakItem
+	// atomicItem is an inline-level box laid out as a whole, like an inline flex or grid container
+	atomicItem
+)
+
+// inlineItem is a single piece of inline content, in the order it is laid out
+type inlineItem struct {
+	itemType    inlineItemType
+	box         *LayoutBox
+	text        string
+	width       LayoutUnit
+	collapsible bool // collapsible spaces are removed at the start and end of a line
+	breakable   bool // the line may be broken at this space
+}
+
+// whiteSpace describes how a value of the white-space property treats spaces and newlines
+type whiteSpace struct {
+	collapse bool // runs of spaces and tabs become a single space
+	newlines bool // newlines force line breaks instead of acting as spaces
+	wrap     bool // lines wrap at spaces
+}
+
+var whiteSpaceModes = map[string]whiteSpace{
+	"normal":   {collapse: true, wrap: true},
+	"nowrap":   {collapse: true},
+	"pre":      {newlines: true},
+	"pre-wrap": {newlines: true, wrap: true},
+	"pre-line": {collapse: true, newlines: true, wrap: true},
+}
+
+// LayoutInlineChildren lays out the inline children of an anonymous block into line boxes
+// that fit its width, then sets its height to the height of its lines
+func (lb *LayoutBox) LayoutInlineChildren() {
+	items := make([]inlineItem, 0)
+	for _, child := range lb.Children {
+		clearFragments(child)
+		lb.collectInlineItems(child, &items)
+	}
+	for i, item := range items {
+		if item.itemType == atomicItem {
+			items[i] = lb.measureAtomic(item.box)
+		}
+	}
+
+	d := &lb.Dimensions
+	lb.Lines = make([]LineBox, 0)
+
+	open := make([]*LayoutBox, 0)
+	y := d.Content.Y
+	for _, line := range breakLines(items, d.Content.Width) {
+		lineBox := lb.placeLine(line, open, y)
+		open = openBoxesAfter(line, open)
+
+		lb.Lines = append(lb.Lines, lineBox)
+		y += lineBox.Rect.Height
+	}
+
+	d.Content.Height = y - d.Content.Y
+	for _, child := range lb.Children {
+		child.fitFragments()
+	}
+}
+
+// collectInlineItems flattens an inline box and its descendants into a sequence of items.
+// Atomic boxes are left for the caller to measure.
+func (lb *LayoutBox) collectInlineItems(box *LayoutBox, items *[]inlineItem) {
+	node := box.GetStyledNode()
+
+	if box.atomic() {
+		*items = append(*items, inlineItem{itemType: atomicItem, box: box})
+		return
+	}
+
+	if node.Node.Text != nil {
+		collectTextItems(box, *node.Node.Text, items)
+		return
+	}
+
+	if node.Node.Element != nil && node.Node.Element.TagName == "br" {
+		*items = append(*items, inlineItem{itemType: breakItem, box: box})
+		return
+	}
+
+	edges := lb.inlineEdges(node)
+	*items = append(*items, inlineItem{
+		itemType: openItem,
+		box:      box,
+		width:    edges.Margin.Left + edges.Border.Left + edges.Padding.Left,
+	})
+
+	for _, child := range box.Children {
+		// block-level boxes inside inline elements aren't supported
+		if child.BoxType == InlineNode || child.atomic() {
+			lb.collectInlineItems(child, items)
+		}
+	}
+
+	*items = append(*items, inlineItem{
+		itemType: closeItem,
+		box:      box,
+		width:    edges.Margin.Right + edges.Border.Right + edges.Padding.Right,
+	})
+}
+
+// clearFragments forgets where an inline box and its descendants were placed, before they are
+// placed on lines again
+func clearFragments(box *LayoutBox) {
+	box.Fragments = make([]InlineFragment, 0)
+	if box.atomic() {
+		return
+	}
+	for _, child := range box.Children {
+		if child.BoxType == InlineNode || child.atomic() {
+			clearFragments(child)
+		}
+	}
+}
+
+// atomic returns true for an inline-level box that is laid out as a whole, like an inline flex
+// or grid container
+func (lb *LayoutBox) atomic() bool {
+	if lb.BoxType != FlexNode && lb.BoxType != GridNode {
+		return false
+	}
+	display := lb.Node.Display()
+	return display == InlineFlex || display == InlineGrid
+}
+
+// measureAtomic lays out an atomic inline-level box so it can be placed on a line like a
+// single word. Unless it has a width of its own, it is as wide as its content, as long as
+// that fits on a line.
+func (lb *LayoutBox) measureAtomic(box *LayoutBox) inlineItem {
+	base := lb.Dimensions.Content.Width
+	box.lengths = lb.childLengths()
+
+	edges, _ := box.boxEdges(base)
+	width := box.fitContentWidth(base-edges.edgeWidth(), base)
+	box.layoutAt(0, 0, width, nil, edges)
+
+	return inlineItem{itemType: atomicItem, box: box, width: box.Dimensions.MarginBox().Width}
+}
+
+// collectTextItems splits the text of a text box into words, spaces and forced breaks
+// according to its white-space property
+func collectTextItems(box *LayoutBox, text string, items *[]inlineItem) {
+	node := box.GetStyledNode()
+	metrics := fontMetricsFor(node)
+
+	mode, ok := whiteSpaceModes[node.Lookup([]string{"white-space"}, NewKeyword("normal")).Keyword]
+	if !ok {
+		mode = whiteSpaceModes["normal"]
+	}
+
+	text = strings.ReplaceAll(text, "\t", " ")
+	if !mode.newlines {
+		text = strings.ReplaceAll(text, "\n", " ")
+	}
+
+	for i, segment := range strings.Split(text, "\n") {
+		if i > 0 {
+			*items = append(*items, inlineItem{itemType: breakItem, box: box})
+		}
+
+		for len(segment) > 0 {
+			end := strings.IndexByte(segment, ' ')
+			if end == 0 {
+				end = len(segment) - len(strings.TrimLeft(segment, " "))
+				spaces := segment[:end]
+				if mode.collapse {
+					spaces = " "
+				}
+				*items = append(*items, inlineItem{
+					itemType:    spaceItem,
+					box:         box,
+					text:        spaces,
+					width:       metrics.advance(spaces),
+					collapsible: mode.collapse,
+					breakable:   mode.wrap,
+				})
+				segment = segment[end:]
+				continue
+			}
+
+			if end < 0 {
+				end = len(segment)
+			}
+			*items = append(*items, inlineItem{
+				itemType: wordItem,
+				box:      box,
+				text:     segment[:end],
+				width:    metrics.advance(segment[:end]),
+			})
+			segment = segment[end:]
+		}
+	}
+}
+
+// breakLines packs items into lines no wider than width, breaking at the last opportunity
+// before the item that overflows. Collapsible spaces at the edges of a line are removed.
+func breakLines(items []inlineItem, width LayoutUnit) [][]inlineItem {
+	lines := make([][]inlineItem, 0)
+	line := make([]inlineItem, 0)
+	lineWidth := LayoutUnit(0)
+	lastBreak := -1
+	previousSpace := true
+
+	for _, item := range items {
+		switch item.itemType {
+		case breakItem:
+			lines = append(lines, trimLine(append(line, item)))
+			line = make([]inlineItem, 0)
+			lineWidth = LayoutUnit(0)
+			lastBreak = -1
+			previousSpace = true
+			continue
+		case spaceItem:
+			if item.collapsible && previousSpace {
+				continue
+			}
+			if item.breakable {
+				lastBreak = len(line)
+			}
+			previousSpace = item.collapsible
+		case wordItem, atomicItem:
+			if lineWidth+item.width > width && lastBreak >= 0 {
+				rest := append(make([]inlineItem, 0), line[lastBreak+1:]...)
+				lines = append(lines, trimLine(line[:lastBreak]))
+
+				line = rest
+				lineWidth = LayoutUnit(0)
+				for _, carried := range rest {
+					lineWidth += carried.width
+				}
+				lastBreak = -1
+			}
+			previousSpace = false
+		}
+
+		line = append(line, item)
+		lineWidth += item.width
+	}
+
+	if hasInlineContent(line) {
+		lines = append(lines, trimLine(line))
+	}
+	return lines
+}
+
+// trimLine removes the collapsible spaces after the last word of a line
+func trimLine(line []inlineItem) []inlineItem {
+	trimmed := make([]inlineItem, 0, len(line))
+	for i, item := range line {
+		if item.itemType == spaceItem && item.collapsible && !hasInlineContent(line[i+1:]) {
+			continue
+		}
+		trimmed = append(trimmed, item)
+	}
+	return trimmed
+}
+
+// hasInlineContent returns true if a line holds anything besides collapsible spaces
+func hasInlineContent(line []inlineItem) bool {
+	for _, item := range line {
+		switch item.itemType {
+		case wordItem, breakItem, atomicItem:
+			return true
+		case spaceItem:
+			if !item.collapsible {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// openBoxesAfter returns the inline elements still open at the end of a line, given those
+// open at its start
+func openBoxesAfter(line []inlineItem, open []*LayoutBox) []*LayoutBox {
+	after := append(make([]*LayoutBox, 0), open...)
+	for _, item := range line {
+		switch item.itemType {
+		case openItem:
+			after = append(after, item.box)
+		case closeItem:
+			after = after[:len(after)-1]
+		}
+	}
+	return after
+}
+
+// placeLine positions the items of a line, creating a fragment for every box on it. Boxes
+// are aligned on a common baseline, with line-height adding half-leading above and below them.
+func (lb *LayoutBox) placeLine(line []inlineItem, open []*LayoutBox, top LayoutUnit) LineBox {
+	lineIndex := len(lb.Lines)
+	fragments := make(map[*LayoutBox]*InlineFragment)
+	order := make([]*LayoutBox, 0)
+
+	fragmentFor := func(box *LayoutBox, x LayoutUnit) *InlineFragment {
+		if fragment, ok := fragments[box]; ok {
+			return fragment
+		}
+		fragment := &InlineFragment{Line: lineIndex}
+		fragment.Dimensions.Content.X = x
+		fragments[box] = fragment
+		order = append(order, box)
+		return fragment
+	}
+
+	// the line's strut comes from the anonymous block's inherited font
+	ascent, descent := lb.inlineExtents(lb.GetStyledNode())
+
+	x := lb.Dimensions.Content.X
+	for _, box := range open {
+		fragmentFor(box, x)
+	}
+
+	// atomic boxes are placed once the baseline is known, at the x coordinate they start at
+	atomics := make(map[*LayoutBox]LayoutUnit)
+
+	for _, item := range line {
+		if item.itemType == atomicItem {
+			// an atomic box sits on the line by its own first baseline
+			above := item.box.baselineOffset()
+			ascent = maxUnit(ascent, above)
+			descent = maxUnit(descent, item.box.Dimensions.MarginBox().Height-above)
+			atomics[item.box] = x
+			x += item.width
+			continue
+		}
+
+		boxAscent, boxDescent := lb.inlineExtents(item.box.GetStyledNode())
+		ascent = maxUnit(ascent, boxAscent)
+		descent = maxUnit(descent, boxDescent)
+
+		switch item.itemType {
+		case openItem:
+			edges := lb.inlineEdges(item.box.GetStyledNode())
+			fragment := fragmentFor(item.box, x+item.width)
+			fragment.Dimensions.Margin.Left = edges.Margin.Left
+			fragment.Dimensions.Border.Left = edges.Border.Left
+			fragment.Dimensions.Padding.Left = edges.Padding.Left
+		case closeItem:
+			edges := lb.inlineEdges(item.box.GetStyledNode())
+			fragment := fragmentFor(item.box, x)
+			fragment.Dimensions.Content.Width = x - fragment.Dimensions.Content.X
+			fragment.Dimensions.Margin.Right = edges.Margin.Right
+			fragment.Dimensions.Border.Right = edges.Border.Right
+			fragment.Dimensions.Padding.Right = edges.Padding.Right
+		case wordItem, spaceItem:
+			fragment := fragmentFor(item.box, x)
+			fragment.Text += item.text
+			fragment.Dimensions.Content.Width += item.width
+		}
+		x += item.width
+	}
+
+	// boxes that continue on the next line end at the edge of this one
+	for _, box := range openBoxesAfter(line, open) {
+		fragment := fragments[box]
+		fragment.Dimensions.Content.Width = x - fragment.Dimensions.Content.X
+	}
+
+	offset := alignmentOffset(lb.GetStyledNode(), lb.Dimensions.Content.Width-(x-lb.Dimensions.Content.X))
+	baseline := top + ascent
+
+	for _, box := range order {
+		fragment := fragments[box]
+		node := box.GetStyledNode()
+		metrics := fontMetricsFor(node)
+
+		fragment.Baseline = baseline
+		fragment.Dimensions.Content.X += offset
+		fragment.Dimensions.Content.Y = baseline - metrics.ascent()
+		fragment.Dimensions.Content.Height = metrics.ascent() + metrics.descent()
+
+		// vertical edges don't affect the height of the line, but they are painted
+		edges := lb.inlineEdges(node)
+		fragment.Dimensions.Border.Top = edges.Border.Top
+		fragment.Dimensions.Border.Bottom = edges.Border.Bottom
+		fragment.Dimensions.Padding.Top = edges.Padding.Top
+		fragment.Dimensions.Padding.Bottom = edges.Padding.Bottom
+
+		box.Fragments = append(box.Fragments, *fragment)
+	}
+
+	for box, x := range atomics {
+		d := box.Dimensions
+		box.layoutAt(x+offset, baseline-box.baselineOffset(), d.Content.Width, nil, d)
+	}
+
+	return LineBox{
+		Rect: Rectangle{
+			X:      lb.Dimensions.Content.X,
+			Y:      top,
+			Width:  lb.Dimensions.Content.Width,
+			Height: ascent + descent,
+		},
+		Baseline: baseline,
+	}
+}
+
+// fitFragments sets the dimensions of an inline box and its descendants to the rectangle
+// enclosing their fragments
+func (lb *LayoutBox) fitFragments() {
+	// atomic boxes are laid out as a whole, so they keep their own dimensions
+	if lb.atomic() {
+		return
+	}
+
+	for _, child := range lb.Children {
+		child.fitFragments()
+	}
+
+	if len(lb.Fragments) == 0 {
+		lb.Dimensions = Dimensions{}
+		return
+	}
+
+	first := lb.Fragments[0].Dimensions
+	last := lb.Fragments[len(lb.Fragments)-1].Dimensions
+
+	left, top := first.Content.X, first.Content.Y
+	right, bottom := left, top
+	for _, fragment := range lb.Fragments {
+		content := fragment.Dimensions.Content
+		left = minUnit(left, content.X)
+		top = minUnit(top, content.Y)
+		right = maxUnit(right, content.X+content.Width)
+		bottom = maxUnit(bottom, content.Y+content.Height)
+	}
+
+	lb.Dimensions = Dimensions{
+		Content: Rectangle{X: left, Y: top, Width: right - left, Height: bottom - top},
+		Padding: EdgeSizes{Left: first.Padding.Left, Right: last.Padding.Right, Top: first.Padding.Top, Bottom: first.Padding.Bottom},
+		Border:  EdgeSizes{Left: first.Border.Left, Right: last.Border.Right, Top: first.Border.Top, Bottom: first.Border.Bottom},
+		Margin:  EdgeSizes{Left: first.Margin.Left, Right: last.Margin.Right},
+	}
+}
+
+// inlineEdges returns the margins, borders and padding of an inline element in this anonymous
+// block, whose width percentages are relative to
+func (lb *LayoutBox) inlineEdges(node StyledNode) Dimensions {
+	zero := NewLength(0, Px)
+	base := lb.Dimensions.Content.Width
+	return Dimensions{
+		Margin: EdgeSizes{
+			Left:  lb.length(node.Lookup([]string{"margin-left"}, zero), base),
+			Right: lb.length(node.Lookup([]string{"margin-right"}, zero), base),
+		},
+		Border: EdgeSizes{
+			Left:   lb.length(node.Lookup([]string{"border-left-width"}, zero), base),
+			Right:  lb.length(node.Lookup([]string{"border-right-width"}, zero), base),
+			Top:    lb.length(node.Lookup([]string{"border-top-width"}, zero), base),
+			Bottom: lb.length(node.Lookup([]string{"border-bottom-width"}, zero), base),
+		},
+		Padding: EdgeSizes{
+			Left:   lb.length(node.Lookup([]string{"padding-left"}, zero), base),
+			Right:  lb.length(node.Lookup([]string{"padding-right"}, zero), base),
+			Top:    lb.length(node.Lookup([]string{"padding-top"}, zero), base),
+			Bottom: lb.length(node.Lookup([]string{"padding-bottom"}, zero), base),
+		},
+	}
+}
+
+// inlineExtents returns how far a box reaches above and below the baseline once its
+// line-height is split evenly into half-leading above and below its font
+func (lb *LayoutBox) inlineExtents(node StyledNode) (LayoutUnit, LayoutUnit) {
+	metrics := fontMetricsFor(node)
+	leading := lb.lineHeight(node, metrics) - (metrics.ascent() + metrics.descent())
+
+	above := leading / 2
+	return metrics.ascent() + above, metrics.descent() + leading - above
+}
+
+// lineHeight resolves the line-height property of a node to pixels. Lengths and percentages
+// are usually computed along with the font size, leaving only numbers to scale with it here.
+func (lb *LayoutBox) lineHeight(node StyledNode, metrics fontMetrics) LayoutUnit {
+	value := node.Lookup([]string{"line-height"}, NewKeyword("normal"))
+
+	switch value.ValueType {
+	case NumberValue:
+		return FromPixels(value.Number * metrics.size())
+	case PercentageValue:
+		return FromPixels(value.Number * metrics.size() / 100)
+	case LengthValue, CalcValue:
+		return lb.length(value, FromPixels(metrics.size()))
+	}
+
+	// normal
+	return FromPixels(metrics.size() * 1.2)
+}
+
+// alignmentOffset returns how far a line's content moves right to satisfy text-align,
+// given the space left over on the line
+func alignmentOffset(node StyledNode, free LayoutUnit) LayoutUnit {
+	if free <= 0 {
+		return 0
+	}
+
+	switch node.Lookup([]string{"text-align"}, NewKeyword("start")).Keyword {
+	case "right", "end":
+		return free
+	case "center":
+		return free / 2
+	}
+	return 0
+}
+
+// fontMetrics measures text in the face a node is set in
+type fontMetrics struct {
+	face *fonts.Face
+}
+
+func fontMetricsFor(node StyledNode) fontMetrics {
+	return fontMetrics{face: FontFor(node)}
+}
+
+func (f fontMetrics) size() float64 {
+	return f.face.Size
+}
+
+func (f fontMetrics) advance(text string) LayoutUnit {
+	return FromPixels(f.face.Advance(text))
+}
+
+func (f fontMetrics) ascent() LayoutUnit {
+	return FromPixels(f.face.Ascent())
+}
+
+func (f fontMetrics) descent() LayoutUnit {
+	return FromPixels(f.face.Descent())
+}
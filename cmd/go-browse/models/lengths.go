@@ -0,0 +1,290 @@
+package models
+
+// absoluteUnits maps the absolute units onto CSS pixels, at 96 pixels to the inch
+var absoluteUnits = map[Unit]float64{
+	Px: 1,
+	Pt: 96.0 / 72,
+	Pc: 16,
+	In: 96,
+	Cm: 96 / 2.54,
+	Mm: 96 / 25.4,
+	Q:  96 / 101.6,
+}
+
+// defaultFontSize is the initial value of font-size in pixels, which rem is relative to on
+// the root element itself
+const defaultFontSize = 16
+
+// fontContext is what the font-relative units of an element are relative to
+type fontContext struct {
+	size     float64 // the computed font-size, for em
+	rootSize float64 // the computed font-size of the root element, for rem
+	font     func() StyledNode
+}
+
+// resolve converts a font-relative or absolute length or a plain number to pixels
+func (c fontContext) resolve(v Value) (float64, bool) {
+	if v.ValueType == NumberValue {
+		return v.Number, true
+	}
+	if v.ValueType != LengthValue {
+		return 0, false
+	}
+
+	if factor, ok := absoluteUnits[v.Unit]; ok {
+		return v.Number * factor, true
+	}
+
+	switch v.Unit {
+	case Em:
+		return v.Number * c.size, true
+	case Rem:
+		return v.Number * c.rootSize, true
+	case Ex:
+		return v.Number * FontFor(c.font()).XHeight(), true
+	case Ch:
+		return v.Number * FontFor(c.font()).Advance("0"), true
+	}
+	return 0, false
+}
+
+// computeLength converts the parts of a length that don't depend on layout to pixels.
+// Percentages and viewport units are left for layout to resolve.
+func (c fontContext) computeLength(v Value) Value {
+	switch v.ValueType {
+	case LengthValue:
+		if px, ok := c.resolve(v); ok {
+			return NewLength(px, Px)
+		}
+	case CalcValue:
+		simplified := v.Calc.Simplify(c.resolve)
+		if simplified.Operator == CalcLeaf {
+			return simplified.Value
+		}
+		return NewCalc(simplified)
+	case ListValue:
+		items := make([]Value, 0, len(v.Values))
+		for _, item := range v.Values {
+			items = append(items, c.computeLength(item))
+		}
+		return NewList(v.Separator, items)
+	case FunctionValue:
+		args := make([]Value, 0, len(v.Values))
+		for _, arg := range v.Values {
+			args = append(args, c.computeLength(arg))
+		}
+		return NewFunction(v.Text, args)
+	}
+	return v
+}
+
+// ComputeValues turns a node's cascaded values into computed values in place: font-size
+// becomes pixels, font-weight a number, lengths in font-relative and absolute units become
+// pixels, and border widths take their style into account. Percentages and viewport units
+// depend on layout, so they are left for it to resolve, apart from percentages of the font
+// size. rootFontSize is the computed font-size of the root element, or zero while the root
+// itself is computed.
+func ComputeValues(values, parent PropertyMap, rootFontSize float64) {
+	parentContext := fontContext{
+		size:     FontSize(parent),
+		rootSize: rootFontSize,
+		font:     func() StyledNode { return StyledNode{SpecifiedValues: parent} },
+	}
+	if rootFontSize == 0 {
+		parentContext.rootSize = defaultFontSize
+	}
+
+	if size, ok := values["font-size"]; ok {
+		values["font-size"] = parentContext.computeFontSize(size)
+	}
+	if weight, ok := values["font-weight"]; ok {
+		values["font-weight"] = computeFontWeight(weight, FontWeight(parent))
+	}
+
+	context := fontContext{
+		size:     FontSize(values),
+		rootSize: rootFontSize,
+		font:     func() StyledNode { return StyledNode{SpecifiedValues: values} },
+	}
+	if rootFontSize == 0 {
+		context.rootSize = context.size
+	}
+
+	for name, value := range values {
+		switch name {
+		case "font-size", "font-weight":
+		case "line-height":
+			// a plain number is inherited as is, so children scale it by their own font size
+			if value.ValueType == PercentageValue {
+				value = NewLength(value.Number*context.size/100, Px)
+			}
+			values[name] = context.computeLength(value)
+		default:
+			values[name] = context.computeLength(value)
+		}
+	}
+
+	computeBorderWidths(values)
+}
+
+// computeFontSize resolves a font-size to pixels, relative to the parent's font
+func (c fontContext) computeFontSize(v Value) Value {
+	switch v.ValueType {
+	case KeywordValue:
+		switch v.Keyword {
+		case "larger":
+			return NewLength(c.size*1.2, Px)
+		case "smaller":
+			return NewLength(c.size/1.2, Px)
+		}
+		if px, ok := absoluteFontSizes[v.Keyword]; ok {
+			return NewLength(px, Px)
+		}
+	case PercentageValue:
+		return NewLength(v.Number*c.size/100, Px)
+	case CalcValue:
+		// percentages in a font size are relative to the parent's font size
+		percentages := func(leaf Value) (float64, bool) {
+			if leaf.ValueType == PercentageValue {
+				return leaf.Number * c.size / 100, true
+			}
+			return c.resolve(leaf)
+		}
+		if px, ok := v.Calc.Evaluate(percentages); ok {
+			return NewLength(px, Px)
+		}
+	}
+	return c.computeLength(v)
+}
+
+// FontSize returns the computed font-size of a set of values in pixels, or the default size
+// if it isn't set or can't be resolved before layout
+func FontSize(values PropertyMap) float64 {
+	if size, ok := values["font-size"]; ok && size.ValueType == LengthValue && size.Unit == Px {
+		return size.Number
+	}
+	return defaultFontSize
+}
+
+// lengthContext is what percentages and viewport units are resolved against during layout
+type lengthContext struct {
+	viewport        Rectangle  // vw, vh, vmin and vmax are relative to this
+	containerHeight LayoutUnit // percentage heights are relative to this, if it is definite
+	definiteHeight  bool       // whether the containing block's height is known before its content is laid out
+}
+
+// resolveLength converts a computed length, percentage or math expression to LayoutUnits,
+// with percentages taken of base. Keywords like auto don't resolve.
+func (c lengthContext) resolveLength(v Value, base LayoutUnit) (LayoutUnit, bool) {
+	leaf := func(v Value) (float64, bool) {
+		switch v.ValueType {
+		case NumberValue:
+			return v.Number, true
+		case PercentageValue:
+			return v.Number * base.Pixels() / 100, true
+		case LengthValue:
+			return c.resolveUnit(v)
+		}
+		return 0, false
+	}
+
+	switch v.ValueType {
+	case LengthValue, PercentageValue:
+		px, ok := leaf(v)
+		return FromPixels(px), ok
+	case NumberValue:
+		// only zero can be written without a unit
+		return 0, v.Number == 0
+	case CalcValue:
+		px, ok := v.Calc.Evaluate(leaf)
+		return FromPixels(px), ok
+	}
+	return 0, false
+}
+
+// resolveUnit converts a length in pixels, viewport units or absolute units to pixels
+func (c lengthContext) resolveUnit(v Value) (float64, bool) {
+	if factor, ok := absoluteUnits[v.Unit]; ok {
+		return v.Number * factor, true
+	}
+
+	width, height := c.viewport.Width.Pixels(), c.viewport.Height.Pixels()
+	switch v.Unit {
+	case Vw:
+		return v.Number * width / 100, true
+	case Vh:
+		return v.Number * height / 100, true
+	case Vmin:
+		if width < height {
+			return v.Number * width / 100, true
+		}
+		return v.Number * height / 100, true
+	case Vmax:
+		if width > height {
+			return v.Number * width / 100, true
+		}
+		return v.Number * height / 100, true
+	}
+
+	// font-relative units are computed before layout
+	return 0, false
+}
+
+// usesPercentage returns true if a value is or contains a percentage
+func usesPercentage(v Value) bool {
+	switch v.ValueType {
+	case PercentageValue:
+		return true
+	case CalcValue:
+		return v.Calc.usesPercentage()
+	}
+	return false
+}
+
+func (c CalcNode) usesPercentage() bool {
+	if c.Operator == CalcLeaf {
+		return c.Value.ValueType == PercentageValue
+	}
+	for _, arg := range c.Args {
+		if arg.usesPercentage() {
+			return true
+		}
+	}
+	return false
+}
+
+// length resolves a length of a box against the current containing block, with percentages
+// taken of base. Lengths that don't resolve, like auto, count as zero.
+func (lb *LayoutBox) length(v Value, base LayoutUnit) LayoutUnit {
+	length, _ := lb.lengths.resolveLength(v, base)
+	return length
+}
+
+// resolveHeight resolves a vertical size like height or min-height. Percentages only resolve
+// if the containing block's height doesn't depend on its content.
+func (lb *LayoutBox) resolveHeight(v Value) (LayoutUnit, bool) {
+	if usesPercentage(v) && !lb.lengths.definiteHeight {
+		return 0, false
+	}
+	return lb.lengths.resolveLength(v, lb.lengths.containerHeight)
+}
+
+// childLengths returns the context the children of a box resolve their lengths in. Their
+// percentage heights only resolve if this box has a height that doesn't depend on them.
+func (lb *LayoutBox) childLengths() lengthContext {
+	context := lengthContext{viewport: lb.lengths.viewport}
+
+	if lb.imposedHeight != nil {
+		context.containerHeight = *lb.imposedHeight
+		context.definiteHeight = true
+		return context
+	}
+
+	styledNode := lb.GetStyledNode()
+	if height, ok := lb.resolveHeight(styledNode.Lookup([]string{"height"}, NewKeyword("auto"))); ok {
+		context.containerHeight = lb.clampHeight(height)
+		context.definiteHeight = true
+	}
+
+	return context
+}
@@ -0,0 +1,129 @@
+package models
+
+// marginStrut collects adjoining vertical margins that collapse into one. The collapsed margin
+// is the largest positive margin plus the most negative one.
+type marginStrut struct {
+	positive LayoutUnit
+	negative LayoutUnit
+}
+
+func (m marginStrut) add(margin LayoutUnit) marginStrut {
+	if margin > m.positive {
+		m.positive = margin
+	}
+	if margin < m.negative {
+		m.negative = margin
+	}
+	return m
+}
+
+func (m marginStrut) value() LayoutUnit {
+	return m.positive + m.negative
+}
+
+// layoutInFlow lays out a block-level box whose top margin starts at y, below the pending
+// margins in strut, following the CSS 2.1 margin collapsing rules: adjacent siblings collapse,
+// a box with no top border or padding collapses with its first child, one with no bottom border
+// or padding and an auto height collapses with its last child, and an empty box collapses
+// through its own top and bottom margins. Boxes that establish a new formatting context keep
+// their children's margins inside. There are no floats, so clearance never separates margins.
+// Returns where the margins below the box start, the margins still pending there, and whether
+// the box collapsed through.
+func (lb *LayoutBox) layoutInFlow(container Dimensions, y LayoutUnit, strut marginStrut, formattingContextRoot bool) (LayoutUnit, marginStrut, bool) {
+	// Calculate the box's width based on the parent
+	lb.CalculateBlockWidth(container)
+
+	// Calculate the box's edges and horizontal position based on the parent
+	lb.CalculateBlockPosition(container)
+
+	d := &lb.Dimensions
+	styledNode := lb.GetStyledNode()
+	independent := formattingContextRoot || lb.EstablishesFormattingContext()
+
+	height, hasHeight := lb.resolveHeight(styledNode.Lookup([]string{"height"}, NewKeyword("auto")))
+	autoHeight := !hasHeight
+	minHeight, _ := lb.resolveHeight(styledNode.Lookup([]string{"min-height"}, NewKeyword("auto")))
+
+	separatedTop := independent || d.Border.Top > 0 || d.Padding.Top > 0
+	collapseBottom := !independent && d.Border.Bottom == 0 && d.Padding.Bottom == 0 && autoHeight
+	canCollapseThrough := !independent && d.Border.Bottom == 0 && d.Padding.Bottom == 0 &&
+		(autoHeight || height == 0) && minHeight == 0
+
+	strut = strut.add(d.Margin.Top)
+	d.Content.Y = y + strut.value() + d.Border.Top + d.Padding.Top
+
+	// children start below our top edge, or share our margins if nothing separates them
+	childY, childStrut := d.Content.Y, marginStrut{}
+	if !separatedTop {
+		childY, childStrut = y, strut
+	}
+
+	// the box is laid out in flow now, so whatever layoutAt left behind doesn't hold any more
+	lb.layout.valid = false
+
+	// Perform all position and width calculations on box's children
+	resolved := separatedTop
+	switch lb.BoxType {
+	case AnonymousBlock:
+		lb.LayoutInlineChildren()
+		if len(lb.Lines) > 0 {
+			resolved = true
+			childY, childStrut = d.Content.Y+d.Content.Height, marginStrut{}
+		}
+	case FlexNode:
+		// flex and grid containers establish a formatting context, so their top is always separated
+		lb.LayoutFlexChildren()
+		childY, childStrut = d.Content.Y+d.Content.Height, marginStrut{}
+	case GridNode:
+		lb.LayoutGridChildren()
+		childY, childStrut = d.Content.Y+d.Content.Height, marginStrut{}
+	default:
+		var hasContent bool
+		childY, childStrut, hasContent = lb.LayoutBlockChildren(childY, childStrut, !separatedTop)
+		resolved = resolved || hasContent
+	}
+
+	if !resolved {
+		if canCollapseThrough {
+			d.Content.Height = 0
+			return y, childStrut.add(d.Margin.Bottom), true
+		}
+
+		// nothing inside, but something keeps our top and bottom margins apart
+		d.Content.Y = y + childStrut.value()
+		childY, childStrut = d.Content.Y, marginStrut{}
+	}
+
+	after := marginStrut{}
+	if collapseBottom {
+		d.Content.Height = childY - d.Content.Y
+		after = childStrut
+	} else {
+		d.Content.Height = childY + childStrut.value() - d.Content.Y
+	}
+
+	// THEN calculate the height of the box
+	lb.CalculateBlockHeight()
+
+	bottom := d.Content.Y + d.Content.Height + d.Padding.Bottom + d.Border.Bottom
+	return bottom, after.add(d.Margin.Bottom), false
+}
+
+// EstablishesFormattingContext returns true if a box lays out its children independently of
+// its surroundings, which keeps its children's margins from collapsing with its own
+func (lb *LayoutBox) EstablishesFormattingContext() bool {
+	styledNode := lb.GetStyledNode()
+
+	if overflow := styledNode.value("overflow"); overflow != nil && !overflow.IsKeyword("visible") && !overflow.IsKeyword("clip") {
+		return true
+	}
+
+	if display := styledNode.value("display"); display != nil {
+		switch display.Keyword {
+		case "flow-root", "inline-block", "table-cell", "table-caption", "flex", "inline-flex", "grid", "inline-grid":
+			return true
+		}
+	}
+
+	return false
+}
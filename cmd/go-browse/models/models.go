@@ -42,38 +42,267 @@ func (e ElementData) ID() *string {
 func (e ElementData) Classes() *[]string {
 	if e.Attributes["class"] != "" {
 		classStr := e.Attributes["class"]
-		classes := strings.Split(classStr, " ")
+		classes := strings.Fields(classStr)
 		return &classes
 	}
 	return nil
 }
 
+// NodeRef points at a Node along with its place in the tree, so that selectors can
+// look at its ancestors and siblings
+type NodeRef struct {
+	Node   *Node
+	Parent *NodeRef
+	Index  int // position of the Node among its parent's children
+}
+
+// ParentElement returns the element containing a node, or nil for the root
+func (r *NodeRef) ParentElement() *NodeRef {
+	if r.Parent == nil || r.Parent.Node.NodeType != Element {
+		return nil
+	}
+	return r.Parent
+}
+
+// PreviousElementSibling returns the closest element before a node with the same parent
+func (r *NodeRef) PreviousElementSibling() *NodeRef {
+	if r.Parent == nil {
+		return nil
+	}
+
+	for i := r.Index - 1; i >= 0; i-- {
+		sibling := &r.Parent.Node.Children[i]
+		if sibling.NodeType == Element {
+			return &NodeRef{Node: sibling, Parent: r.Parent, Index: i}
+		}
+	}
+	return nil
+}
+
+// Child returns a NodeRef for the child of a node at an index
+func (r *NodeRef) Child(index int) *NodeRef {
+	return &NodeRef{Node: &r.Node.Children[index], Parent: r, Index: index}
+}
+
 // Stylesheet represents a set of CSS Rules
 type Stylesheet struct {
-	Rules []Rule
+	Rules    []Rule
+	Origin   Origin
+	Warnings []error // invalid rules and declarations dropped while parsing
 }
 
+// Origin is an enum of where a Stylesheet comes from, in increasing order of precedence
+// for normal declarations. The order is reversed for !important declarations.
+type Origin int
+
+const (
+	// UserAgentOrigin is the browser's built-in stylesheet
+	UserAgentOrigin Origin = iota
+	// UserOrigin is a stylesheet set by the person using the browser
+	UserOrigin
+	// AuthorOrigin is a stylesheet that comes with the document
+	AuthorOrigin
+)
+
 // Rule represents the selectors and declaractions that make a CSS Rule
 type Rule struct {
 	Selectors    []Selector
 	Declarations []Declaration
 }
 
-// Selector represents the mapping for which elements certain CSS Rules should be applied
+// Selector represents the mapping for which elements certain CSS Rules should be applied.
+// It is a chain of compound selectors joined by combinators, like "nav > ul li".
 type Selector struct {
-	TagName *string
-	ID      *string
-	Classes *[]string
+	Parts []SelectorPart // left to right, the last part is the subject of the selector
+}
+
+// SelectorPart is one compound selector in a Selector and how it relates to the part before it
+type SelectorPart struct {
+	Combinator Combinator // ignored for the first part
+	Compound   CompoundSelector
+}
+
+// CompoundSelector is a set of simple selectors that must all match the same element, like div#main.wide
+type CompoundSelector struct {
+	TagName       *string
+	ID            *string
+	Classes       *[]string
+	Attributes    []AttributeSelector
+	PseudoClasses []PseudoClass
+}
+
+// PseudoClass matches an element by its place in the document or by other selectors, like :nth-child(2n+1)
+type PseudoClass struct {
+	Name      string     // lowercase, without the colon
+	A, B      int        // the step and offset of an :nth-*() pseudo-class
+	Selectors []Selector // the argument of :not(), :is(), :where() and :has()
+}
+
+// String serializes a PseudoClass back into CSS
+func (p PseudoClass) String() string {
+	switch {
+	case strings.HasPrefix(p.Name, "nth-"):
+		return ":" + p.Name + "(" + formatAnPlusB(p.A, p.B) + ")"
+	case p.Selectors != nil:
+		arguments := make([]string, 0, len(p.Selectors))
+		for _, selector := range p.Selectors {
+			argument := selector.String()
+			if p.Name == "has" && len(selector.Parts) > 0 && selector.Parts[0].Combinator != Descendant {
+				argument = strings.TrimLeft(selector.Parts[0].Combinator.String(), " ") + argument
+			}
+			arguments = append(arguments, argument)
+		}
+		return ":" + p.Name + "(" + strings.Join(arguments, ", ") + ")"
+	}
+	return ":" + p.Name
+}
+
+// formatAnPlusB writes the an+b argument of an :nth-*() pseudo-class
+func formatAnPlusB(a, b int) string {
+	if a == 0 {
+		return strconv.Itoa(b)
+	}
+
+	step := strconv.Itoa(a) + "n"
+	switch a {
+	case 1:
+		step = "n"
+	case -1:
+		step = "-n"
+	}
+
+	switch {
+	case b > 0:
+		return step + "+" + strconv.Itoa(b)
+	case b < 0:
+		return step + strconv.Itoa(b)
+	}
+	return step
+}
+
+// AttributeSelector matches an element by one of its attributes, like [href^="https:" i]
+type AttributeSelector struct {
+	Name            string // always lowercase, as HTML attribute names are
+	Matcher         AttributeMatcher
+	Value           string
+	CaseInsensitive bool // set by the i flag
+}
+
+// AttributeMatcher is an enum of the ways an AttributeSelector compares an attribute's value
+type AttributeMatcher int
+
+const (
+	// AttributeExists matches any element with the attribute, written as [name]
+	AttributeExists AttributeMatcher = iota
+	// AttributeEquals matches the exact value, written as [name=value]
+	AttributeEquals
+	// AttributeIncludes matches one word of a whitespace-separated list, written as [name~=value]
+	AttributeIncludes
+	// AttributeDashMatch matches the value or the value followed by a dash, written as [name|=value]
+	AttributeDashMatch
+	// AttributePrefix matches values starting with the value, written as [name^=value]
+	AttributePrefix
+	// AttributeSuffix matches values ending with the value, written as [name$=value]
+	AttributeSuffix
+	// AttributeSubstring matches values containing the value, written as [name*=value]
+	AttributeSubstring
+)
+
+var attributeMatcherOperators = map[AttributeMatcher]string{
+	AttributeEquals:    "=",
+	AttributeIncludes:  "~=",
+	AttributeDashMatch: "|=",
+	AttributePrefix:    "^=",
+	AttributeSuffix:    "$=",
+	AttributeSubstring: "*=",
+}
+
+// String serializes an AttributeSelector back into CSS
+func (a AttributeSelector) String() string {
+	if a.Matcher == AttributeExists {
+		return "[" + a.Name + "]"
+	}
+
+	flag := ""
+	if a.CaseInsensitive {
+		flag = " i"
+	}
+	return "[" + a.Name + attributeMatcherOperators[a.Matcher] + strconv.Quote(a.Value) + flag + "]"
+}
+
+// Combinator is an enum of the relationships between the parts of a Selector
+type Combinator int
+
+const (
+	// Descendant matches an element inside any ancestor matching the previous part, written as whitespace
+	Descendant Combinator = iota
+	// Child matches an element whose parent matches the previous part, written as >
+	Child
+	// NextSibling matches an element immediately after a sibling matching the previous part, written as +
+	NextSibling
+	// SubsequentSibling matches an element after any sibling matching the previous part, written as ~
+	SubsequentSibling
+)
+
+func (c Combinator) String() string {
+	switch c {
+	case Child:
+		return " > "
+	case NextSibling:
+		return " + "
+	case SubsequentSibling:
+		return " ~ "
+	}
+	return " "
+}
+
+// String serializes a Selector back into CSS
+func (s Selector) String() string {
+	var sb strings.Builder
+	for i, part := range s.Parts {
+		if i > 0 {
+			sb.WriteString(part.Combinator.String())
+		}
+		sb.WriteString(part.Compound.String())
+	}
+	return sb.String()
+}
+
+// String serializes a CompoundSelector back into CSS
+func (c CompoundSelector) String() string {
+	var sb strings.Builder
+	if c.TagName != nil {
+		sb.WriteString(*c.TagName)
+	}
+	if c.ID != nil {
+		sb.WriteString("#" + *c.ID)
+	}
+	if c.Classes != nil {
+		for _, class := range *c.Classes {
+			sb.WriteString("." + class)
+		}
+	}
+	for _, attribute := range c.Attributes {
+		sb.WriteString(attribute.String())
+	}
+	for _, pseudoClass := range c.PseudoClasses {
+		sb.WriteString(pseudoClass.String())
+	}
+	if sb.Len() == 0 {
+		return "*"
+	}
+	return sb.String()
 }
 
 // Declaration represents a <name, value> pair for CSS Properties
 type Declaration struct {
-	Name  string
-	Value string // TODO: Extend into multiple types, should also be a slice
+	Name      string
+	Value     Value
+	Important bool // set by a trailing !important
 }
 
 // PropertyMap represents a collection of CSS properties and their corresponding values
-type PropertyMap map[string]string
+type PropertyMap map[string]Value
 
 // StyledNode is a DOM node that is associated with a map of CSS properties and values
 type StyledNode struct {
@@ -82,10 +311,10 @@ type StyledNode struct {
 	Children        []StyledNode
 }
 
-func (s *StyledNode) value(name string) *string {
-	value := s.SpecifiedValues[name]
+func (s *StyledNode) value(name string) *Value {
+	value, ok := s.SpecifiedValues[name]
 
-	if value == "" {
+	if !ok {
 		return nil
 	}
 	return &value
@@ -99,10 +328,19 @@ func (s *StyledNode) Display() Display {
 		return Inline
 	}
 
-	// should create default display types based on the element
-	switch *displayValue {
-	case "block":
+	switch displayValue.Keyword {
+	// list items and tables are laid out as plain blocks until they get their own boxes
+	case "block", "flow-root", "list-item", "table", "table-caption", "table-header-group", "table-row-group",
+		"table-footer-group", "table-row", "table-cell":
 		return Block
+	case "flex":
+		return Flex
+	case "inline-flex":
+		return InlineFlex
+	case "grid":
+		return Grid
+	case "inline-grid":
+		return InlineGrid
 	case "none":
 		return None
 	default:
@@ -110,6 +348,36 @@ func (s *StyledNode) Display() Display {
 	}
 }
 
+// Color returns the color corresponding to a color-valued property on a StyledNode,
+// or nil if the property isn't set to a color
+func (s *StyledNode) Color(name string) *Color {
+	value := s.value(name)
+	if value == nil {
+		return nil
+	}
+
+	switch value.ValueType {
+	case ColorValue:
+		color := value.Color
+		return &color
+	case KeywordValue:
+		if value.Keyword == "currentcolor" {
+			if name == "color" {
+				return nil
+			}
+			return s.Color("color")
+		}
+
+		color, ok := NamedColor(value.Keyword)
+		if !ok {
+			return nil
+		}
+		return &color
+	}
+
+	return nil
+}
+
 // Specificity represents how specifically a selector applies to a certain element
 type Specificity struct {
 	IDSpecificity      int
@@ -121,6 +389,9 @@ type Specificity struct {
 type MatchedRule struct {
 	Rule        Rule
 	Specificity Specificity
+	Origin      Origin
+	Order       int  // position of the rule across all stylesheets, so later rules win ties
+	Inline      bool // the declarations came from the element's style attribute
 }
 
 // Dimensions represents everything needed to position and layout a CSS Box
@@ -133,18 +404,18 @@ type Dimensions struct {
 
 // Rectangle represents a 2D rectangle drawn in (x,y) space
 type Rectangle struct {
-	X      int // should be float32
-	Y      int
-	Width  int
-	Height int
+	X      LayoutUnit
+	Y      LayoutUnit
+	Width  LayoutUnit
+	Height LayoutUnit
 }
 
 // EdgeSizes represents the distance drawn on each side from the previous content area layer
 type EdgeSizes struct {
-	Left   int
-	Right  int
-	Top    int
-	Bottom int
+	Left   LayoutUnit
+	Right  LayoutUnit
+	Top    LayoutUnit
+	Bottom LayoutUnit
 }
 
 // LayoutBox represents a node on the Layout Tree
@@ -153,6 +424,18 @@ type LayoutBox struct {
 	BoxType    BoxType
 	Node       *StyledNode
 	Children   []*LayoutBox
+	Fragments  []InlineFragment // where an inline box was placed on each line it spans
+	Lines      []LineBox        // the line boxes of an anonymous block's inline content
+	lengths    lengthContext    // what the box's percentages and viewport units resolve against
+	// imposedHeight is a height the box's container decided on, like a stretched flex item's,
+	// which replaces the one the box would work out for itself
+	imposedHeight *LayoutUnit
+	// layout, measured and widths remember the last layout, measurement and intrinsic widths
+	// the box's container asked for, so asking again the same way doesn't lay out the whole
+	// subtree again
+	layout   layoutRecord
+	measured measureRecord
+	widths   widthRecord
 }
 
 // NewLayoutBox is a constructor for a LayoutBox with a certain box type
@@ -174,134 +457,115 @@ func (lb LayoutBox) GetStyledNode() StyledNode {
 	return *node
 }
 
-// Layout determines the dimensions for a LayoutBox based on its container
+// Layout determines the dimensions for a LayoutBox based on its container, which is also the
+// viewport that vw, vh, vmin and vmax are relative to. Inline boxes are placed by the
+// anonymous block that contains them.
 func (lb *LayoutBox) Layout(container Dimensions) {
-	if lb.BoxType == BlockNode {
-		lb.LayoutBlock(container)
+	lb.lengths = lengthContext{
+		viewport:        container.Content,
+		containerHeight: container.Content.Height,
+		definiteHeight:  true,
 	}
 
-	// TODO: layout InlineNode
+	switch lb.BoxType {
+	case BlockNode, AnonymousBlock, FlexNode, GridNode:
+		lb.LayoutBlock(container)
+	}
 }
 
-// LayoutBlock determines the dimensions of a LayoutBox of BoxType block
+// LayoutBlock determines the dimensions of a LayoutBox of BoxType block. The box is laid out as
+// the root of a block formatting context, so its margins don't collapse with its children's.
 func (lb *LayoutBox) LayoutBlock(container Dimensions) {
-	// Calculate the box's width based on the parent
-	lb.CalculateBlockWidth(container)
-
-	// Calculate the box's position based on the parent
-	lb.CalculateBlockPosition(container)
-
-	// Perform all position and width calculations on box's children
-	lb.LayoutBlockChildren()
-
-	// THEN calculate the height of the box
-	lb.CalculateBlockHeight()
+	lb.layoutInFlow(container, container.Content.Y, marginStrut{}, true)
 }
 
 // CalculateBlockWidth calculates the box's width based on the dimensions of its container
 func (lb *LayoutBox) CalculateBlockWidth(container Dimensions) {
 	styledNode := lb.GetStyledNode()
 
-	width := "auto"
-	styledWidth := styledNode.value("width")
-	if styledWidth != nil {
-		width = *styledWidth
-	}
+	auto := NewKeyword("auto")
+	zero := NewLength(0, Px)
+
+	width := styledNode.Lookup([]string{"width"}, auto)
 
-	zero := "0"
+	marginLeft := styledNode.Lookup([]string{"margin-left"}, zero)
+	marginRight := styledNode.Lookup([]string{"margin-right"}, zero)
 
-	marginLeft := styledNode.Lookup([]string{"margin-left", "margin"}, zero)
-	marginRight := styledNode.Lookup([]string{"margin-right", "margin"}, zero)
+	borderLeft := styledNode.Lookup([]string{"border-left-width"}, zero)
+	borderRight := styledNode.Lookup([]string{"border-right-width"}, zero)
 
-	borderLeft := styledNode.Lookup([]string{"border-left-width", "border-left"}, zero)
-	borderRight := styledNode.Lookup([]string{"border-right-width", "border-right"}, zero)
+	paddingLeft := styledNode.Lookup([]string{"padding-left"}, zero)
+	paddingRight := styledNode.Lookup([]string{"padding-right"}, zero)
 
-	paddingLeft := styledNode.Lookup([]string{"padding-left", "padding"}, zero)
-	paddingRight := styledNode.Lookup([]string{"padding-right", "padding"}, zero)
+	// percentages on either axis are relative to the container's width
+	base := container.Content.Width
 
-	totalWidth := 0
-	for _, partialWidth := range []string{marginLeft, marginRight, borderLeft, borderRight, paddingLeft, paddingRight, width} {
-		totalWidth += convertToPixels(partialWidth)
+	totalWidth := LayoutUnit(0)
+	for _, partialWidth := range []Value{marginLeft, marginRight, borderLeft, borderRight, paddingLeft, paddingRight, width} {
+		totalWidth += lb.length(partialWidth, base)
 	}
 
-	if width != "auto" && totalWidth > container.Content.Width {
+	if !width.IsAuto() && totalWidth > container.Content.Width {
 		// overflow! should do something here
 	}
 
 	underflow := container.Content.Width - totalWidth
-	if width != "auto" && marginLeft != "auto" && marginRight != "auto" {
-		marginRight = string(convertToPixels(marginRight) + underflow)
+	if !width.IsAuto() && !marginLeft.IsAuto() && !marginRight.IsAuto() {
+		marginRight = NewLength((lb.length(marginRight, base) + underflow).Pixels(), Px)
 	}
 
-	if width != "auto" && marginLeft != "auto" && marginRight == "auto" {
-		marginRight = string(underflow)
+	if !width.IsAuto() && !marginLeft.IsAuto() && marginRight.IsAuto() {
+		marginRight = NewLength(underflow.Pixels(), Px)
 	}
 
-	if width != "auto" && marginLeft == "auto" && marginRight != "auto" {
-		marginLeft = string(underflow)
+	if !width.IsAuto() && marginLeft.IsAuto() && !marginRight.IsAuto() {
+		marginLeft = NewLength(underflow.Pixels(), Px)
 	}
 
-	if width == "auto" {
-		if marginLeft == "auto" {
+	if width.IsAuto() {
+		if marginLeft.IsAuto() {
 			marginLeft = zero
 		}
-		if marginRight == "auto" {
+		if marginRight.IsAuto() {
 			marginRight = zero
 		}
 
 		if underflow >= 0 {
-			width = strconv.Itoa(underflow)
+			width = NewLength(underflow.Pixels(), Px)
 		} else {
 			width = zero
-			marginRight = string(convertToPixels(marginRight) + underflow)
+			marginRight = NewLength((lb.length(marginRight, base) + underflow).Pixels(), Px)
 		}
 	}
 
-	if width != "auto" && marginLeft == "auto" && marginRight == "auto" {
-		marginLeft = string(underflow / 2)
-		marginRight = string(underflow / 2)
+	if !width.IsAuto() && marginLeft.IsAuto() && marginRight.IsAuto() {
+		// the right margin takes whatever doesn't divide evenly, so the margins add up exactly
+		marginLeft = NewLength((underflow / 2).Pixels(), Px)
+		marginRight = NewLength((underflow - underflow/2).Pixels(), Px)
 	}
 
 	lb.Dimensions = Dimensions{
 		Content: Rectangle{
-			Width: convertToPixels(width),
+			Width: lb.length(width, base),
 		},
 		Padding: EdgeSizes{
-			Left:  convertToPixels(paddingLeft),
-			Right: convertToPixels(paddingRight),
+			Left:  lb.length(paddingLeft, base),
+			Right: lb.length(paddingRight, base),
 		},
 		Border: EdgeSizes{
-			Left:  convertToPixels(borderLeft),
-			Right: convertToPixels(borderRight),
+			Left:  lb.length(borderLeft, base),
+			Right: lb.length(borderRight, base),
 		},
 		Margin: EdgeSizes{
-			Left:  convertToPixels(marginLeft),
-			Right: convertToPixels(marginRight),
+			Left:  lb.length(marginLeft, base),
+			Right: lb.length(marginRight, base),
 		},
 	}
 }
 
-func convertToPixels(s string) int {
-	if s == "auto" {
-		return 0
-	}
-
-	// support %
-
-	if strings.Contains(s, "px") {
-		s = strings.Trim(s, "px")
-	}
-
-	i, err := strconv.Atoi(s)
-	if err != nil {
-		return 0
-	}
-	return i
-}
-
 // Lookup sees if any element in a slice of fields has a corresponding value in a StyledNode
-// if not, it returns a default string
-func (s StyledNode) Lookup(fields []string, defaultVal string) string {
+// if not, it returns a default value
+func (s StyledNode) Lookup(fields []string, defaultVal Value) Value {
 	for _, field := range fields {
 		if s.value(field) != nil {
 			return *s.value(field)
@@ -310,41 +574,52 @@ func (s StyledNode) Lookup(fields []string, defaultVal string) string {
 	return defaultVal
 }
 
-// CalculateBlockPosition calculates the box's position based on the parent
+// CalculateBlockPosition calculates the box's vertical edges and horizontal position based on
+// the parent. Its vertical position depends on the margins it collapses with, so it is set
+// during layout.
 func (lb *LayoutBox) CalculateBlockPosition(container Dimensions) {
 	styledNode := lb.GetStyledNode()
 	d := &lb.Dimensions
 
-	zero := "0"
+	zero := NewLength(0, Px)
+	base := container.Content.Width
 
-	d.Margin.Top = convertToPixels(styledNode.Lookup([]string{"margin-top", "margin"}, zero))
-	d.Margin.Bottom = convertToPixels(styledNode.Lookup([]string{"margin-bottom", "margin"}, zero))
+	d.Margin.Top = lb.length(styledNode.Lookup([]string{"margin-top"}, zero), base)
+	d.Margin.Bottom = lb.length(styledNode.Lookup([]string{"margin-bottom"}, zero), base)
 
-	d.Border.Top = convertToPixels(styledNode.Lookup([]string{"border-top-width", "border-top"}, zero))
-	d.Border.Bottom = convertToPixels(styledNode.Lookup([]string{"border-bottom-width", "border-bottom"}, zero))
+	d.Border.Top = lb.length(styledNode.Lookup([]string{"border-top-width"}, zero), base)
+	d.Border.Bottom = lb.length(styledNode.Lookup([]string{"border-bottom-width"}, zero), base)
 
-	d.Padding.Top = convertToPixels(styledNode.Lookup([]string{"padding-top", "padding"}, zero))
-	d.Padding.Bottom = convertToPixels(styledNode.Lookup([]string{"padding-bottom", "padding"}, zero))
+	d.Padding.Top = lb.length(styledNode.Lookup([]string{"padding-top"}, zero), base)
+	d.Padding.Bottom = lb.length(styledNode.Lookup([]string{"padding-bottom"}, zero), base)
 
 	d.Content.X = container.Content.X + d.Margin.Left + d.Border.Left + d.Padding.Left
-	d.Content.Y = container.Content.Height + container.Content.Y + d.Margin.Top + d.Border.Top + d.Padding.Top
 }
 
-// LayoutBlockChildren performs all position and width calculations on box's childrenr
-func (lb *LayoutBox) LayoutBlockChildren() {
+// LayoutBlockChildren performs all position and width calculations on box's children, stacking
+// each one below the last. y is where the first child's margins start and strut holds the
+// margins above it that haven't been applied yet. If collapseTop is set the box's own top
+// collapses with its first child's, so it moves down to wherever that child ends up.
+// Returns where the margins below the last child start, the margins still pending there, and
+// whether any child had content.
+func (lb *LayoutBox) LayoutBlockChildren(y LayoutUnit, strut marginStrut, collapseTop bool) (LayoutUnit, marginStrut, bool) {
 	d := &lb.Dimensions
-
-	// for _, child := range lb.Children {
-	// 	childRef := &child
-	// 	childRef.Layout(*d)
-	// 	d.Content.Height = d.Content.Height + child.Dimensions.MarginBox().Height
-	// }
-
-	for i := 0; i < len(lb.Children); i++ {
-		child := lb.Children[i]
-		child.Layout(*d)
-		lb.Children[i] = child
+	resolved := false
+
+	lengths := lb.childLengths()
+	for _, child := range lb.Children {
+		child.lengths = lengths
+		childY, childStrut, collapsedThrough := child.layoutInFlow(*d, y, strut, false)
+		if !collapsedThrough && !resolved {
+			resolved = true
+			if collapseTop {
+				d.Content.Y = child.Dimensions.BorderBox().Y
+			}
+		}
+		y, strut = childY, childStrut
 	}
+
+	return y, strut, resolved
 }
 
 // PaddingBox calculates the area covered by the content area plus its padding
@@ -366,39 +641,74 @@ func (d Dimensions) MarginBox() Rectangle {
 func (r Rectangle) ExpandedBy(edge EdgeSizes) Rectangle {
 	return Rectangle{
 		X:      r.X - edge.Left,
-		Y:      r.Y - edge.Right,
+		Y:      r.Y - edge.Top,
 		Width:  r.Width + edge.Left + edge.Right,
 		Height: r.Height + edge.Top + edge.Bottom,
 	}
 }
 
-// CalculateBlockHeight calculates the height of a box
+// CalculateBlockHeight calculates the height of a box. An explicit height replaces the height
+// of its children, then min-height and max-height clamp the result, with min-height winning.
 func (lb *LayoutBox) CalculateBlockHeight() {
 	styledNode := lb.GetStyledNode()
-	if styledNode.value("height") != nil {
-		lb.Dimensions.Content.Height = convertToPixels(*styledNode.value("height"))
+	d := &lb.Dimensions
+
+	if height, ok := lb.resolveHeight(styledNode.Lookup([]string{"height"}, NewKeyword("auto"))); ok {
+		d.Content.Height = height
 	}
+
+	d.Content.Height = lb.clampHeight(d.Content.Height)
+}
+
+// clampHeight applies a box's max-height and min-height to a height. Percentages that can't be
+// resolved count as none and zero respectively.
+func (lb *LayoutBox) clampHeight(height LayoutUnit) LayoutUnit {
+	styledNode := lb.GetStyledNode()
+
+	if maxHeight, ok := lb.resolveHeight(styledNode.Lookup([]string{"max-height"}, NewKeyword("none"))); ok {
+		height = minUnit(height, maxHeight)
+	}
+
+	if minHeight, ok := lb.resolveHeight(styledNode.Lookup([]string{"min-height"}, NewKeyword("auto"))); ok {
+		height = maxUnit(height, minHeight)
+	}
+
+	return height
 }
 
 // GetInlineContainer is called when we need the proper container Box for an Inline Element
-func (lb LayoutBox) GetInlineContainer() LayoutBox {
+func (lb *LayoutBox) GetInlineContainer() *LayoutBox {
 	// Switch based on the parent's BoxType
 	switch lb.BoxType {
 	case InlineNode: // Inline boxes can have inline children
 		return lb
 	case AnonymousBlock: // Anonymous boxes can have inline children
 		return lb
-	case BlockNode: // Blocks need to create an anonymous box to hold inline children
+	case BlockNode, FlexNode, GridNode: // Blocks, flex and grid containers need to create an anonymous box to hold inline children
 		if len(lb.Children) == 0 || lb.Children[len(lb.Children)-1].BoxType != AnonymousBlock { // If the latest child isn't an anonymous box...
-			anonBox := NewLayoutBox(AnonymousBlock, nil)
+			anonBox := NewLayoutBox(AnonymousBlock, lb.anonymousStyle())
 			lb.Children = append(lb.Children, &anonBox) // make it so
 		}
-		return *lb.Children[len(lb.Children)-1] // Return the latest child as the thing that will contain this incoming inline elemen
+		return lb.Children[len(lb.Children)-1] // Return the latest child as the thing that will contain this incoming inline elemen
 	}
 
 	return lb // shouldn't happen
 }
 
+// anonymousStyle returns the style of an anonymous box inside this one, which only has the
+// values it inherits
+func (lb *LayoutBox) anonymousStyle() *StyledNode {
+	values := make(PropertyMap)
+	if lb.Node != nil {
+		for name, value := range lb.Node.SpecifiedValues {
+			if IsInherited(name) {
+				values[name] = value
+			}
+		}
+	}
+	return &StyledNode{SpecifiedValues: values}
+}
+
 // BoxType is an enum corresponding to the CSS Box Type of a LayoutBox
 type BoxType int
 
@@ -409,6 +719,10 @@ const (
 	InlineNode
 	// AnonymousBlock corresponds to an anonymous block
 	AnonymousBlock
+	// FlexNode corresponds to a flex container, whose children are laid out as flex items
+	FlexNode
+	// GridNode corresponds to a grid container, whose children are laid out as grid items
+	GridNode
 )
 
 // Display is an enum containing supported values for the css display property
@@ -421,4 +735,12 @@ const (
 	Block
 	// None corresponds to display:none
 	None
+	// Flex corresponds to display:flex
+	Flex
+	// InlineFlex corresponds to display:inline-flex
+	InlineFlex
+	// Grid corresponds to display:grid
+	Grid
+	// InlineGrid corresponds to display:inline-grid
+	InlineGrid
 )
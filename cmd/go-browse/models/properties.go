@@ -0,0 +1,120 @@
+package models
+
+// Property describes how a CSS property takes part in the cascade
+type Property struct {
+	Inherited bool  // whether elements take the property from their parent when it isn't set
+	Initial   Value // the value the property has when it is neither set nor inherited
+}
+
+// Properties is the registry of the longhand CSS properties we know about
+var Properties = map[string]Property{
+	// box generation
+	"display":    {Initial: NewKeyword("inline")},
+	"visibility": {Inherited: true, Initial: NewKeyword("visible")},
+	"overflow":   {Initial: NewKeyword("visible")},
+
+	// sizing
+	"width":      {Initial: NewKeyword("auto")},
+	"height":     {Initial: NewKeyword("auto")},
+	"min-width":  {Initial: NewKeyword("auto")},
+	"min-height": {Initial: NewKeyword("auto")},
+	"max-width":  {Initial: NewKeyword("none")},
+	"max-height": {Initial: NewKeyword("none")},
+
+	// positioning
+	"top":    {Initial: NewKeyword("auto")},
+	"right":  {Initial: NewKeyword("auto")},
+	"bottom": {Initial: NewKeyword("auto")},
+	"left":   {Initial: NewKeyword("auto")},
+
+	// box model
+	"margin-top":          {Initial: NewLength(0, Px)},
+	"margin-right":        {Initial: NewLength(0, Px)},
+	"margin-bottom":       {Initial: NewLength(0, Px)},
+	"margin-left":         {Initial: NewLength(0, Px)},
+	"padding-top":         {Initial: NewLength(0, Px)},
+	"padding-right":       {Initial: NewLength(0, Px)},
+	"padding-bottom":      {Initial: NewLength(0, Px)},
+	"padding-left":        {Initial: NewLength(0, Px)},
+	"border-top-width":    {Initial: NewKeyword("medium")},
+	"border-right-width":  {Initial: NewKeyword("medium")},
+	"border-bottom-width": {Initial: NewKeyword("medium")},
+	"border-left-width":   {Initial: NewKeyword("medium")},
+	"border-top-style":    {Initial: NewKeyword("none")},
+	"border-right-style":  {Initial: NewKeyword("none")},
+	"border-bottom-style": {Initial: NewKeyword("none")},
+	"border-left-style":   {Initial: NewKeyword("none")},
+	"border-top-color":    {Initial: NewKeyword("currentcolor")},
+	"border-right-color":  {Initial: NewKeyword("currentcolor")},
+	"border-bottom-color": {Initial: NewKeyword("currentcolor")},
+	"border-left-color":   {Initial: NewKeyword("currentcolor")},
+
+	// color and background
+	"color":                 {Inherited: true, Initial: NewColor(Color{A: 255})},
+	"background-color":      {Initial: NewColor(Transparent)},
+	"background-image":      {Initial: NewKeyword("none")},
+	"background-position":   {Initial: NewList(SpaceSeparated, []Value{NewPercentage(0), NewPercentage(0)})},
+	"background-size":       {Initial: NewKeyword("auto")},
+	"background-repeat":     {Initial: NewKeyword("repeat")},
+	"background-attachment": {Initial: NewKeyword("scroll")},
+	"background-origin":     {Initial: NewKeyword("padding-box")},
+	"background-clip":       {Initial: NewKeyword("border-box")},
+
+	// flexible boxes
+	"flex-direction":  {Initial: NewKeyword("row")},
+	"flex-wrap":       {Initial: NewKeyword("nowrap")},
+	"flex-grow":       {Initial: NewNumber(0)},
+	"flex-shrink":     {Initial: NewNumber(1)},
+	"flex-basis":      {Initial: NewKeyword("auto")},
+	"order":           {Initial: NewNumber(0)},
+	"justify-content": {Initial: NewKeyword("normal")},
+	"align-items":     {Initial: NewKeyword("normal")},
+	"align-self":      {Initial: NewKeyword("auto")},
+	"align-content":   {Initial: NewKeyword("normal")},
+	"row-gap":         {Initial: NewKeyword("normal")},
+	"column-gap":      {Initial: NewKeyword("normal")},
+
+	// grids
+	"grid-template-columns": {Initial: NewKeyword("none")},
+	"grid-template-rows":    {Initial: NewKeyword("none")},
+	"grid-template-areas":   {Initial: NewKeyword("none")},
+	"grid-auto-columns":     {Initial: NewKeyword("auto")},
+	"grid-auto-rows":        {Initial: NewKeyword("auto")},
+	"grid-auto-flow":        {Initial: NewKeyword("row")},
+	"grid-row-start":        {Initial: NewKeyword("auto")},
+	"grid-row-end":          {Initial: NewKeyword("auto")},
+	"grid-column-start":     {Initial: NewKeyword("auto")},
+	"grid-column-end":       {Initial: NewKeyword("auto")},
+	"justify-items":         {Initial: NewKeyword("normal")},
+	"justify-self":          {Initial: NewKeyword("auto")},
+
+	// text
+	"font-family":     {Inherited: true, Initial: NewKeyword("serif")},
+	"font-size":       {Inherited: true, Initial: NewKeyword("medium")},
+	"font-style":      {Inherited: true, Initial: NewKeyword("normal")},
+	"font-weight":     {Inherited: true, Initial: NewKeyword("normal")},
+	"font-variant":    {Inherited: true, Initial: NewKeyword("normal")},
+	"font-stretch":    {Inherited: true, Initial: NewKeyword("normal")},
+	"line-height":     {Inherited: true, Initial: NewKeyword("normal")},
+	"text-align":      {Inherited: true, Initial: NewKeyword("start")},
+	"text-indent":     {Inherited: true, Initial: NewLength(0, Px)},
+	"letter-spacing":  {Inherited: true, Initial: NewKeyword("normal")},
+	"word-spacing":    {Inherited: true, Initial: NewKeyword("normal")},
+	"white-space":     {Inherited: true, Initial: NewKeyword("normal")},
+	"text-transform":  {Inherited: true, Initial: NewKeyword("none")},
+	"list-style-type": {Inherited: true, Initial: NewKeyword("disc")},
+}
+
+// IsInherited returns true if a property is inherited by default
+func IsInherited(name string) bool {
+	return Properties[name].Inherited
+}
+
+// InitialValue returns the initial value of a property, if it is in the registry
+func InitialValue(name string) (Value, bool) {
+	property, ok := Properties[name]
+	if !ok {
+		return Value{}, false
+	}
+	return property.Initial, true
+}
@@ -0,0 +1,423 @@
+package models
+
+import "math"
+
+// noLimit stands in for a size that isn't limited, like max-width: none
+const noLimit = LayoutUnit(math.MaxInt32)
+
+// autoMargins records which of a box's margins are auto
+type autoMargins struct {
+	top, right, bottom, left bool
+}
+
+// boxEdges resolves the margins, borders and padding of a box whose containing block is base
+// wide. Auto margins count as zero, and are reported so the container can hand them space.
+func (lb *LayoutBox) boxEdges(base LayoutUnit) (Dimensions, autoMargins) {
+	styledNode := lb.GetStyledNode()
+	zero := NewLength(0, Px)
+
+	edge := func(name string) LayoutUnit {
+		return lb.length(styledNode.Lookup([]string{name}, zero), base)
+	}
+	isAuto := func(name string) bool {
+		return styledNode.Lookup([]string{name}, zero).IsAuto()
+	}
+
+	d := Dimensions{
+		Margin:  EdgeSizes{Top: edge("margin-top"), Right: edge("margin-right"), Bottom: edge("margin-bottom"), Left: edge("margin-left")},
+		Border:  EdgeSizes{Top: edge("border-top-width"), Right: edge("border-right-width"), Bottom: edge("border-bottom-width"), Left: edge("border-left-width")},
+		Padding: EdgeSizes{Top: edge("padding-top"), Right: edge("padding-right"), Bottom: edge("padding-bottom"), Left: edge("padding-left")},
+	}
+	auto := autoMargins{
+		top:    isAuto("margin-top"),
+		right:  isAuto("margin-right"),
+		bottom: isAuto("margin-bottom"),
+		left:   isAuto("margin-left"),
+	}
+	return d, auto
+}
+
+// edgeWidth returns the total width of a box's left and right margins, borders and padding
+func (d Dimensions) edgeWidth() LayoutUnit {
+	return d.Margin.Left + d.Margin.Right + d.Border.Left + d.Border.Right + d.Padding.Left + d.Padding.Right
+}
+
+// edgeHeight returns the total height of a box's top and bottom margins, borders and padding
+func (d Dimensions) edgeHeight() LayoutUnit {
+	return d.Margin.Top + d.Margin.Bottom + d.Border.Top + d.Border.Bottom + d.Padding.Top + d.Padding.Bottom
+}
+
+// layoutRecord is what a box was last laid out with by layoutAt or contentHeight, and how tall
+// its content came out
+type layoutRecord struct {
+	valid   bool
+	x, y    LayoutUnit
+	width   LayoutUnit
+	imposed bool // whether the box had an imposed height, which is then height
+	height  LayoutUnit
+	edges   Dimensions
+	lengths lengthContext // the part of the box's length context its layout depends on
+	content LayoutUnit    // the height of the box's content, before its height properties apply
+}
+
+// measurement is how big a box comes out when it is laid out at a width with no height imposed
+// on it, which is all a container needs to know to size the box
+type measurement struct {
+	content  LayoutUnit // the height of the box's content, before its height properties apply
+	height   LayoutUnit // the height of the content box
+	baseline LayoutUnit // from the top of the margin box to the first baseline
+}
+
+// measureRecord is the last measurement of a box and what it was measured with
+type measureRecord struct {
+	measurement
+	valid   bool
+	width   LayoutUnit
+	edges   Dimensions
+	lengths lengthContext
+}
+
+// widthRecord is the intrinsic widths of a box's content, and the length context its children
+// had when they were worked out
+type widthRecord struct {
+	valid      bool
+	lengths    lengthContext
+	minContent LayoutUnit
+	maxContent LayoutUnit
+}
+
+// layoutAt lays out a box whose size its container has already decided, like a flex item,
+// with the top left corner of its margin box at x, y. Its content box is width wide, and
+// height, if set, replaces the height its content and height property would give it and
+// counts as definite for its children. edges holds the box's margins, borders and padding.
+// The box is the root of its own formatting context.
+func (lb *LayoutBox) layoutAt(x, y, width LayoutUnit, height *LayoutUnit, edges Dimensions) {
+	if !lb.reuseLayout(x, y, width, height, edges) {
+		lb.imposedHeight = height
+		lb.layoutContents(x, y, width, edges)
+		lb.recordLayout(x, y, width, height, edges)
+	}
+
+	if height != nil {
+		lb.Dimensions.Content.Height = *height
+		return
+	}
+	lb.CalculateBlockHeight()
+}
+
+// contentHeight returns how tall a box's content is when its content box is width wide,
+// regardless of its height properties
+func (lb *LayoutBox) contentHeight(width LayoutUnit, edges Dimensions) LayoutUnit {
+	return lb.measure(width, edges).content
+}
+
+// measure works out how big a box is when its content box is width wide and nothing imposes a
+// height on it. A box measured the same way before isn't laid out again, so its container
+// can measure it, lay it out somewhere else and measure it again for the price of one layout.
+func (lb *LayoutBox) measure(width LayoutUnit, edges Dimensions) measurement {
+	r := &lb.measured
+	lengths := lb.layoutLengths()
+	if r.valid && r.width == width && r.edges == edges && r.lengths == lengths {
+		return r.measurement
+	}
+
+	lb.layoutAt(0, 0, width, nil, edges)
+	*r = measureRecord{
+		measurement: measurement{
+			content:  lb.layout.content,
+			height:   lb.Dimensions.Content.Height,
+			baseline: lb.baselineOffset(),
+		},
+		valid:   true,
+		width:   width,
+		edges:   edges,
+		lengths: lengths,
+	}
+	return r.measurement
+}
+
+// reuseLayout moves a box to x, y if it was last laid out the same way, instead of laying it
+// out again, and leaves it as tall as its content. Containers lay their items out more than
+// once, so without this the work would multiply with every level of nesting.
+func (lb *LayoutBox) reuseLayout(x, y, width LayoutUnit, height *LayoutUnit, edges Dimensions) bool {
+	r := &lb.layout
+	if !r.valid || r.width != width || r.edges != edges || r.lengths != lb.layoutLengths() || r.imposed != (height != nil) {
+		return false
+	}
+	if height != nil && *height != r.height {
+		return false
+	}
+
+	lb.translate(x-r.x, y-r.y)
+	r.x, r.y = x, y
+	lb.imposedHeight = height
+	lb.Dimensions.Content.Height = r.content
+	return true
+}
+
+// recordLayout remembers how a box was just laid out, for reuseLayout
+func (lb *LayoutBox) recordLayout(x, y, width LayoutUnit, height *LayoutUnit, edges Dimensions) {
+	lb.layout = layoutRecord{
+		valid:   true,
+		x:       x,
+		y:       y,
+		width:   width,
+		imposed: height != nil,
+		edges:   edges,
+		lengths: lb.layoutLengths(),
+		content: lb.Dimensions.Content.Height,
+	}
+	if height != nil {
+		lb.layout.height = *height
+	}
+}
+
+// layoutLengths returns the part of a box's length context that its layout depends on. Its
+// container's height only matters to percentages in its own height properties, since its
+// children resolve theirs against the box itself.
+func (lb *LayoutBox) layoutLengths() lengthContext {
+	lengths := lb.lengths
+	styledNode := lb.GetStyledNode()
+	for _, name := range []string{"height", "min-height", "max-height"} {
+		if usesPercentage(styledNode.Lookup([]string{name}, NewKeyword("auto"))) {
+			return lengths
+		}
+	}
+	lengths.containerHeight, lengths.definiteHeight = 0, false
+	return lengths
+}
+
+// translate moves a laid out box and everything inside it by dx, dy
+func (lb *LayoutBox) translate(dx, dy LayoutUnit) {
+	if dx == 0 && dy == 0 {
+		return
+	}
+
+	lb.Dimensions.Content.X += dx
+	lb.Dimensions.Content.Y += dy
+	for i := range lb.Lines {
+		lb.Lines[i].Rect.X += dx
+		lb.Lines[i].Rect.Y += dy
+		lb.Lines[i].Baseline += dy
+	}
+	for i := range lb.Fragments {
+		lb.Fragments[i].Dimensions.Content.X += dx
+		lb.Fragments[i].Dimensions.Content.Y += dy
+		lb.Fragments[i].Baseline += dy
+	}
+	for _, child := range lb.Children {
+		child.translate(dx, dy)
+	}
+}
+
+// layoutContents positions a box as layoutAt does and lays out its children, leaving it as
+// tall as they are
+func (lb *LayoutBox) layoutContents(x, y, width LayoutUnit, edges Dimensions) {
+	d := &lb.Dimensions
+	*d = Dimensions{Margin: edges.Margin, Border: edges.Border, Padding: edges.Padding}
+	d.Content.X = x + d.Margin.Left + d.Border.Left + d.Padding.Left
+	d.Content.Y = y + d.Margin.Top + d.Border.Top + d.Padding.Top
+	d.Content.Width = width
+
+	switch lb.BoxType {
+	case AnonymousBlock:
+		lb.LayoutInlineChildren()
+	case FlexNode:
+		lb.LayoutFlexChildren()
+	case GridNode:
+		lb.LayoutGridChildren()
+	default:
+		childY, strut, _ := lb.LayoutBlockChildren(d.Content.Y, marginStrut{}, false)
+		d.Content.Height = childY + strut.value() - d.Content.Y
+	}
+}
+
+// intrinsicWidths returns the min-content and max-content widths of a box's content box: the
+// narrowest it can be without its content overflowing, and how wide it is when none of its
+// lines have to wrap. A width that doesn't depend on the containing block overrides both.
+func (lb *LayoutBox) intrinsicWidths() (LayoutUnit, LayoutUnit) {
+	styledNode := lb.GetStyledNode()
+
+	width := styledNode.Lookup([]string{"width"}, NewKeyword("auto"))
+	if !usesPercentage(width) {
+		if fixed, ok := lb.lengths.resolveLength(width, 0); ok {
+			fixed = lb.clampWidth(fixed, 0)
+			return fixed, fixed
+		}
+	}
+
+	minContent, maxContent := lb.contentWidths()
+	return lb.clampWidth(minContent, 0), lb.clampWidth(maxContent, 0)
+}
+
+// contentWidths returns the min-content and max-content widths of a box's children, whatever
+// width the box itself is given. They only depend on the length context of the children, so
+// they are worked out once for each.
+func (lb *LayoutBox) contentWidths() (LayoutUnit, LayoutUnit) {
+	lengths := lb.childLengths()
+	if lb.widths.valid && lb.widths.lengths == lengths {
+		return lb.widths.minContent, lb.widths.maxContent
+	}
+
+	minContent, maxContent := lb.measureContentWidths(lengths)
+	lb.widths = widthRecord{valid: true, lengths: lengths, minContent: minContent, maxContent: maxContent}
+	return minContent, maxContent
+}
+
+// measureContentWidths works out contentWidths for a box whose children have the given
+// length context. Nothing is laid out, so a box laid out before keeps its layout.
+func (lb *LayoutBox) measureContentWidths(lengths lengthContext) (LayoutUnit, LayoutUnit) {
+	minContent, maxContent := LayoutUnit(0), LayoutUnit(0)
+
+	switch lb.BoxType {
+	case AnonymousBlock:
+		items := make([]inlineItem, 0)
+		for _, child := range lb.Children {
+			lb.collectInlineItems(child, &items)
+		}
+
+		// atomic boxes are measured at their own min-content and max-content widths
+		narrowest, widest := items, append([]inlineItem(nil), items...)
+		for i, item := range items {
+			if item.itemType == atomicItem {
+				item.box.lengths = lengths
+				narrowest[i].width, widest[i].width = item.box.outerIntrinsicWidths()
+			}
+		}
+		minContent = widestLine(breakLines(narrowest, 0))
+		maxContent = widestLine(breakLines(widest, noLimit))
+	case FlexNode:
+		f := lb.flexAxes()
+		// percentage gaps can't be resolved until the container's width is known
+		f.mainGap = lb.gap("column-gap", 0)
+		for _, child := range lb.Children {
+			child.lengths = lengths
+			childMin, childMax := child.outerIntrinsicWidths()
+
+			// a row lays its items side by side, while a column stacks them
+			if f.row {
+				maxContent += childMax
+				if f.wrap {
+					minContent = maxUnit(minContent, childMin)
+				} else {
+					minContent += childMin
+				}
+			} else {
+				minContent = maxUnit(minContent, childMin)
+				maxContent = maxUnit(maxContent, childMax)
+			}
+		}
+		if f.row && len(lb.Children) > 1 {
+			gaps := f.mainGap * LayoutUnit(len(lb.Children)-1)
+			maxContent += gaps
+			if !f.wrap {
+				minContent += gaps
+			}
+		}
+	case GridNode:
+		minContent, maxContent = lb.gridContentWidths()
+	default:
+		for _, child := range lb.Children {
+			child.lengths = lengths
+			childMin, childMax := child.outerIntrinsicWidths()
+			minContent = maxUnit(minContent, childMin)
+			maxContent = maxUnit(maxContent, childMax)
+		}
+	}
+
+	return minContent, maxContent
+}
+
+// outerIntrinsicWidths returns the intrinsic widths of a box's margin box. Percentages in its
+// edges can't be resolved until its container's width is known, so they count as zero.
+func (lb *LayoutBox) outerIntrinsicWidths() (LayoutUnit, LayoutUnit) {
+	minContent, maxContent := lb.intrinsicWidths()
+	edges, _ := lb.boxEdges(0)
+	return minContent + edges.edgeWidth(), maxContent + edges.edgeWidth()
+}
+
+// widestLine returns the width of the widest of a set of lines
+func widestLine(lines [][]inlineItem) LayoutUnit {
+	widest := LayoutUnit(0)
+	for _, line := range lines {
+		width := LayoutUnit(0)
+		for _, item := range line {
+			width += item.width
+		}
+		widest = maxUnit(widest, width)
+	}
+	return widest
+}
+
+// fitContentWidth returns the width of a box that is as wide as its content, as long as that
+// fits in available, unless it has a width of its own. Percentages are taken of base.
+func (lb *LayoutBox) fitContentWidth(available, base LayoutUnit) LayoutUnit {
+	styledNode := lb.GetStyledNode()
+
+	width, ok := lb.lengths.resolveLength(styledNode.Lookup([]string{"width"}, NewKeyword("auto")), base)
+	if !ok {
+		minContent, maxContent := lb.intrinsicWidths()
+		width = minUnit(maxContent, maxUnit(minContent, available))
+	}
+	return lb.clampWidth(width, base)
+}
+
+// clampWidth applies a box's max-width and min-width to a width, with min-width winning.
+// Percentages are taken of base.
+func (lb *LayoutBox) clampWidth(width, base LayoutUnit) LayoutUnit {
+	minWidth, maxWidth := lb.widthLimits(base)
+	return maxUnit(minUnit(width, maxWidth), minWidth)
+}
+
+// widthLimits resolves a box's min-width and max-width, with auto as zero and none as no limit
+func (lb *LayoutBox) widthLimits(base LayoutUnit) (LayoutUnit, LayoutUnit) {
+	styledNode := lb.GetStyledNode()
+
+	minWidth, _ := lb.lengths.resolveLength(styledNode.Lookup([]string{"min-width"}, NewKeyword("auto")), base)
+	maxWidth, ok := lb.lengths.resolveLength(styledNode.Lookup([]string{"max-width"}, NewKeyword("none")), base)
+	if !ok {
+		maxWidth = noLimit
+	}
+	return minWidth, maxWidth
+}
+
+// heightLimits resolves a box's min-height and max-height, with auto and percentages that
+// can't be resolved as zero, and none as no limit
+func (lb *LayoutBox) heightLimits() (LayoutUnit, LayoutUnit) {
+	styledNode := lb.GetStyledNode()
+
+	minHeight, _ := lb.resolveHeight(styledNode.Lookup([]string{"min-height"}, NewKeyword("auto")))
+	maxHeight, ok := lb.resolveHeight(styledNode.Lookup([]string{"max-height"}, NewKeyword("none")))
+	if !ok {
+		maxHeight = noLimit
+	}
+	return minHeight, maxHeight
+}
+
+// firstBaseline returns the y coordinate of the baseline of the first line inside a laid out
+// box, if it has any lines
+func (lb *LayoutBox) firstBaseline() (LayoutUnit, bool) {
+	if len(lb.Lines) > 0 {
+		return lb.Lines[0].Baseline, true
+	}
+	for _, child := range lb.Children {
+		if child.BoxType == InlineNode {
+			continue
+		}
+		if baseline, ok := child.firstBaseline(); ok {
+			return baseline, true
+		}
+	}
+	return 0, false
+}
+
+// baselineOffset returns how far below the top of a laid out box's margin box its first
+// baseline is. A box without lines sits on the bottom of its border box.
+func (lb *LayoutBox) baselineOffset() LayoutUnit {
+	margins := lb.Dimensions.MarginBox()
+	if baseline, ok := lb.firstBaseline(); ok {
+		return baseline - margins.Y
+	}
+	border := lb.Dimensions.BorderBox()
+	return border.Y + border.Height - margins.Y
+}
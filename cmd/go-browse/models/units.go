@@ -0,0 +1,81 @@
+package models
+
+import (
+	"math"
+	"strconv"
+)
+
+// LayoutUnit is a distance used in layout, in fixed point with 1/64 of a pixel precision.
+// Whole fractions of a pixel add up exactly, so splitting and nesting boxes doesn't drift,
+// and geometry is only rounded to device pixels when it is painted.
+type LayoutUnit int
+
+// unitsPerPixel is the number of LayoutUnits in a CSS pixel
+const unitsPerPixel = 64
+
+// FromPixels converts a distance in pixels to the nearest LayoutUnit
+func FromPixels(px float64) LayoutUnit {
+	return LayoutUnit(math.Round(px * unitsPerPixel))
+}
+
+// Pixels returns a LayoutUnit as a number of pixels
+func (u LayoutUnit) Pixels() float64 {
+	return float64(u) / unitsPerPixel
+}
+
+// Round returns the nearest whole number of pixels, rounding halves away from zero
+func (u LayoutUnit) Round() int {
+	return int(math.Round(u.Pixels()))
+}
+
+// Scale multiplies a LayoutUnit by a factor, rounding to the nearest unit
+func (u LayoutUnit) Scale(factor float64) LayoutUnit {
+	return LayoutUnit(math.Round(float64(u) * factor))
+}
+
+// String formats a LayoutUnit as pixels, like 10 or 10.5
+func (u LayoutUnit) String() string {
+	return strconv.FormatFloat(u.Pixels(), 'f', -1, 64)
+}
+
+func minUnit(a, b LayoutUnit) LayoutUnit {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxUnit(a, b LayoutUnit) LayoutUnit {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func maxFloat(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// PixelSnapped rounds a Rectangle's edges to whole device pixels. Snapping the edges rather than
+// the size keeps boxes that touch in layout touching on screen.
+func (r Rectangle) PixelSnapped() (x, y, width, height int) {
+	x, y = r.X.Round(), r.Y.Round()
+	return x, y, (r.X + r.Width).Round() - x, (r.Y + r.Height).Round() - y
+}
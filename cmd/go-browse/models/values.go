@@ -0,0 +1,309 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ValueType informs us of what kind of data a CSS Value holds
+type ValueType int
+
+const (
+	// KeywordValue is a CSS identifier such as auto, block or inherit
+	KeywordValue ValueType = iota
+	// LengthValue is a number with a unit, such as 10px or 1.5em
+	LengthValue
+	// PercentageValue is a number followed by a %
+	PercentageValue
+	// ColorValue is a color such as #ff0000
+	ColorValue
+	// NumberValue is a unitless number
+	NumberValue
+	// StringValue is a quoted string
+	StringValue
+	// ListValue is a space or comma separated sequence of values
+	ListValue
+	// URLValue is a url(), such as a background image
+	URLValue
+	// CalcValue is a math function like calc() or clamp() that can't be resolved until layout
+	CalcValue
+	// FunctionValue is a function layout interprets, like minmax() or repeat()
+	FunctionValue
+	// LineNamesValue is a bracketed list of grid line names, like [sidebar-start main]
+	LineNamesValue
+)
+
+// Unit is an enum of the units a CSS length can be expressed in
+type Unit int
+
+const (
+	// Px corresponds to CSS pixels
+	Px Unit = iota
+	// Em is relative to the element's font size
+	Em
+	// Rem is relative to the root element's font size
+	Rem
+	// Ex is relative to the x-height of the element's font
+	Ex
+	// Ch is relative to the advance of the "0" glyph in the element's font
+	Ch
+	// Vw is 1% of the viewport's width
+	Vw
+	// Vh is 1% of the viewport's height
+	Vh
+	// Vmin is the smaller of Vw and Vh
+	Vmin
+	// Vmax is the larger of Vw and Vh
+	Vmax
+	// Pt corresponds to points, 1/72 of an inch
+	Pt
+	// Pc corresponds to picas, 12 points
+	Pc
+	// Cm corresponds to centimeters
+	Cm
+	// Mm corresponds to millimeters
+	Mm
+	// Q corresponds to quarter-millimeters
+	Q
+	// In corresponds to inches
+	In
+	// Fr is a fraction of the space left over in a grid container
+	Fr
+)
+
+var unitNames = map[Unit]string{
+	Px:   "px",
+	Em:   "em",
+	Rem:  "rem",
+	Ex:   "ex",
+	Ch:   "ch",
+	Vw:   "vw",
+	Vh:   "vh",
+	Vmin: "vmin",
+	Vmax: "vmax",
+	Pt:   "pt",
+	Pc:   "pc",
+	Cm:   "cm",
+	Mm:   "mm",
+	Q:    "q",
+	In:   "in",
+	Fr:   "fr",
+}
+
+// String returns the CSS spelling of a Unit
+func (u Unit) String() string {
+	return unitNames[u]
+}
+
+// ParseUnit returns the Unit corresponding to a (case-insensitive) CSS unit name
+func ParseUnit(name string) (Unit, bool) {
+	name = strings.ToLower(name)
+	for unit, unitName := range unitNames {
+		if unitName == name {
+			return unit, true
+		}
+	}
+	return Px, false
+}
+
+// ListSeparator tells us how the items of a ListValue were delimited
+type ListSeparator int
+
+const (
+	// SpaceSeparated lists look like "10px 20px"
+	SpaceSeparated ListSeparator = iota
+	// CommaSeparated lists look like "Helvetica, sans-serif"
+	CommaSeparated
+	// SlashSeparated lists look like "12px/1.5"
+	SlashSeparated
+)
+
+// Value represents a typed CSS property value
+type Value struct {
+	ValueType ValueType
+	Keyword   string  // KeywordValue
+	Number    float64 // LengthValue, PercentageValue and NumberValue
+	Unit      Unit    // LengthValue
+	Color     Color   // ColorValue
+	Text      string  // StringValue, URLValue and the name of a FunctionValue
+	Values    []Value // ListValue, the arguments of a FunctionValue and the names in a LineNamesValue
+	Separator ListSeparator
+	Calc      *CalcNode // CalcValue
+}
+
+// NewKeyword creates a keyword Value
+func NewKeyword(keyword string) Value {
+	return Value{
+		ValueType: KeywordValue,
+		Keyword:   keyword,
+	}
+}
+
+// NewLength creates a length Value
+func NewLength(number float64, unit Unit) Value {
+	return Value{
+		ValueType: LengthValue,
+		Number:    number,
+		Unit:      unit,
+	}
+}
+
+// NewPercentage creates a percentage Value
+func NewPercentage(number float64) Value {
+	return Value{
+		ValueType: PercentageValue,
+		Number:    number,
+	}
+}
+
+// NewNumber creates a unitless number Value
+func NewNumber(number float64) Value {
+	return Value{
+		ValueType: NumberValue,
+		Number:    number,
+	}
+}
+
+// NewColor creates a color Value
+func NewColor(color Color) Value {
+	return Value{
+		ValueType: ColorValue,
+		Color:     color,
+	}
+}
+
+// NewString creates a string Value
+func NewString(s string) Value {
+	return Value{
+		ValueType: StringValue,
+		Text:      s,
+	}
+}
+
+// NewList creates a list Value out of a set of values
+func NewList(separator ListSeparator, values []Value) Value {
+	return Value{
+		ValueType: ListValue,
+		Values:    values,
+		Separator: separator,
+	}
+}
+
+// NewURL creates a url() Value
+func NewURL(url string) Value {
+	return Value{
+		ValueType: URLValue,
+		Text:      url,
+	}
+}
+
+// NewCalc creates a Value out of a math expression
+func NewCalc(node CalcNode) Value {
+	return Value{
+		ValueType: CalcValue,
+		Calc:      &node,
+	}
+}
+
+// NewFunction creates a Value out of a function and its arguments
+func NewFunction(name string, args []Value) Value {
+	return Value{
+		ValueType: FunctionValue,
+		Text:      name,
+		Values:    args,
+	}
+}
+
+// NewLineNames creates a bracketed list of grid line names
+func NewLineNames(names []string) Value {
+	values := make([]Value, 0, len(names))
+	for _, name := range names {
+		values = append(values, NewKeyword(name))
+	}
+	return Value{
+		ValueType: LineNamesValue,
+		Values:    values,
+	}
+}
+
+// IsFunction returns true if a Value is a call to the given function
+func (v Value) IsFunction(name string) bool {
+	return v.ValueType == FunctionValue && v.Text == name
+}
+
+// IsKeyword returns true if a Value is the given keyword
+func (v Value) IsKeyword(keyword string) bool {
+	return v.ValueType == KeywordValue && v.Keyword == keyword
+}
+
+// IsAuto returns true if a Value is the keyword auto
+func (v Value) IsAuto() bool {
+	return v.IsKeyword("auto")
+}
+
+// Items returns the values of a list, or the Value itself if it is not a list
+func (v Value) Items() []Value {
+	if v.ValueType == ListValue {
+		return v.Values
+	}
+	return []Value{v}
+}
+
+// String serializes a Value back into CSS
+func (v Value) String() string {
+	switch v.ValueType {
+	case KeywordValue:
+		return v.Keyword
+	case LengthValue:
+		return formatNumber(v.Number) + v.Unit.String()
+	case PercentageValue:
+		return formatNumber(v.Number) + "%"
+	case NumberValue:
+		return formatNumber(v.Number)
+	case ColorValue:
+		if v.Color.A == 255 {
+			return fmt.Sprintf("#%02x%02x%02x", v.Color.R, v.Color.G, v.Color.B)
+		}
+		return fmt.Sprintf("#%02x%02x%02x%02x", v.Color.R, v.Color.G, v.Color.B, v.Color.A)
+	case StringValue:
+		return strconv.Quote(v.Text)
+	case URLValue:
+		return "url(" + strconv.Quote(v.Text) + ")"
+	case ListValue:
+		separator := " "
+		switch v.Separator {
+		case CommaSeparated:
+			separator = ", "
+		case SlashSeparated:
+			separator = " / "
+		}
+		items := make([]string, 0, len(v.Values))
+		for _, item := range v.Values {
+			items = append(items, item.String())
+		}
+		return strings.Join(items, separator)
+	case FunctionValue:
+		args := make([]string, 0, len(v.Values))
+		for _, arg := range v.Values {
+			args = append(args, arg.String())
+		}
+		return v.Text + "(" + strings.Join(args, ", ") + ")"
+	case LineNamesValue:
+		names := make([]string, 0, len(v.Values))
+		for _, name := range v.Values {
+			names = append(names, name.Keyword)
+		}
+		return "[" + strings.Join(names, " ") + "]"
+	case CalcValue:
+		if v.Calc.Operator == CalcMin || v.Calc.Operator == CalcMax || v.Calc.Operator == CalcClamp {
+			return v.Calc.String()
+		}
+		return "calc(" + v.Calc.String() + ")"
+	}
+	return ""
+}
+
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
@@ -0,0 +1,297 @@
+package utils
+
+import (
+	"math"
+
+	"github.com/bern/go-browse/cmd/go-browse/models"
+)
+
+// Border sides, indexing models.BorderSides. Each side starts at the corner it shares with the
+// side before it and ends at the corner it shares with the side after it, going clockwise.
+const (
+	topSide = iota
+	rightSide
+	bottomSide
+	leftSide
+)
+
+// borderSide is how one side of a box's border is drawn
+type borderSide struct {
+	width models.LayoutUnit
+	style string
+	color models.Color
+}
+
+// visible returns true if a side of a border paints anything
+func (s borderSide) visible() bool {
+	return s.width > 0 && models.HasBorder(s.style) && s.color.A > 0
+}
+
+// renderBorders draws each side of the border of an area of a LayoutBox in its own style and
+// color. Sides meet in mitered corners, cut diagonally from the outer corner of the border to
+// the inner one.
+func renderBorders(list *models.DisplayList, box models.LayoutBox, d models.Dimensions) {
+	if box.BoxType == models.AnonymousBlock {
+		return
+	}
+
+	styledNode := box.GetStyledNode()
+	widths := []models.LayoutUnit{d.Border.Top, d.Border.Right, d.Border.Bottom, d.Border.Left}
+
+	sides := make([]borderSide, len(models.BorderSides))
+	for i, name := range models.BorderSides {
+		sides[i] = borderSide{width: widths[i], style: models.BorderStyle(styledNode, name)}
+		if color := styledNode.Color("border-" + name + "-color"); color != nil {
+			sides[i].color = *color
+		}
+	}
+
+	// the edges line up with the snapped background, while dashes and dots stay smooth
+	outer, inner := snapRectangle(d.BorderBox()), snapRectangle(d.PaddingBox())
+	for i, side := range sides {
+		if side.visible() {
+			renderBorderSide(list, i, sides, outer, inner)
+		}
+	}
+}
+
+// renderBorderSide draws one side of a border, given every side so it can tell how its
+// corners join its neighbours
+func renderBorderSide(list *models.DisplayList, i int, sides []borderSide, outer, inner models.Rectangle) {
+	side := sides[i]
+
+	switch side.style {
+	case "dashed":
+		renderDashes(list, i, side, outer, inner)
+	case "dotted":
+		renderDots(list, i, side, outer, inner)
+	case "double":
+		// too thin for two lines and a gap between them
+		if side.width < models.FromPixels(3) {
+			fillBand(list, i, outer, inner, 0, 1, side.color)
+			break
+		}
+		fillBand(list, i, outer, inner, 0, 1.0/3, side.color)
+		fillBand(list, i, outer, inner, 2.0/3, 1, side.color)
+	case "groove", "ridge":
+		outerColor, innerColor := shadeBorder(side.color, i, true), shadeBorder(side.color, i, false)
+		if side.style == "ridge" {
+			outerColor, innerColor = innerColor, outerColor
+		}
+		fillBand(list, i, outer, inner, 0, 0.5, outerColor)
+		fillBand(list, i, outer, inner, 0.5, 1, innerColor)
+	case "inset", "outset":
+		fillBand(list, i, outer, inner, 0, 1, shadeBorder(side.color, i, side.style == "inset"))
+	default:
+		points := sideQuad(i, outer, inner)
+
+		// a solid corner shared with a side of the same opaque color is filled square by both,
+		// so no antialiased seam shows along the miter
+		before, after := sides[(i+3)%4], sides[(i+1)%4]
+		if joinsSeamlessly(side, before) {
+			points[3] = squareCorner(i, points[0], points[3])
+		}
+		if joinsSeamlessly(side, after) {
+			points[2] = squareCorner(i, points[1], points[2])
+		}
+		fillPolygon(list, points, side.color)
+	}
+}
+
+// joinsSeamlessly returns true if two adjoining solid sides look the same
+func joinsSeamlessly(side, neighbour borderSide) bool {
+	return neighbour.visible() && side.style == "solid" && neighbour.style == "solid" &&
+		side.color == neighbour.color && side.color.A == 255
+}
+
+// shadeBorder picks the shade of a 3D border style's color for a side. Light comes from the
+// top left, so a sunken border has its top and left sides darkened and the others lightened,
+// and a raised one the other way around.
+func shadeBorder(color models.Color, i int, sunken bool) models.Color {
+	topLeft := i == topSide || i == leftSide
+	if topLeft == sunken {
+		return darken(color)
+	}
+	return lighten(color)
+}
+
+func darken(color models.Color) models.Color {
+	return models.Color{R: color.R / 3 * 2, G: color.G / 3 * 2, B: color.B / 3 * 2, A: color.A}
+}
+
+func lighten(color models.Color) models.Color {
+	return models.Color{
+		R: color.R + (255-color.R)/3,
+		G: color.G + (255-color.G)/3,
+		B: color.B + (255-color.B)/3,
+		A: color.A,
+	}
+}
+
+// fillBand fills the part of a side between two fractions of its width, measured from the
+// outside in. Its ends follow the miters of the whole side.
+func fillBand(list *models.DisplayList, i int, outer, inner models.Rectangle, from, to float64, color models.Color) {
+	fillPolygon(list, sideQuad(i, interpolate(outer, inner, from), interpolate(outer, inner, to)), color)
+}
+
+// renderDashes splits a side into dashes twice as long as the gaps between them, stretched
+// so the side starts and ends with a dash. The dashes at the ends are mitered.
+func renderDashes(list *models.DisplayList, i int, side borderSide, outer, inner models.Rectangle) {
+	quad := sideQuad(i, outer, inner)
+	start, length := sideExtent(i, outer)
+
+	dash, gap := 2*side.width.Pixels(), side.width.Pixels()
+	count := math.Max(1, math.Round((length.Pixels()+gap)/(dash+gap)))
+	period := (length.Pixels() + gap) / count
+	dash = period * 2 / 3
+
+	for n := 0.0; n < count; n++ {
+		from := start + models.FromPixels(n*period)
+		to := from + models.FromPixels(dash)
+		if n == count-1 {
+			to = start + length
+		}
+		fillPolygon(list, clipToSlab(quad, i == topSide || i == bottomSide, from, to), side.color)
+	}
+}
+
+// renderDots draws a side as a row of round dots as wide as the side, evenly spaced about a
+// dot's width apart. The row runs down the middle of the side between the centers of its
+// corners, so neighbouring sides share the dots on their corners.
+func renderDots(list *models.DisplayList, i int, side borderSide, outer, inner models.Rectangle) {
+	middle := sideQuad(i, interpolate(outer, inner, 0.5), interpolate(outer, inner, 0.5))
+	from, to := middle[0], middle[1]
+
+	width := side.width.Pixels()
+	length := math.Hypot((to.X - from.X).Pixels(), (to.Y - from.Y).Pixels())
+	count := math.Max(1, math.Round(length/(2*width)))
+
+	for n := 0.0; n <= count; n++ {
+		center := models.Point{
+			X: from.X + (to.X - from.X).Scale(n/count),
+			Y: from.Y + (to.Y - from.Y).Scale(n/count),
+		}
+		fillPolygon(list, circle(center, width/2), side.color)
+	}
+}
+
+// circle approximates a circle with a polygon
+func circle(center models.Point, radius float64) []models.Point {
+	const segments = 16
+
+	points := make([]models.Point, 0, segments)
+	for n := 0; n < segments; n++ {
+		angle := 2 * math.Pi * float64(n) / segments
+		points = append(points, models.Point{
+			X: center.X + models.FromPixels(radius*math.Cos(angle)),
+			Y: center.Y + models.FromPixels(radius*math.Sin(angle)),
+		})
+	}
+	return points
+}
+
+// sideQuad returns the trapezoid one side of a border covers, running from the outer corner
+// to the inner corner at each end. Its points are the outer edge from start to end, then the
+// inner edge from end to start.
+func sideQuad(i int, outer, inner models.Rectangle) []models.Point {
+	oLeft, oTop, oRight, oBottom := outer.X, outer.Y, outer.X+outer.Width, outer.Y+outer.Height
+	iLeft, iTop, iRight, iBottom := inner.X, inner.Y, inner.X+inner.Width, inner.Y+inner.Height
+
+	switch i {
+	case topSide:
+		return []models.Point{{X: oLeft, Y: oTop}, {X: oRight, Y: oTop}, {X: iRight, Y: iTop}, {X: iLeft, Y: iTop}}
+	case rightSide:
+		return []models.Point{{X: oRight, Y: oTop}, {X: oRight, Y: oBottom}, {X: iRight, Y: iBottom}, {X: iRight, Y: iTop}}
+	case bottomSide:
+		return []models.Point{{X: oRight, Y: oBottom}, {X: oLeft, Y: oBottom}, {X: iLeft, Y: iBottom}, {X: iRight, Y: iBottom}}
+	}
+	return []models.Point{{X: oLeft, Y: oBottom}, {X: oLeft, Y: oTop}, {X: iLeft, Y: iTop}, {X: iLeft, Y: iBottom}}
+}
+
+// squareCorner moves the inner end of a side out to the line of the outer corner, so the side
+// covers the whole corner instead of half of it
+func squareCorner(i int, outerPoint, innerPoint models.Point) models.Point {
+	if i == topSide || i == bottomSide {
+		return models.Point{X: outerPoint.X, Y: innerPoint.Y}
+	}
+	return models.Point{X: innerPoint.X, Y: outerPoint.Y}
+}
+
+// sideExtent returns where a side starts along its axis and how long it is, corners included
+func sideExtent(i int, outer models.Rectangle) (models.LayoutUnit, models.LayoutUnit) {
+	if i == topSide || i == bottomSide {
+		return outer.X, outer.Width
+	}
+	return outer.Y, outer.Height
+}
+
+// interpolate returns the rectangle a fraction of the way from outer to inner
+func interpolate(outer, inner models.Rectangle, t float64) models.Rectangle {
+	lerp := func(a, b models.LayoutUnit) models.LayoutUnit {
+		return a + (b - a).Scale(t)
+	}
+
+	left, top := lerp(outer.X, inner.X), lerp(outer.Y, inner.Y)
+	right := lerp(outer.X+outer.Width, inner.X+inner.Width)
+	bottom := lerp(outer.Y+outer.Height, inner.Y+inner.Height)
+	return models.Rectangle{X: left, Y: top, Width: right - left, Height: bottom - top}
+}
+
+// clipToSlab cuts a convex polygon down to the part between from and to along the x axis if
+// horizontal is set, or the y axis if it isn't
+func clipToSlab(points []models.Point, horizontal bool, from, to models.LayoutUnit) []models.Point {
+	coordinate := func(p models.Point) models.LayoutUnit {
+		if horizontal {
+			return p.X
+		}
+		return p.Y
+	}
+
+	// clip keeps the part of the polygon on the inside of a line, one edge at a time
+	clip := func(points []models.Point, inside func(models.Point) bool, limit models.LayoutUnit) []models.Point {
+		clipped := make([]models.Point, 0, len(points)+2)
+		for n, current := range points {
+			previous := points[(n+len(points)-1)%len(points)]
+			if inside(current) != inside(previous) {
+				t := float64(limit-coordinate(previous)) / float64(coordinate(current)-coordinate(previous))
+				clipped = append(clipped, models.Point{
+					X: previous.X + (current.X - previous.X).Scale(t),
+					Y: previous.Y + (current.Y - previous.Y).Scale(t),
+				})
+			}
+			if inside(current) {
+				clipped = append(clipped, current)
+			}
+		}
+		return clipped
+	}
+
+	points = clip(points, func(p models.Point) bool { return coordinate(p) >= from }, from)
+	if len(points) == 0 {
+		return points
+	}
+	return clip(points, func(p models.Point) bool { return coordinate(p) <= to }, to)
+}
+
+// snapRectangle moves a rectangle's edges to whole pixels, the way Rasterize snaps solid colors
+func snapRectangle(r models.Rectangle) models.Rectangle {
+	x, y, width, height := r.PixelSnapped()
+	return models.Rectangle{
+		X:      models.FromPixels(float64(x)),
+		Y:      models.FromPixels(float64(y)),
+		Width:  models.FromPixels(float64(width)),
+		Height: models.FromPixels(float64(height)),
+	}
+}
+
+// fillPolygon appends a command filling a polygon, unless it has no area
+func fillPolygon(list *models.DisplayList, points []models.Point, color models.Color) {
+	if len(points) < 3 {
+		return
+	}
+	*list = append(*list, models.DisplayCommand{
+		CommandType: models.FillPolygon,
+		Color:       color,
+		Points:      points,
+	})
+}
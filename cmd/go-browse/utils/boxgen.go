@@ -2,44 +2,86 @@ package utils
 
 import (
 	"fmt"
-	"log"
-	"strconv"
+	"strings"
 
 	"github.com/bern/go-browse/cmd/go-browse/models"
 )
 
 // BuildLayoutTree recurses down a LayoutBox node and builds a layout tree
-func BuildLayoutTree(styleNode models.StyledNode) models.LayoutBox {
+func BuildLayoutTree(styleNode models.StyledNode) (models.LayoutBox, error) {
+	return buildLayoutBox(styleNode, styleNode.Display())
+}
+
+// buildLayoutBox builds the layout tree for a node displayed as display, which differs from
+// the node's own display value when a flex or grid container turns it into one of its items
+func buildLayoutBox(styleNode models.StyledNode, display models.Display) (models.LayoutBox, error) {
 	root := models.LayoutBox{}
-	switch styleNode.Display() {
+	switch display {
 	case models.Block:
 		root = models.NewLayoutBox(models.BlockNode, &styleNode)
 		break
 	case models.Inline:
 		root = models.NewLayoutBox(models.InlineNode, &styleNode)
 		break
+	case models.Flex, models.InlineFlex:
+		root = models.NewLayoutBox(models.FlexNode, &styleNode)
+		break
+	case models.Grid, models.InlineGrid:
+		root = models.NewLayoutBox(models.GridNode, &styleNode)
+		break
 	case models.None:
-		log.Fatal("the root node is set to display: none !!!")
+		return models.LayoutBox{}, ErrRootNotDisplayed
 	default:
-		log.Fatal("couldn't find a box type on the root node")
+		return models.LayoutBox{}, fmt.Errorf("couldn't find a box type for display value %d", display)
 	}
 
 	for _, child := range styleNode.Children {
-		switch child.Display() {
-		case models.Block:
-			childTree := BuildLayoutTree(child)
+		childDisplay := child.Display()
+		if root.BoxType == models.FlexNode || root.BoxType == models.GridNode {
+			// runs of text in a flex or grid container are wrapped in anonymous items, unless
+			// they are only white space
+			if child.Node.Text != nil && strings.TrimSpace(*child.Node.Text) == "" {
+				continue
+			}
+			if child.Node.NodeType == models.Element {
+				childDisplay = blockified(childDisplay)
+			}
+		}
+
+		switch childDisplay {
+		case models.Block, models.Flex, models.Grid:
+			childTree, err := buildLayoutBox(child, childDisplay)
+			if err != nil {
+				return models.LayoutBox{}, err
+			}
 			root.Children = append(root.Children, &childTree)
-		case models.Inline:
-			children := root.GetInlineContainer().Children
-			childTree := BuildLayoutTree(child)
-			children = append(children, &childTree)
-			root.Children = children
+		case models.Inline, models.InlineFlex, models.InlineGrid:
+			container := root.GetInlineContainer()
+			childTree, err := buildLayoutBox(child, childDisplay)
+			if err != nil {
+				return models.LayoutBox{}, err
+			}
+			container.Children = append(container.Children, &childTree)
 		case models.None:
 			continue
 		}
 	}
 
-	return root
+	return root, nil
+}
+
+// blockified returns the block-level equivalent of a display value, which the children of a
+// flex or grid container take, since every one of them is an item of the container
+func blockified(display models.Display) models.Display {
+	switch display {
+	case models.Inline:
+		return models.Block
+	case models.InlineFlex:
+		return models.Flex
+	case models.InlineGrid:
+		return models.Grid
+	}
+	return display
 }
 
 // PrintLayoutBox recurses down a LayoutBox, printing all box types
@@ -58,17 +100,27 @@ func PrintLayoutBox(root models.LayoutBox, level int) {
 		printedValue += "inline"
 	case models.AnonymousBlock:
 		printedValue += "anonymous"
+	case models.FlexNode:
+		printedValue += "flex"
+	case models.GridNode:
+		printedValue += "grid"
 	}
 
 	printedValue += " (" +
-		"x:" + strconv.Itoa(root.Dimensions.Content.X) +
-		" y:" + strconv.Itoa(root.Dimensions.Content.Y) +
-		" width:" + strconv.Itoa(root.Dimensions.Content.Width) +
-		" height:" + strconv.Itoa(root.Dimensions.Content.Height) +
+		"x:" + root.Dimensions.Content.X.String() +
+		" y:" + root.Dimensions.Content.Y.String() +
+		" width:" + root.Dimensions.Content.Width.String() +
+		" height:" + root.Dimensions.Content.Height.String() +
 		")"
 
 	fmt.Println(printedValue)
 
+	for _, fragment := range root.Fragments {
+		content := fragment.Dimensions.Content
+		fmt.Printf("%s  ~ line %d %q (x:%s y:%s width:%s height:%s)\n",
+			strings.Repeat("  ", level), fragment.Line, fragment.Text, content.X, content.Y, content.Width, content.Height)
+	}
+
 	for _, child := range root.Children {
 		PrintLayoutBox(*child, level+1)
 	}
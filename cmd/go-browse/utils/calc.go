@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bern/go-browse/cmd/go-browse/models"
+)
+
+// isMathFunction returns true for the math functions we support in lengths
+func isMathFunction(name string) bool {
+	switch name {
+	case "calc", "min", "max", "clamp":
+		return true
+	}
+	return false
+}
+
+// parseMathFunction converts calc(), min(), max() or clamp() into a Value. Expressions that
+// only involve numbers and pixels are computed straight away.
+func parseMathFunction(name string, args []ComponentValue) (models.Value, error) {
+	node, err := parseMathArguments(name, args)
+	if err != nil {
+		return models.Value{}, fmt.Errorf("invalid %s(): %s", name, err)
+	}
+
+	simplified := node.Simplify(func(v models.Value) (float64, bool) {
+		switch {
+		case v.ValueType == models.NumberValue:
+			return v.Number, true
+		case v.ValueType == models.LengthValue && v.Unit == models.Px:
+			return v.Number, true
+		}
+		return 0, false
+	})
+	if simplified.Operator == models.CalcLeaf {
+		return simplified.Value, nil
+	}
+	return models.NewCalc(simplified), nil
+}
+
+// parseMathArguments parses the contents of a math function into an expression tree
+func parseMathArguments(name string, args []ComponentValue) (models.CalcNode, error) {
+	groups := splitOnCommas(args)
+
+	operator := models.CalcSum
+	switch name {
+	case "calc":
+		if len(groups) != 1 {
+			return models.CalcNode{}, errors.New("expected a single expression")
+		}
+		return parseCalcSum(groups[0])
+	case "min":
+		operator = models.CalcMin
+	case "max":
+		operator = models.CalcMax
+	case "clamp":
+		operator = models.CalcClamp
+		if len(groups) != 3 {
+			return models.CalcNode{}, errors.New("expected a minimum, a preferred value and a maximum")
+		}
+	}
+
+	node := models.CalcNode{Operator: operator, Args: make([]models.CalcNode, 0, len(groups))}
+	for _, group := range groups {
+		arg, err := parseCalcSum(group)
+		if err != nil {
+			return models.CalcNode{}, err
+		}
+		if len(node.Args) > 0 && arg.IsNumber() != node.Args[0].IsNumber() {
+			return models.CalcNode{}, errors.New("can't compare numbers with lengths")
+		}
+		node.Args = append(node.Args, arg)
+	}
+	return node, nil
+}
+
+// parseCalcSum parses terms separated by + and -, which must be surrounded by whitespace
+func parseCalcSum(values []ComponentValue) (models.CalcNode, error) {
+	values = trimWhitespace(values)
+
+	terms := make([][]ComponentValue, 0)
+	negated := []bool{false}
+	start := 0
+	for i, value := range values {
+		if !value.IsDelim("+") && !value.IsDelim("-") {
+			continue
+		}
+		if i == 0 || i == len(values)-1 || !values[i-1].Is(WhitespaceToken) || !values[i+1].Is(WhitespaceToken) {
+			return models.CalcNode{}, fmt.Errorf("%s must be surrounded by whitespace", value)
+		}
+		terms = append(terms, values[start:i])
+		negated = append(negated, value.IsDelim("-"))
+		start = i + 1
+	}
+	terms = append(terms, values[start:])
+
+	sum := models.CalcNode{Operator: models.CalcSum, Args: make([]models.CalcNode, 0, len(terms))}
+	for i, term := range terms {
+		node, err := parseCalcProduct(term)
+		if err != nil {
+			return models.CalcNode{}, err
+		}
+		if i > 0 && node.IsNumber() != sum.Args[0].IsNumber() {
+			return models.CalcNode{}, errors.New("can't add numbers to lengths")
+		}
+		if negated[i] {
+			node = models.CalcNode{Operator: models.CalcNegate, Args: []models.CalcNode{node}}
+		}
+		sum.Args = append(sum.Args, node)
+	}
+
+	if len(sum.Args) == 1 {
+		return sum.Args[0], nil
+	}
+	return sum, nil
+}
+
+// parseCalcProduct parses values separated by * and /. At most one of the factors can be a
+// length, and only numbers can be divided by.
+func parseCalcProduct(values []ComponentValue) (models.CalcNode, error) {
+	product := models.CalcNode{Operator: models.CalcProduct, Args: make([]models.CalcNode, 0)}
+	lengths := 0
+	invert := false
+	expectOperand := true
+
+	for _, value := range values {
+		if value.Is(WhitespaceToken) {
+			continue
+		}
+
+		if !expectOperand {
+			if !value.IsDelim("*") && !value.IsDelim("/") {
+				return models.CalcNode{}, fmt.Errorf("expected an operator, found %s", value)
+			}
+			invert = value.IsDelim("/")
+			expectOperand = true
+			continue
+		}
+
+		node, err := parseCalcValue(value)
+		if err != nil {
+			return models.CalcNode{}, err
+		}
+		if !node.IsNumber() {
+			if invert {
+				return models.CalcNode{}, errors.New("can only divide by numbers")
+			}
+			lengths++
+		}
+		if invert {
+			node = models.CalcNode{Operator: models.CalcInvert, Args: []models.CalcNode{node}}
+		}
+		product.Args = append(product.Args, node)
+		expectOperand = false
+	}
+
+	switch {
+	case expectOperand:
+		return models.CalcNode{}, errors.New("missing operand")
+	case lengths > 1:
+		return models.CalcNode{}, errors.New("can't multiply lengths together")
+	case len(product.Args) == 1:
+		return product.Args[0], nil
+	}
+	return product, nil
+}
+
+// parseCalcValue parses a number, length, percentage, parenthesized expression or nested
+// math function
+func parseCalcValue(value ComponentValue) (models.CalcNode, error) {
+	switch {
+	case value.Is(OpenParenToken):
+		return parseCalcSum(value.Children)
+	case value.IsFunction():
+		name := strings.ToLower(value.Token.Value)
+		if !isMathFunction(name) {
+			return models.CalcNode{}, fmt.Errorf("unsupported function %s)", value.Token)
+		}
+		return parseMathArguments(name, value.Children)
+	case value.Is(NumberToken), value.Is(PercentageToken), value.Is(DimensionToken):
+		leaf, err := parseComponentValue(value)
+		if err != nil {
+			return models.CalcNode{}, err
+		}
+		return models.CalcNode{Operator: models.CalcLeaf, Value: leaf}, nil
+	}
+	return models.CalcNode{}, fmt.Errorf("unexpected %s", value)
+}
@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// windows1252Replacements maps numeric references in the C1 control range to the
+// characters legacy pages meant by them
+var windows1252Replacements = map[int]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†',
+	0x87: '‡', 0x88: 'ˆ', 0x89: '‰', 0x8A: 'Š', 0x8B: '‹', 0x8C: 'Œ',
+	0x8E: 'Ž', 0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”', 0x95: '•',
+	0x96: '–', 0x97: '—', 0x98: '˜', 0x99: '™', 0x9A: 'š', 0x9B: '›',
+	0x9C: 'œ', 0x9E: 'ž', 0x9F: 'Ÿ',
+}
+
+// decodeCharacterReferences replaces the &name;, &#nn; and &#xhh; references in a run of
+// text starting at offset. References in attribute values keep their legacy, semicolon-less
+// forms when followed by = or an alphanumeric, so query strings like ?a=1&copy=2 survive.
+func (t *HTMLTokenizer) decodeCharacterReferences(text string, offset int, inAttribute bool) string {
+	if !strings.Contains(text, "&") {
+		return text
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(text); {
+		if text[i] != '&' {
+			sb.WriteByte(text[i])
+			i++
+			continue
+		}
+
+		var decoded string
+		var length int
+		if i+1 < len(text) && text[i+1] == '#' {
+			decoded, length = t.decodeNumericReference(text[i:], offset+i)
+		} else {
+			decoded, length = t.decodeNamedReference(text[i:], offset+i, inAttribute)
+		}
+
+		if length == 0 {
+			sb.WriteByte('&')
+			i++
+			continue
+		}
+		sb.WriteString(decoded)
+		i += length
+	}
+
+	return sb.String()
+}
+
+// decodeNamedReference decodes the longest named reference at the start of text, returning
+// the number of bytes it consumed or 0 if the & should be left alone
+func (t *HTMLTokenizer) decodeNamedReference(text string, pos int, inAttribute bool) (string, int) {
+	end := 1
+	for end < len(text) && end <= longestCharacterReference && isASCIIAlphanumeric(text[end]) {
+		end++
+	}
+	if end < len(text) && text[end] == ';' {
+		end++
+	}
+
+	for ; end > 1; end-- {
+		name := text[1:end]
+		decoded, ok := namedCharacterReferences[name]
+		if !ok {
+			continue
+		}
+
+		if !strings.HasSuffix(name, ";") {
+			if inAttribute && end < len(text) && (text[end] == '=' || isASCIIAlphanumeric(text[end])) {
+				return "", 0
+			}
+			t.parseError(pos, "missing semicolon after character reference &"+name)
+		}
+		return decoded, end
+	}
+
+	// an unknown reference is only an error if it looks like one, like &nosuch;
+	nameEnd := 1
+	for nameEnd < len(text) && isASCIIAlphanumeric(text[nameEnd]) {
+		nameEnd++
+	}
+	if nameEnd > 1 && nameEnd < len(text) && text[nameEnd] == ';' {
+		t.parseError(pos, "unknown named character reference &"+text[1:nameEnd+1])
+	}
+	return "", 0
+}
+
+// decodeNumericReference decodes a &#nn; or &#xhh; reference at the start of text
+func (t *HTMLTokenizer) decodeNumericReference(text string, pos int) (string, int) {
+	base := 10
+	start := 2
+	if len(text) > 2 && (text[2] == 'x' || text[2] == 'X') {
+		base = 16
+		start = 3
+	}
+
+	end := start
+	for end < len(text) && isDigitInBase(text[end], base) {
+		end++
+	}
+	if end == start {
+		t.parseError(pos, "absence of digits in numeric character reference")
+		return "", 0
+	}
+
+	code, err := strconv.ParseInt(text[start:end], base, 64)
+	if err != nil || code > utf8.MaxRune {
+		code = utf8.MaxRune + 1
+	}
+
+	if end < len(text) && text[end] == ';' {
+		end++
+	} else {
+		t.parseError(pos, "missing semicolon after character reference "+text[:end])
+	}
+
+	return string(t.checkCodePoint(int(code), pos)), end
+}
+
+// checkCodePoint reports and replaces the code points a numeric reference may not stand for
+func (t *HTMLTokenizer) checkCodePoint(code, pos int) rune {
+	switch {
+	case code == 0:
+		t.parseError(pos, "null character reference")
+		return utf8.RuneError
+	case code > utf8.MaxRune:
+		t.parseError(pos, "character reference outside unicode range")
+		return utf8.RuneError
+	case code >= 0xD800 && code <= 0xDFFF:
+		t.parseError(pos, "surrogate character reference")
+		return utf8.RuneError
+	case code >= 0xFDD0 && code <= 0xFDEF, code&0xFFFE == 0xFFFE:
+		t.parseError(pos, "noncharacter character reference")
+	case code == 0x0D || (code < 0x20 && !isHTMLWhitespace(byte(code))) || (code >= 0x7F && code <= 0x9F):
+		t.parseError(pos, "control character reference")
+		if replacement, ok := windows1252Replacements[code]; ok {
+			return replacement
+		}
+	}
+	return rune(code)
+}
+
+func isASCIIAlphanumeric(c byte) bool {
+	return isASCIIAlpha(c) || (c >= '0' && c <= '9')
+}
+
+func isDigitInBase(c byte, base int) bool {
+	if c >= '0' && c <= '9' {
+		return true
+	}
+	return base == 16 && ((c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F'))
+}
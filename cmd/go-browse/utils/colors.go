@@ -0,0 +1,257 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/bern/go-browse/cmd/go-browse/models"
+)
+
+// ParseColor converts a CSS color (hex, rgb(), hsl() or a named color) into a Color
+func ParseColor(s string) (*models.Color, error) {
+	values := trimWhitespace(parseComponentList(s))
+	if len(values) != 1 {
+		return nil, fmt.Errorf("invalid color %s", s)
+	}
+	value := values[0]
+
+	switch {
+	case value.Is(HashToken):
+		color := parseHexColor(value.Token.Value)
+		if color == nil {
+			return nil, fmt.Errorf("invalid hex color %s", value)
+		}
+		return color, nil
+	case value.IsFunction():
+		name := strings.ToLower(value.Token.Value)
+		if !isColorFunction(name) {
+			return nil, fmt.Errorf("unsupported function %s)", value.Token)
+		}
+		return parseColorFunction(name, value.Children)
+	case value.Is(IdentToken):
+		if color, ok := models.NamedColor(strings.ToLower(value.Token.Value)); ok {
+			return &color, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown color %s", s)
+}
+
+// parseHexColor converts the digits of a #rgb, #rgba, #rrggbb or #rrggbbaa color into a Color
+func parseHexColor(hex string) *models.Color {
+	if len(hex) == 3 || len(hex) == 4 {
+		expanded := make([]byte, 0, len(hex)*2)
+		for i := 0; i < len(hex); i++ {
+			expanded = append(expanded, hex[i], hex[i])
+		}
+		hex = string(expanded)
+	}
+
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	if len(hex) != 8 {
+		return nil
+	}
+
+	rgba, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return nil
+	}
+
+	return &models.Color{
+		R: uint8(rgba >> 24),
+		G: uint8(rgba >> 16),
+		B: uint8(rgba >> 8),
+		A: uint8(rgba),
+	}
+}
+
+// isColorFunction returns true for the functional color notations we support
+func isColorFunction(name string) bool {
+	switch name {
+	case "rgb", "rgba", "hsl", "hsla":
+		return true
+	}
+	return false
+}
+
+// parseColorFunction evaluates the arguments of an rgb(), rgba(), hsl() or hsla() color
+func parseColorFunction(name string, args []ComponentValue) (*models.Color, error) {
+	channels, alpha, err := splitColorArguments(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s(): %s", name, err)
+	}
+
+	a := 1.0
+	if alpha != nil {
+		a, err = parseAlpha(*alpha)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s(): %s", name, err)
+		}
+	}
+
+	var r, g, b float64
+	switch name {
+	case "rgb", "rgba":
+		rgb := make([]float64, 3)
+		for i, channel := range channels {
+			rgb[i], err = parseRGBChannel(channel)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s(): %s", name, err)
+			}
+		}
+		r, g, b = rgb[0], rgb[1], rgb[2]
+	case "hsl", "hsla":
+		h, err := parseHue(channels[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s(): %s", name, err)
+		}
+		s, err := parseHSLPercentage(channels[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s(): %s", name, err)
+		}
+		l, err := parseHSLPercentage(channels[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s(): %s", name, err)
+		}
+		r, g, b = hslToRGB(h, s, l)
+	}
+
+	return &models.Color{
+		R: clampChannel(r),
+		G: clampChannel(g),
+		B: clampChannel(b),
+		A: clampChannel(a * 255),
+	}, nil
+}
+
+// splitColorArguments handles both the legacy comma syntax, rgb(1, 2, 3, 0.5),
+// and the modern space syntax, rgb(1 2 3 / 50%)
+func splitColorArguments(args []ComponentValue) ([]CSSToken, *CSSToken, error) {
+	channels := make([]CSSToken, 0)
+	var alpha *CSSToken
+
+	groups := splitOnCommas(args)
+	afterSlash := false
+	for _, group := range groups {
+		for _, arg := range group {
+			switch {
+			case arg.Is(WhitespaceToken):
+				continue
+			case arg.IsDelim("/") && !afterSlash:
+				afterSlash = true
+			case arg.IsFunction() || arg.IsBlock():
+				return nil, nil, fmt.Errorf("unexpected %s", arg)
+			case afterSlash:
+				if alpha != nil {
+					return nil, nil, fmt.Errorf("unexpected %s", arg)
+				}
+				token := arg.Token
+				alpha = &token
+			default:
+				channels = append(channels, arg.Token)
+			}
+		}
+	}
+
+	if len(channels) == 4 && alpha == nil && len(groups) > 1 {
+		alpha = &channels[3]
+		channels = channels[:3]
+	}
+
+	if len(channels) != 3 {
+		return nil, nil, fmt.Errorf("expected 3 channels, found %d", len(channels))
+	}
+	if afterSlash && alpha == nil {
+		return nil, nil, fmt.Errorf("missing alpha after /")
+	}
+
+	return channels, alpha, nil
+}
+
+// parseRGBChannel returns a 0-255 channel value from a number or percentage
+func parseRGBChannel(token CSSToken) (float64, error) {
+	switch {
+	case token.TokenType == NumberToken:
+		return token.Number, nil
+	case token.TokenType == PercentageToken:
+		return token.Number * 255 / 100, nil
+	case isNoneToken(token):
+		return 0, nil
+	}
+	return 0, fmt.Errorf("invalid channel %s", token)
+}
+
+// parseAlpha returns a 0-1 alpha value from a number or percentage
+func parseAlpha(token CSSToken) (float64, error) {
+	switch {
+	case token.TokenType == NumberToken:
+		return token.Number, nil
+	case token.TokenType == PercentageToken:
+		return token.Number / 100, nil
+	case isNoneToken(token):
+		return 0, nil
+	}
+	return 0, fmt.Errorf("invalid alpha %s", token)
+}
+
+// parseHue returns a hue in degrees from a number or an angle
+func parseHue(token CSSToken) (float64, error) {
+	switch {
+	case token.TokenType == NumberToken:
+		return token.Number, nil
+	case token.TokenType == DimensionToken:
+		switch strings.ToLower(token.Unit) {
+		case "deg":
+			return token.Number, nil
+		case "grad":
+			return token.Number * 0.9, nil
+		case "rad":
+			return token.Number * 180 / math.Pi, nil
+		case "turn":
+			return token.Number * 360, nil
+		}
+	case isNoneToken(token):
+		return 0, nil
+	}
+	return 0, fmt.Errorf("invalid hue %s", token)
+}
+
+// parseHSLPercentage returns a 0-1 saturation or lightness value
+func parseHSLPercentage(token CSSToken) (float64, error) {
+	switch {
+	case token.TokenType == PercentageToken || token.TokenType == NumberToken:
+		return math.Max(0, math.Min(100, token.Number)) / 100, nil
+	case isNoneToken(token):
+		return 0, nil
+	}
+	return 0, fmt.Errorf("invalid percentage %s", token)
+}
+
+func isNoneToken(token CSSToken) bool {
+	return token.TokenType == IdentToken && strings.EqualFold(token.Value, "none")
+}
+
+// hslToRGB converts a hue in degrees and a saturation and lightness in 0-1 to 0-255 channels
+func hslToRGB(h, s, l float64) (float64, float64, float64) {
+	h = math.Mod(h, 360)
+	if h < 0 {
+		h += 360
+	}
+
+	channel := func(n float64) float64 {
+		k := math.Mod(n+h/30, 12)
+		a := s * math.Min(l, 1-l)
+		return (l - a*math.Max(-1, math.Min(k-3, math.Min(9-k, 1)))) * 255
+	}
+
+	return channel(0), channel(8), channel(4)
+}
+
+// clampChannel rounds a channel value into the 0-255 range
+func clampChannel(n float64) uint8 {
+	return uint8(math.Round(math.Max(0, math.Min(255, n))))
+}
@@ -1,7 +1,9 @@
 package utils
 
 import (
+	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/bern/go-browse/cmd/go-browse/models"
 )
@@ -10,21 +12,140 @@ import (
 type CSSParser struct {
 	FilePath string
 	Parser   *Parser
+	Tokens   []CSSToken
+	Pos      int
+	Warnings []error
 }
 
-// ParseCSS parses a CSS source file and returns a Stylesheet
+// ComponentValue is a preserved token, a function, or a {}, [] or () block
+type ComponentValue struct {
+	Token    CSSToken         // the preserved token, function token or opening token of a block
+	Children []ComponentValue // the contents of a function or block
+}
+
+// IsFunction returns true if a ComponentValue is a function
+func (c ComponentValue) IsFunction() bool {
+	return c.Token.TokenType == FunctionToken
+}
+
+// IsBlock returns true if a ComponentValue is a {}, [] or () block
+func (c ComponentValue) IsBlock() bool {
+	switch c.Token.TokenType {
+	case OpenCurlyToken, OpenSquareToken, OpenParenToken:
+		return true
+	}
+	return false
+}
+
+// Is returns true if a ComponentValue is a preserved token of the given type
+func (c ComponentValue) Is(tokenType CSSTokenType) bool {
+	return c.Token.TokenType == tokenType
+}
+
+// IsDelim returns true if a ComponentValue is the given delimiter
+func (c ComponentValue) IsDelim(delim string) bool {
+	return c.Token.TokenType == DelimToken && c.Token.Value == delim
+}
+
+// String serializes a ComponentValue back into CSS
+func (c ComponentValue) String() string {
+	if !c.IsFunction() && !c.IsBlock() {
+		return c.Token.String()
+	}
+
+	closing := ")"
+	switch c.Token.TokenType {
+	case OpenCurlyToken:
+		closing = "}"
+	case OpenSquareToken:
+		closing = "]"
+	}
+	return c.Token.String() + serializeComponentValues(c.Children) + closing
+}
+
+func serializeComponentValues(values []ComponentValue) string {
+	var sb strings.Builder
+	for _, value := range values {
+		sb.WriteString(value.String())
+	}
+	return sb.String()
+}
+
+// ParseCSS parses a CSS source file and returns an author Stylesheet. Invalid rules
+// and declarations are dropped following the CSS Syntax error-recovery rules and
+// recorded as warnings on the Stylesheet.
 func ParseCSS(filepath, src string) models.Stylesheet {
+	parser := newCSSParser(filepath, src)
+	stylesheet := parser.ParseRules()
+	stylesheet.Origin = models.AuthorOrigin
+	return stylesheet
+}
+
+// newCSSParser tokenizes a CSS source, recording any tokenizer errors as warnings
+func newCSSParser(filepath, src string) *CSSParser {
+	input := preprocessCSS(src)
+	tokens, tokenErrors := TokenizeCSS(input)
+
 	parser := &CSSParser{
 		FilePath: filepath,
 		Parser: &Parser{
-			Input: src,
+			Input: input,
 			Pos:   0,
 		},
+		Tokens:   tokens,
+		Warnings: make([]error, 0),
 	}
 
-	stylesheet := parser.ParseRules()
+	for _, offset := range tokenErrors {
+		parser.warn(offset, "malformed token")
+	}
 
-	return stylesheet
+	return parser
+}
+
+// warn records a recoverable parse error at an offset into the source
+func (p *CSSParser) warn(offset int, message string) {
+	p.Warnings = append(p.Warnings, messageError(p.FilePath, p.Parser, offset, message))
+}
+
+// sortedWarnings returns the parser's warnings in source order
+func (p *CSSParser) sortedWarnings() []error {
+	sort.SliceStable(p.Warnings, func(i, j int) bool {
+		a, b := p.Warnings[i].(*ParseError), p.Warnings[j].(*ParseError)
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return p.Warnings
+}
+
+// nextToken returns the token at the parser's position without consuming it
+func (p *CSSParser) nextToken() CSSToken {
+	return p.Tokens[p.Pos]
+}
+
+// consumeToken advances the parser and returns the consumed token
+func (p *CSSParser) consumeToken() CSSToken {
+	token := p.Tokens[p.Pos]
+	if token.TokenType != EOFToken {
+		p.Pos++
+	}
+	return token
+}
+
+// ParseStyleAttribute parses the contents of an element's style attribute as a declaration
+// block, returning the declarations along with any warnings for the ones that were dropped
+func ParseStyleAttribute(src string) ([]models.Declaration, []error) {
+	parser := newCSSParser("style attribute", src)
+
+	values := make([]ComponentValue, 0)
+	for parser.nextToken().TokenType != EOFToken {
+		values = append(values, parser.consumeComponentValue())
+	}
+
+	declarations := parser.ParseDeclarations(values)
+	return declarations, parser.sortedWarnings()
 }
 
 // ParseRules crawls down a CSS file parsing each rule as it is encountered
@@ -34,151 +155,439 @@ func (p *CSSParser) ParseRules() models.Stylesheet {
 	}
 
 	for {
-		p.Parser.ConsumeWhitespace()
+		token := p.nextToken()
+
+		switch token.TokenType {
+		case WhitespaceToken, CDOToken, CDCToken:
+			p.consumeToken()
+			continue
+		case EOFToken:
+			stylesheet.Warnings = p.sortedWarnings()
+			return stylesheet
+		case AtKeywordToken:
+			p.ParseAtRule()
+			continue
+		}
 
-		if p.Parser.EOF() {
-			break
+		rule := p.ParseQualifiedRule()
+		if rule != nil {
+			stylesheet.Rules = append(stylesheet.Rules, *rule)
 		}
+	}
+}
 
-		// parse selector
-		selectors := p.ParseSelectors()
+// ParseAtRule consumes an at-rule. None are supported yet, so they are dropped.
+func (p *CSSParser) ParseAtRule() {
+	atKeyword := p.consumeToken()
 
-		// parse declarations
-		declarations := p.ParseDeclarations()
+	for {
+		token := p.nextToken()
+		switch token.TokenType {
+		case SemicolonToken:
+			p.consumeToken()
+			p.dropAtRule(atKeyword)
+			return
+		case EOFToken:
+			p.warn(token.Pos, "unexpected end of file in @"+atKeyword.Value)
+			return
+		case OpenCurlyToken:
+			p.consumeComponentValue()
+			p.dropAtRule(atKeyword)
+			return
+		}
+		p.consumeComponentValue()
+	}
+}
 
-		// create a rule
-		stylesheet.Rules = append(stylesheet.Rules, models.Rule{
-			Selectors:    selectors,
-			Declarations: declarations,
-		})
+func (p *CSSParser) dropAtRule(atKeyword CSSToken) {
+	if strings.EqualFold(atKeyword.Value, "charset") {
+		return
 	}
+	p.warn(atKeyword.Pos, "unsupported at-rule @"+atKeyword.Value)
+}
 
-	return stylesheet
+// ParseQualifiedRule consumes a selector prelude and its declaration block,
+// returning nil if the rule is invalid
+func (p *CSSParser) ParseQualifiedRule() *models.Rule {
+	start := p.nextToken().Pos
+	prelude := make([]ComponentValue, 0)
+
+	for {
+		token := p.nextToken()
+		switch token.TokenType {
+		case EOFToken:
+			p.warn(token.Pos, "unexpected end of file in rule, expected {")
+			return nil
+		case OpenCurlyToken:
+			block := p.consumeComponentValue()
+
+			selectors, err := p.ParseSelectors(prelude)
+			if err != nil {
+				p.warn(start, "dropped rule with invalid selector: "+err.Error())
+				return nil
+			}
+
+			return &models.Rule{
+				Selectors:    selectors,
+				Declarations: p.ParseDeclarations(block.Children),
+			}
+		}
+		prelude = append(prelude, p.consumeComponentValue())
+	}
 }
 
-// ParseSelectors parses all comma-delimited simple selectors in a rule
-func (p *CSSParser) ParseSelectors() []models.Selector {
-	selectors := make([]models.Selector, 0)
+// consumeComponentValue consumes a preserved token, a function or a block
+func (p *CSSParser) consumeComponentValue() ComponentValue {
+	token := p.consumeToken()
+
+	switch token.TokenType {
+	case OpenCurlyToken:
+		return p.consumeBlock(token, CloseCurlyToken)
+	case OpenSquareToken:
+		return p.consumeBlock(token, CloseSquareToken)
+	case OpenParenToken, FunctionToken:
+		return p.consumeBlock(token, CloseParenToken)
+	}
+
+	return ComponentValue{Token: token}
+}
+
+// consumeBlock consumes the contents of a function or block up to its closing token
+func (p *CSSParser) consumeBlock(opening CSSToken, closing CSSTokenType) ComponentValue {
+	block := ComponentValue{
+		Token:    opening,
+		Children: make([]ComponentValue, 0),
+	}
 
 	for {
-		p.Parser.ConsumeWhitespace()
+		token := p.nextToken()
+		switch token.TokenType {
+		case closing:
+			p.consumeToken()
+			return block
+		case EOFToken:
+			p.warn(token.Pos, "unexpected end of file, expected "+CSSToken{TokenType: closing}.String())
+			return block
+		}
+		block.Children = append(block.Children, p.consumeComponentValue())
+	}
+}
 
-		if p.Parser.EOF() || p.Parser.NextChar() == "{" {
-			break
+// ParseSelectors parses all comma-delimited simple selectors in a rule's prelude
+func (p *CSSParser) ParseSelectors(prelude []ComponentValue) ([]models.Selector, error) {
+	selectors := make([]models.Selector, 0)
+
+	for _, group := range splitOnCommas(prelude) {
+		selector, err := p.ParseSelector(trimWhitespace(group))
+		if err != nil {
+			return nil, err
 		}
+		selectors = append(selectors, selector)
+	}
 
-		if p.Parser.NextChar() == "," {
-			p.Parser.ConsumeChar() // ,
-			p.Parser.ConsumeWhitespace()
+	sort.Sort(BySpecificity(selectors))
+	return selectors, nil
+}
+
+// ParseSelector breaks a complex selector down into compound selectors joined by combinators
+func (p *CSSParser) ParseSelector(values []ComponentValue) (models.Selector, error) {
+	selector := models.Selector{
+		Parts: make([]models.SelectorPart, 0),
+	}
+
+	if len(values) == 0 {
+		return selector, fmt.Errorf("empty selector")
+	}
+
+	combinator := models.Descendant
+	for i := 0; i < len(values); {
+		compound, next, err := p.ParseCompoundSelector(values, i)
+		if err != nil {
+			return models.Selector{}, err
 		}
+		selector.Parts = append(selector.Parts, models.SelectorPart{
+			Combinator: combinator,
+			Compound:   compound,
+		})
+		i = next
 
-		selectors = append(selectors, p.ParseSelector())
+		// whitespace alone is a descendant combinator, but it may also surround >, + or ~
+		combinator = models.Descendant
+		for i < len(values) && values[i].Is(WhitespaceToken) {
+			i++
+		}
+		if i < len(values) {
+			if explicit, ok := parseCombinator(values[i]); ok {
+				combinator = explicit
+				i++
+				for i < len(values) && values[i].Is(WhitespaceToken) {
+					i++
+				}
+				if i == len(values) {
+					return models.Selector{}, fmt.Errorf("selector ends with combinator %s", values[i-1])
+				}
+			}
+		}
 	}
 
-	sort.Sort(BySpecificity(selectors))
-	return selectors
+	return selector, nil
+}
+
+// parseCombinator returns the combinator a delimiter stands for, if any
+func parseCombinator(value ComponentValue) (models.Combinator, bool) {
+	switch {
+	case value.IsDelim(">"):
+		return models.Child, true
+	case value.IsDelim("+"):
+		return models.NextSibling, true
+	case value.IsDelim("~"):
+		return models.SubsequentSibling, true
+	}
+	return models.Descendant, false
 }
 
-// ParseSelector looks at a selector a breaks it down by type, id, and classes
-func (p *CSSParser) ParseSelector() models.Selector {
+func isCombinator(value ComponentValue) bool {
+	_, ok := parseCombinator(value)
+	return ok
+}
+
+// ParseCompoundSelector parses the type, id, and class selectors of one compound selector
+// starting at values[i], returning the index just past it
+func (p *CSSParser) ParseCompoundSelector(values []ComponentValue, i int) (models.CompoundSelector, int, error) {
 	/*
-		A simple selector is either a type selector or universal selector
+		A compound selector is either a type selector or universal selector
 		followed immediately by zero or more attribute selectors, ID selectors,
 		or pseudo-classes, in any order.
 	*/
 
-	selector := models.Selector{}
+	compound := models.CompoundSelector{}
+	start := i
 
-	// if the first character is neither a . nor a # nor a * then it is the type selector
-	if p.Parser.NextChar() != "." && p.Parser.NextChar() != "#" && p.Parser.NextChar() != "*" {
-		tagName := p.Parser.ConsumeWhile(func(s string) bool {
-			return s != "." && s != "#" && s != "*" && s != "," && s != " " && s != "\n" && s != "\t" && s != "{"
-		})
-		selector.TagName = &tagName
+	// the type selector or universal selector, if present, comes first
+	if values[i].Is(IdentToken) {
+		tagName := strings.ToLower(values[i].Token.Value)
+		compound.TagName = &tagName
+		i++
+	} else if values[i].IsDelim("*") {
+		i++
 	}
 
 	classes := make([]string, 0)
 
-	for {
-		p.Parser.ConsumeWhitespace()
-		if p.Parser.NextChar() == "{" || p.Parser.NextChar() == "," {
-			break
-		}
-
-		switch p.Parser.NextChar() {
-		case ".":
-			p.Parser.ConsumeChar() // .
-			className := p.ConsumeSelectorComponent()
-
-			classes = append(classes, className)
-			break
-		case "#":
-			p.Parser.ConsumeChar() // #
-			idName := p.ConsumeSelectorComponent()
-
-			selector.ID = &idName
-			break
-		case "*":
-			p.Parser.ConsumeChar() // *
-			break
+	for i < len(values) && !values[i].Is(WhitespaceToken) && !isCombinator(values[i]) {
+		value := values[i]
+
+		switch {
+		case value.IsDelim(".") && i+1 < len(values) && values[i+1].Is(IdentToken):
+			classes = append(classes, values[i+1].Token.Value)
+			i += 2
+		case value.Is(HashToken) && value.Token.IsID:
+			idName := value.Token.Value
+			compound.ID = &idName
+			i++
+		case value.Is(OpenSquareToken):
+			attribute, err := p.ParseAttributeSelector(value)
+			if err != nil {
+				return models.CompoundSelector{}, i, err
+			}
+			compound.Attributes = append(compound.Attributes, attribute)
+			i++
+		case value.Is(ColonToken):
+			pseudoClass, next, err := p.ParsePseudoClass(values, i)
+			if err != nil {
+				return models.CompoundSelector{}, i, err
+			}
+			compound.PseudoClasses = append(compound.PseudoClasses, pseudoClass)
+			i = next
 		default: // unrecognized
+			return models.CompoundSelector{}, i, fmt.Errorf("unsupported selector component %s", value)
 		}
 	}
 
+	if i == start {
+		return models.CompoundSelector{}, i, fmt.Errorf("expected a selector but found %s", values[i])
+	}
+
 	if len(classes) > 0 {
-		selector.Classes = &classes
+		compound.Classes = &classes
 	}
 
-	return selector
+	return compound, i, nil
 }
 
-// ConsumeSelectorComponent grabs the name of a component that is part of a simple selector
-func (p *CSSParser) ConsumeSelectorComponent() string {
-	return p.Parser.ConsumeWhile(func(s string) bool {
-		return s != "." && s != "#" && s != "{" && s != " " && s != "\n" && s != "\t" && s != ","
-	})
+// attributeMatchers maps the delimiter before = in an attribute selector to its matcher
+var attributeMatchers = map[string]models.AttributeMatcher{
+	"~": models.AttributeIncludes,
+	"|": models.AttributeDashMatch,
+	"^": models.AttributePrefix,
+	"$": models.AttributeSuffix,
+	"*": models.AttributeSubstring,
 }
 
-// ParseDeclarations parses all semicolon-delimited declarations in a rule
-func (p *CSSParser) ParseDeclarations() []models.Declaration {
+// ParseAttributeSelector parses the contents of a [] block in a selector, like [lang|=en]
+func (p *CSSParser) ParseAttributeSelector(block ComponentValue) (models.AttributeSelector, error) {
+	values := trimWhitespace(block.Children)
+	if len(values) == 0 || !values[0].Is(IdentToken) {
+		return models.AttributeSelector{}, fmt.Errorf("expected an attribute name in %s", block)
+	}
+
+	attribute := models.AttributeSelector{
+		Name:    strings.ToLower(values[0].Token.Value),
+		Matcher: models.AttributeExists,
+	}
+	values = trimWhitespace(values[1:])
+	if len(values) == 0 {
+		return attribute, nil
+	}
+
+	// the matcher is = on its own or one of ~|^$* immediately followed by =
+	switch {
+	case values[0].IsDelim("="):
+		attribute.Matcher = models.AttributeEquals
+		values = values[1:]
+	case values[0].Is(DelimToken) && len(values) > 1 && values[1].IsDelim("="):
+		matcher, ok := attributeMatchers[values[0].Token.Value]
+		if !ok {
+			return models.AttributeSelector{}, fmt.Errorf("unsupported attribute matcher %s= in %s", values[0], block)
+		}
+		attribute.Matcher = matcher
+		values = values[2:]
+	default:
+		return models.AttributeSelector{}, fmt.Errorf("unsupported attribute selector %s", block)
+	}
+
+	values = trimWhitespace(values)
+	if len(values) == 0 || !(values[0].Is(IdentToken) || values[0].Is(StringToken)) {
+		return models.AttributeSelector{}, fmt.Errorf("expected an attribute value in %s", block)
+	}
+	attribute.Value = values[0].Token.Value
+	values = trimWhitespace(values[1:])
+
+	if len(values) == 0 {
+		return attribute, nil
+	}
+	if len(values) == 1 && values[0].Is(IdentToken) {
+		switch strings.ToLower(values[0].Token.Value) {
+		case "i":
+			attribute.CaseInsensitive = true
+			return attribute, nil
+		case "s":
+			return attribute, nil
+		}
+	}
+	return models.AttributeSelector{}, fmt.Errorf("unexpected %s in %s", serializeComponentValues(values), block)
+}
+
+// ParseDeclarations parses all semicolon-delimited declarations in a rule's block
+func (p *CSSParser) ParseDeclarations(values []ComponentValue) []models.Declaration {
 	declarations := make([]models.Declaration, 0)
 
-	p.Parser.ConsumeChar() // {
-	for {
-		p.Parser.ConsumeWhitespace()
+	for i := 0; i < len(values); i++ {
+		value := values[i]
+
+		switch {
+		case value.Is(WhitespaceToken) || value.Is(SemicolonToken):
+			continue
+		case value.Is(AtKeywordToken):
+			// at-rules nested in declaration blocks run to the next ; or {} block
+			for i < len(values) && !values[i].Is(SemicolonToken) && !values[i].Is(OpenCurlyToken) {
+				i++
+			}
+			p.warn(value.Token.Pos, "unsupported at-rule @"+value.Token.Value)
+			continue
+		}
 
-		if p.Parser.EOF() { // TODO: check if this should throw an error??
-			break
-		} else if p.Parser.NextChar() == "}" {
-			p.Parser.ConsumeChar() // }
-			break
+		// a declaration runs until the next top-level ;
+		end := i
+		for end < len(values) && !values[end].Is(SemicolonToken) {
+			end++
 		}
 
-		declaration := p.ParseDeclaration()
-		declarations = append(declarations, declaration)
+		if !value.Is(IdentToken) {
+			p.warn(value.Token.Pos, "dropped declaration: expected a property name but found "+value.String())
+			i = end
+			continue
+		}
+
+		declaration, err := p.ParseDeclaration(values[i:end])
+		if err != nil {
+			p.warn(value.Token.Pos, "dropped declaration: "+err.Error())
+		} else {
+			declarations = append(declarations, declaration)
+		}
+		i = end
 	}
 
 	return declarations
 }
 
-// ParseDeclaration splits a declaration into a name and a value
-func (p *CSSParser) ParseDeclaration() models.Declaration {
-	name := p.Parser.ConsumeWhile(func(s string) bool {
-		return s != ":"
-	})
+// ParseDeclaration splits a declaration into a name and a typed value
+func (p *CSSParser) ParseDeclaration(values []ComponentValue) (models.Declaration, error) {
+	name := strings.ToLower(values[0].Token.Value)
+	rest := trimWhitespace(values[1:])
 
-	p.Parser.ConsumeChar() // :
-	p.Parser.ConsumeWhitespace()
+	if len(rest) == 0 || !rest[0].Is(ColonToken) {
+		return models.Declaration{}, fmt.Errorf("expected : after %s", name)
+	}
 
-	// TODO: support a number, a string, a percentage, or a hex color code
-	value := p.Parser.ConsumeWhile(func(s string) bool {
-		return s != ";"
-	})
+	valueTokens, important := stripImportant(trimWhitespace(rest[1:]))
+	value, err := ParseComponentValues(valueTokens)
+	if err != nil {
+		return models.Declaration{}, fmt.Errorf("invalid value for %s: %s", name, err)
+	}
+
+	declaration := models.Declaration{
+		Name:      name,
+		Value:     value,
+		Important: important,
+	}
+
+	// shorthands are expanded during the cascade, but invalid ones are dropped here
+	if _, err := ExpandShorthand(declaration); err != nil {
+		return models.Declaration{}, fmt.Errorf("invalid value for %s: %s", name, err)
+	}
+
+	return declaration, nil
+}
+
+// stripImportant removes a trailing !important from a declaration's value
+func stripImportant(values []ComponentValue) ([]ComponentValue, bool) {
+	n := len(values)
+	if n == 0 || !values[n-1].Is(IdentToken) || !strings.EqualFold(values[n-1].Token.Value, "important") {
+		return values, false
+	}
+
+	rest := trimWhitespace(values[:n-1])
+	if len(rest) == 0 || !rest[len(rest)-1].IsDelim("!") {
+		return values, false
+	}
+	return trimWhitespace(rest[:len(rest)-1]), true
+}
+
+// splitOnCommas splits a list of component values on its top-level commas
+func splitOnCommas(values []ComponentValue) [][]ComponentValue {
+	groups := make([][]ComponentValue, 0)
+	group := make([]ComponentValue, 0)
+
+	for _, value := range values {
+		if value.Is(CommaToken) {
+			groups = append(groups, group)
+			group = make([]ComponentValue, 0)
+			continue
+		}
+		group = append(group, value)
+	}
 
-	p.Parser.ConsumeChar() // ;
+	return append(groups, group)
+}
 
-	return models.Declaration{
-		Name:  name,
-		Value: value,
+// trimWhitespace removes whitespace tokens from both ends of a list of component values
+func trimWhitespace(values []ComponentValue) []ComponentValue {
+	for len(values) > 0 && values[0].Is(WhitespaceToken) {
+		values = values[1:]
+	}
+	for len(values) > 0 && values[len(values)-1].Is(WhitespaceToken) {
+		values = values[:len(values)-1]
 	}
+	return values
 }
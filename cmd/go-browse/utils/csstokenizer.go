@@ -0,0 +1,586 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// CSSTokenType is an enum of the tokens defined by CSS Syntax Level 3
+type CSSTokenType int
+
+const (
+	// IdentToken is an identifier such as color or auto
+	IdentToken CSSTokenType = iota
+	// FunctionToken is an identifier immediately followed by (
+	FunctionToken
+	// AtKeywordToken is an @ followed by an identifier
+	AtKeywordToken
+	// HashToken is a # followed by a name
+	HashToken
+	// StringToken is a quoted string
+	StringToken
+	// BadStringToken is a string interrupted by a newline
+	BadStringToken
+	// URLToken is an unquoted url(...)
+	URLToken
+	// BadURLToken is a url(...) containing invalid characters
+	BadURLToken
+	// DelimToken is any single code point that isn't part of another token
+	DelimToken
+	// NumberToken is a unitless number
+	NumberToken
+	// PercentageToken is a number followed by %
+	PercentageToken
+	// DimensionToken is a number followed by a unit
+	DimensionToken
+	// WhitespaceToken is a run of whitespace
+	WhitespaceToken
+	// CDOToken is <!--
+	CDOToken
+	// CDCToken is -->
+	CDCToken
+	// ColonToken is :
+	ColonToken
+	// SemicolonToken is ;
+	SemicolonToken
+	// CommaToken is ,
+	CommaToken
+	// OpenSquareToken is [
+	OpenSquareToken
+	// CloseSquareToken is ]
+	CloseSquareToken
+	// OpenParenToken is (
+	OpenParenToken
+	// CloseParenToken is )
+	CloseParenToken
+	// OpenCurlyToken is {
+	OpenCurlyToken
+	// CloseCurlyToken is }
+	CloseCurlyToken
+	// EOFToken marks the end of the input
+	EOFToken
+)
+
+// CSSToken is a single token produced by the CSSTokenizer
+type CSSToken struct {
+	TokenType CSSTokenType
+	Value     string  // the name, string contents, url or delimiter
+	Number    float64 // NumberToken, PercentageToken and DimensionToken
+	IsInteger bool    // true if the number was written without a fraction or exponent
+	Unit      string  // DimensionToken
+	IsID      bool    // HashToken whose name would also be a valid identifier
+	Pos       int     // byte offset of the token in the source
+}
+
+// String serializes a token back into CSS
+func (t CSSToken) String() string {
+	switch t.TokenType {
+	case IdentToken:
+		return t.Value
+	case FunctionToken:
+		return t.Value + "("
+	case AtKeywordToken:
+		return "@" + t.Value
+	case HashToken:
+		return "#" + t.Value
+	case StringToken, BadStringToken:
+		return strconv.Quote(t.Value)
+	case URLToken, BadURLToken:
+		return "url(" + t.Value + ")"
+	case DelimToken:
+		return t.Value
+	case NumberToken:
+		return formatTokenNumber(t.Number)
+	case PercentageToken:
+		return formatTokenNumber(t.Number) + "%"
+	case DimensionToken:
+		return formatTokenNumber(t.Number) + t.Unit
+	case WhitespaceToken:
+		return " "
+	case CDOToken:
+		return "<!--"
+	case CDCToken:
+		return "-->"
+	case ColonToken:
+		return ":"
+	case SemicolonToken:
+		return ";"
+	case CommaToken:
+		return ","
+	case OpenSquareToken:
+		return "["
+	case CloseSquareToken:
+		return "]"
+	case OpenParenToken:
+		return "("
+	case CloseParenToken:
+		return ")"
+	case OpenCurlyToken:
+		return "{"
+	case CloseCurlyToken:
+		return "}"
+	}
+	return ""
+}
+
+func formatTokenNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// CSSTokenizer splits CSS source text into tokens
+type CSSTokenizer struct {
+	Input  string
+	Pos    int
+	Errors []int // offsets of the parse errors found while tokenizing
+}
+
+// TokenizeCSS returns every token in a CSS source string, ending with an EOFToken
+func TokenizeCSS(src string) ([]CSSToken, []int) {
+	tokenizer := &CSSTokenizer{
+		Input: preprocessCSS(src),
+	}
+
+	tokens := make([]CSSToken, 0)
+	for {
+		token := tokenizer.ConsumeToken()
+		tokens = append(tokens, token)
+		if token.TokenType == EOFToken {
+			break
+		}
+	}
+
+	return tokens, tokenizer.Errors
+}
+
+// preprocessCSS normalizes newlines and replaces NULL code points
+func preprocessCSS(src string) string {
+	src = strings.Replace(src, "\r\n", "\n", -1)
+	src = strings.Replace(src, "\r", "\n", -1)
+	src = strings.Replace(src, "\f", "\n", -1)
+	return strings.Replace(src, "\x00", "\uFFFD", -1)
+}
+
+// peek returns the code point n code points past the current position, or -1 at EOF
+func (t *CSSTokenizer) peek(n int) rune {
+	pos := t.Pos
+	for i := 0; i < n; i++ {
+		if pos >= len(t.Input) {
+			return -1
+		}
+		_, size := utf8.DecodeRuneInString(t.Input[pos:])
+		pos += size
+	}
+
+	if pos >= len(t.Input) {
+		return -1
+	}
+	r, _ := utf8.DecodeRuneInString(t.Input[pos:])
+	return r
+}
+
+// consume advances past the next code point and returns it, or -1 at EOF
+func (t *CSSTokenizer) consume() rune {
+	if t.Pos >= len(t.Input) {
+		return -1
+	}
+	r, size := utf8.DecodeRuneInString(t.Input[t.Pos:])
+	t.Pos += size
+	return r
+}
+
+// reconsume steps back over the code point consume just returned. An invalid byte decodes as
+// U+FFFD, which is longer than the byte itself, so the step is the size of what was decoded.
+func (t *CSSTokenizer) reconsume() {
+	_, size := utf8.DecodeLastRuneInString(t.Input[:t.Pos])
+	t.Pos -= size
+}
+
+func (t *CSSTokenizer) parseError() {
+	t.Errors = append(t.Errors, t.Pos)
+}
+
+// ConsumeToken consumes and returns the next token in the input
+func (t *CSSTokenizer) ConsumeToken() CSSToken {
+	t.consumeComments()
+
+	start := t.Pos
+	token := t.consumeTokenBody()
+	token.Pos = start
+	return token
+}
+
+func (t *CSSTokenizer) consumeTokenBody() CSSToken {
+	c := t.consume()
+
+	switch {
+	case c == -1:
+		return CSSToken{TokenType: EOFToken}
+	case isCSSWhitespace(c):
+		for isCSSWhitespace(t.peek(0)) {
+			t.consume()
+		}
+		return CSSToken{TokenType: WhitespaceToken}
+	case c == '"' || c == '\'':
+		return t.consumeString(c)
+	case c == '#':
+		if isNameCodePoint(t.peek(0)) || isValidEscape(t.peek(0), t.peek(1)) {
+			isID := wouldStartIdentifier(t.peek(0), t.peek(1), t.peek(2))
+			return CSSToken{TokenType: HashToken, Value: t.consumeName(), IsID: isID}
+		}
+		return delim(c)
+	case c == '(':
+		return CSSToken{TokenType: OpenParenToken}
+	case c == ')':
+		return CSSToken{TokenType: CloseParenToken}
+	case c == '+':
+		if wouldStartNumber(c, t.peek(0), t.peek(1)) {
+			t.Pos--
+			return t.consumeNumeric()
+		}
+		return delim(c)
+	case c == ',':
+		return CSSToken{TokenType: CommaToken}
+	case c == '-':
+		if wouldStartNumber(c, t.peek(0), t.peek(1)) {
+			t.Pos--
+			return t.consumeNumeric()
+		}
+		if t.peek(0) == '-' && t.peek(1) == '>' {
+			t.consume()
+			t.consume()
+			return CSSToken{TokenType: CDCToken}
+		}
+		if wouldStartIdentifier(c, t.peek(0), t.peek(1)) {
+			t.Pos--
+			return t.consumeIdentLike()
+		}
+		return delim(c)
+	case c == '.':
+		if wouldStartNumber(c, t.peek(0), t.peek(1)) {
+			t.Pos--
+			return t.consumeNumeric()
+		}
+		return delim(c)
+	case c == ':':
+		return CSSToken{TokenType: ColonToken}
+	case c == ';':
+		return CSSToken{TokenType: SemicolonToken}
+	case c == '<':
+		if t.peek(0) == '!' && t.peek(1) == '-' && t.peek(2) == '-' {
+			t.consume()
+			t.consume()
+			t.consume()
+			return CSSToken{TokenType: CDOToken}
+		}
+		return delim(c)
+	case c == '@':
+		if wouldStartIdentifier(t.peek(0), t.peek(1), t.peek(2)) {
+			return CSSToken{TokenType: AtKeywordToken, Value: t.consumeName()}
+		}
+		return delim(c)
+	case c == '[':
+		return CSSToken{TokenType: OpenSquareToken}
+	case c == '\\':
+		if isValidEscape(c, t.peek(0)) {
+			t.Pos--
+			return t.consumeIdentLike()
+		}
+		t.parseError()
+		return delim(c)
+	case c == ']':
+		return CSSToken{TokenType: CloseSquareToken}
+	case c == '{':
+		return CSSToken{TokenType: OpenCurlyToken}
+	case c == '}':
+		return CSSToken{TokenType: CloseCurlyToken}
+	case isCSSDigit(c):
+		t.Pos--
+		return t.consumeNumeric()
+	case isNameStartCodePoint(c):
+		t.reconsume()
+		return t.consumeIdentLike()
+	}
+
+	return delim(c)
+}
+
+func delim(c rune) CSSToken {
+	return CSSToken{TokenType: DelimToken, Value: string(c)}
+}
+
+// consumeComments skips over any /* */ comments at the current position
+func (t *CSSTokenizer) consumeComments() {
+	for strings.HasPrefix(t.Input[t.Pos:], "/*") {
+		end := strings.Index(t.Input[t.Pos+2:], "*/")
+		if end < 0 {
+			t.Pos = len(t.Input)
+			t.parseError()
+			return
+		}
+		t.Pos += end + 4
+	}
+}
+
+// consumeNumeric consumes a number, percentage or dimension token
+func (t *CSSTokenizer) consumeNumeric() CSSToken {
+	number, isInteger := t.consumeNumber()
+
+	if wouldStartIdentifier(t.peek(0), t.peek(1), t.peek(2)) {
+		return CSSToken{TokenType: DimensionToken, Number: number, IsInteger: isInteger, Unit: t.consumeName()}
+	}
+
+	if t.peek(0) == '%' {
+		t.consume()
+		return CSSToken{TokenType: PercentageToken, Number: number, IsInteger: isInteger}
+	}
+
+	return CSSToken{TokenType: NumberToken, Number: number, IsInteger: isInteger}
+}
+
+// consumeNumber consumes the digits of a number and converts them
+func (t *CSSTokenizer) consumeNumber() (float64, bool) {
+	start := t.Pos
+	isInteger := true
+
+	if t.peek(0) == '+' || t.peek(0) == '-' {
+		t.consume()
+	}
+	for isCSSDigit(t.peek(0)) {
+		t.consume()
+	}
+	if t.peek(0) == '.' && isCSSDigit(t.peek(1)) {
+		t.consume()
+		for isCSSDigit(t.peek(0)) {
+			t.consume()
+		}
+		isInteger = false
+	}
+	if (t.peek(0) == 'e' || t.peek(0) == 'E') &&
+		(isCSSDigit(t.peek(1)) || ((t.peek(1) == '+' || t.peek(1) == '-') && isCSSDigit(t.peek(2)))) {
+		t.consume()
+		if t.peek(0) == '+' || t.peek(0) == '-' {
+			t.consume()
+		}
+		for isCSSDigit(t.peek(0)) {
+			t.consume()
+		}
+		isInteger = false
+	}
+
+	number, _ := strconv.ParseFloat(t.Input[start:t.Pos], 64)
+	return number, isInteger
+}
+
+// consumeIdentLike consumes an ident, function or url token
+func (t *CSSTokenizer) consumeIdentLike() CSSToken {
+	name := t.consumeName()
+
+	if strings.EqualFold(name, "url") && t.peek(0) == '(' {
+		t.consume()
+		for isCSSWhitespace(t.peek(0)) && isCSSWhitespace(t.peek(1)) {
+			t.consume()
+		}
+		next := t.peek(0)
+		if isCSSWhitespace(next) {
+			next = t.peek(1)
+		}
+		if next == '"' || next == '\'' {
+			return CSSToken{TokenType: FunctionToken, Value: name}
+		}
+		return t.consumeURL()
+	}
+
+	if t.peek(0) == '(' {
+		t.consume()
+		return CSSToken{TokenType: FunctionToken, Value: name}
+	}
+
+	return CSSToken{TokenType: IdentToken, Value: name}
+}
+
+// consumeString consumes a string token ending with the given quote
+func (t *CSSTokenizer) consumeString(quote rune) CSSToken {
+	var sb strings.Builder
+
+	for {
+		c := t.consume()
+		switch {
+		case c == quote:
+			return CSSToken{TokenType: StringToken, Value: sb.String()}
+		case c == -1:
+			t.parseError()
+			return CSSToken{TokenType: StringToken, Value: sb.String()}
+		case c == '\n':
+			t.parseError()
+			t.Pos--
+			return CSSToken{TokenType: BadStringToken, Value: sb.String()}
+		case c == '\\':
+			if t.peek(0) == -1 {
+				continue
+			}
+			if t.peek(0) == '\n' {
+				t.consume()
+				continue
+			}
+			sb.WriteRune(t.consumeEscape())
+		default:
+			sb.WriteRune(c)
+		}
+	}
+}
+
+// consumeURL consumes the remainder of an unquoted url(...)
+func (t *CSSTokenizer) consumeURL() CSSToken {
+	var sb strings.Builder
+
+	for isCSSWhitespace(t.peek(0)) {
+		t.consume()
+	}
+
+	for {
+		c := t.consume()
+		switch {
+		case c == ')':
+			return CSSToken{TokenType: URLToken, Value: sb.String()}
+		case c == -1:
+			t.parseError()
+			return CSSToken{TokenType: URLToken, Value: sb.String()}
+		case isCSSWhitespace(c):
+			for isCSSWhitespace(t.peek(0)) {
+				t.consume()
+			}
+			if t.peek(0) == ')' || t.peek(0) == -1 {
+				if t.consume() == -1 {
+					t.parseError()
+				}
+				return CSSToken{TokenType: URLToken, Value: sb.String()}
+			}
+			t.consumeBadURLRemnants()
+			return CSSToken{TokenType: BadURLToken}
+		case c == '"' || c == '\'' || c == '(' || isNonPrintable(c):
+			t.parseError()
+			t.consumeBadURLRemnants()
+			return CSSToken{TokenType: BadURLToken}
+		case c == '\\':
+			if isValidEscape(c, t.peek(0)) {
+				sb.WriteRune(t.consumeEscape())
+				continue
+			}
+			t.parseError()
+			t.consumeBadURLRemnants()
+			return CSSToken{TokenType: BadURLToken}
+		default:
+			sb.WriteRune(c)
+		}
+	}
+}
+
+// consumeBadURLRemnants skips the rest of an invalid url(...)
+func (t *CSSTokenizer) consumeBadURLRemnants() {
+	for {
+		c := t.consume()
+		if c == ')' || c == -1 {
+			return
+		}
+		if isValidEscape(c, t.peek(0)) {
+			t.consumeEscape()
+		}
+	}
+}
+
+// consumeEscape consumes an escaped code point, assuming the \ was already consumed
+func (t *CSSTokenizer) consumeEscape() rune {
+	c := t.consume()
+
+	if c == -1 {
+		t.parseError()
+		return utf8.RuneError
+	}
+
+	if !isCSSHexDigit(c) {
+		return c
+	}
+
+	hex := string(c)
+	for len(hex) < 6 && isCSSHexDigit(t.peek(0)) {
+		hex += string(t.consume())
+	}
+	if isCSSWhitespace(t.peek(0)) {
+		t.consume()
+	}
+
+	value, _ := strconv.ParseUint(hex, 16, 32)
+	if value == 0 || (value >= 0xD800 && value <= 0xDFFF) || value > utf8.MaxRune {
+		return utf8.RuneError
+	}
+	return rune(value)
+}
+
+// consumeName consumes a sequence of name code points and escapes
+func (t *CSSTokenizer) consumeName() string {
+	var sb strings.Builder
+
+	for {
+		c := t.peek(0)
+		switch {
+		case isNameCodePoint(c):
+			sb.WriteRune(t.consume())
+		case isValidEscape(c, t.peek(1)):
+			t.consume()
+			sb.WriteRune(t.consumeEscape())
+		default:
+			return sb.String()
+		}
+	}
+}
+
+func isCSSWhitespace(c rune) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+func isCSSDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isCSSHexDigit(c rune) bool {
+	return isCSSDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isNameStartCodePoint(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_' || c >= 0x80
+}
+
+func isNameCodePoint(c rune) bool {
+	return isNameStartCodePoint(c) || isCSSDigit(c) || c == '-'
+}
+
+func isNonPrintable(c rune) bool {
+	return (c >= 0 && c <= 0x08) || c == 0x0B || (c >= 0x0E && c <= 0x1F) || c == 0x7F
+}
+
+func isValidEscape(first, second rune) bool {
+	return first == '\\' && second != '\n' && second != -1
+}
+
+func wouldStartIdentifier(first, second, third rune) bool {
+	switch {
+	case first == '-':
+		return isNameStartCodePoint(second) || second == '-' || isValidEscape(second, third)
+	case isNameStartCodePoint(first):
+		return true
+	case first == '\\':
+		return isValidEscape(first, second)
+	}
+	return false
+}
+
+func wouldStartNumber(first, second, third rune) bool {
+	switch {
+	case first == '+' || first == '-':
+		return isCSSDigit(second) || (second == '.' && isCSSDigit(third))
+	case first == '.':
+		return isCSSDigit(second)
+	}
+	return isCSSDigit(first)
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// TestTokenizeInvalidUTF8 checks that bytes that aren't UTF-8, like those of a Latin-1
+// stylesheet, are read as U+FFFD instead of stalling the tokenizer
+func TestTokenizeInvalidUTF8(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		ident string
+	}{
+		{"leading byte", "p { color: \xffred; }", "\uFFFDred"},
+		{"inside a name", "p { color: re\xffd; }", "re\uFFFDd"},
+		{"latin-1 text", "p { font-family: caf\xe9; }", "caf\uFFFD"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			done := make(chan []CSSToken)
+			go func() {
+				tokens, _ := TokenizeCSS(test.src)
+				done <- tokens
+			}()
+
+			select {
+			case tokens := <-done:
+				found := false
+				for _, token := range tokens {
+					found = found || (token.TokenType == IdentToken && token.Value == test.ident)
+				}
+				if !found {
+					t.Errorf("TokenizeCSS(%q) has no ident %q", test.src, test.ident)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("TokenizeCSS(%q) didn't return", test.src)
+			}
+		})
+	}
+}
+
+func TestParseCSSInvalidUTF8(t *testing.T) {
+	done := make(chan int)
+	go func() {
+		done <- len(ParseCSS("x.css", "p { color: \xffred; } a { color: blue; }").Rules)
+	}()
+
+	select {
+	case rules := <-done:
+		if rules != 2 {
+			t.Errorf("expected 2 rules but found %d", rules)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ParseCSS didn't return")
+	}
+}
@@ -1,21 +1,94 @@
 package utils
 
 import (
-	"log"
+	"errors"
+	"fmt"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
-func (p *HTMLParser) expectedStringError(expected ...string) {
-	if len(expected) < 1 {
-		return
+// ErrRootNotDisplayed is returned when a layout tree is requested for a root node with display: none
+var ErrRootNotDisplayed = errors.New("the root node is set to display: none")
+
+// ParseError describes malformed input found at a specific place in a source file
+type ParseError struct {
+	FilePath string
+	Line     int
+	Column   int
+	Expected []string
+	Actual   string
+	Message  string
+}
+
+func (e *ParseError) Error() string {
+	location := e.FilePath + ":" + strconv.Itoa(e.Line) + ":" + strconv.Itoa(e.Column)
+
+	if len(e.Expected) == 0 {
+		return location + ": " + e.Message
+	}
+
+	quoted := make([]string, 0, len(e.Expected))
+	for _, expected := range e.Expected {
+		quoted = append(quoted, describeToken(expected))
 	}
 
-	expectedStrings := strings.Join(expected, " or ")
+	return fmt.Sprintf("%s: expected %s but found %s", location, strings.Join(quoted, " or "), describeToken(e.Actual))
+}
+
+// ParseErrorList collects the recoverable errors found while parsing a file
+type ParseErrorList []*ParseError
+
+func (l ParseErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
 
-	log.Fatal(
-		"error in parsing file: ", p.FilePath,
-		", expected string ", expectedStrings,
-		" at position ", strconv.Itoa(p.Parser.Pos),
-	)
+// describeToken quotes a token for an error message, using "" to stand for the end of the file
+func describeToken(token string) string {
+	if token == "" {
+		return "end of file"
+	}
+	return strconv.Quote(token)
+}
+
+// LineColumn returns the 1-based line and column of an offset into the parser's input
+func (p *Parser) LineColumn(offset int) (int, int) {
+	if offset > len(p.Input) {
+		offset = len(p.Input)
+	}
+
+	consumed := p.Input[:offset]
+	line := strings.Count(consumed, "\n") + 1
+	lineStart := strings.LastIndex(consumed, "\n") + 1
+
+	return line, utf8.RuneCountInString(consumed[lineStart:]) + 1
+}
+
+// expectedError creates a ParseError for an unexpected token found at an offset into the input
+func expectedError(filePath string, p *Parser, offset int, actual string, expected ...string) *ParseError {
+	line, column := p.LineColumn(offset)
+	return &ParseError{
+		FilePath: filePath,
+		Line:     line,
+		Column:   column,
+		Expected: expected,
+		Actual:   actual,
+	}
+}
+
+// messageError creates a ParseError with a free-form message at an offset into the input
+func messageError(filePath string, p *Parser, offset int, message string) *ParseError {
+	line, column := p.LineColumn(offset)
+	return &ParseError{
+		FilePath: filePath,
+		Line:     line,
+		Column:   column,
+		Message:  message,
+	}
 }
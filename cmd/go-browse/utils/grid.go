@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/bern/go-browse/cmd/go-browse/models"
+)
+
+// isGridFunction returns true for the functions grid track lists are made of
+func isGridFunction(name string) bool {
+	switch name {
+	case "repeat", "minmax", "fit-content":
+		return true
+	}
+	return false
+}
+
+// parseGridFunction parses repeat(), minmax() or fit-content() into a FunctionValue, whose
+// arguments are left for layout to interpret
+func parseGridFunction(name string, children []ComponentValue) (models.Value, error) {
+	args := make([]models.Value, 0)
+	for _, group := range splitOnCommas(children) {
+		arg, err := parseSpaceSeparated(group)
+		if err != nil {
+			return models.Value{}, fmt.Errorf("invalid %s(): %s", name, err)
+		}
+		args = append(args, arg)
+	}
+
+	expected := 2
+	if name == "fit-content" {
+		expected = 1
+	}
+	if len(args) != expected {
+		return models.Value{}, fmt.Errorf("invalid %s(): expected %d arguments but found %d", name, expected, len(args))
+	}
+
+	if name == "repeat" {
+		count := args[0]
+		switch {
+		case count.IsKeyword("auto-fill"), count.IsKeyword("auto-fit"):
+		case count.ValueType == models.NumberValue && count.Number >= 1 && count.Number == math.Trunc(count.Number):
+		default:
+			return models.Value{}, fmt.Errorf("invalid repeat(): can't repeat %s times", count)
+		}
+	}
+
+	return models.NewFunction(name, args), nil
+}
+
+// parseLineNames parses a bracketed list of grid line names, like [main-start content]. Like
+// other identifiers, the names are lowercased.
+func parseLineNames(block ComponentValue) (models.Value, error) {
+	names := make([]string, 0)
+	for _, child := range block.Children {
+		switch {
+		case child.Is(WhitespaceToken):
+		case child.Is(IdentToken):
+			name := child.Token.Value
+			if strings.EqualFold(name, "span") || strings.EqualFold(name, "auto") {
+				return models.Value{}, fmt.Errorf("%s can't be a line name", name)
+			}
+			names = append(names, strings.ToLower(name))
+		default:
+			return models.Value{}, fmt.Errorf("unexpected %s in line names", child)
+		}
+	}
+	return models.NewLineNames(names), nil
+}
+
+// expandGridLine expands grid-row or grid-column into a start and an end line. An end left
+// out is the same as the start if the start is a name, and auto otherwise.
+func expandGridLine(value models.Value) ([]models.Value, error) {
+	parts := slashSeparated(value)
+	if len(parts) > 2 {
+		return nil, fmt.Errorf("expected 1 or 2 lines but found %d", len(parts))
+	}
+
+	for len(parts) < 2 {
+		parts = append(parts, gridLineFallback(parts[0]))
+	}
+	return parts, nil
+}
+
+// expandGridArea expands grid-area into its row start, column start, row end and column end.
+// Lines left out follow the same rule as in grid-row and grid-column, so a single name places
+// an item in the grid area with that name.
+func expandGridArea(value models.Value) ([]models.Value, error) {
+	parts := slashSeparated(value)
+	if len(parts) > 4 {
+		return nil, fmt.Errorf("expected 1 to 4 lines but found %d", len(parts))
+	}
+
+	// the column start and row end mirror the row start, and the column end the column start
+	mirrors := []int{1: 0, 2: 0, 3: 1}
+	for len(parts) < 4 {
+		parts = append(parts, gridLineFallback(parts[mirrors[len(parts)]]))
+	}
+	return parts, nil
+}
+
+// slashSeparated returns the parts of a slash-separated value
+func slashSeparated(value models.Value) []models.Value {
+	if value.ValueType == models.ListValue && value.Separator == models.SlashSeparated {
+		return append(make([]models.Value, 0, len(value.Values)), value.Values...)
+	}
+	return []models.Value{value}
+}
+
+// gridLineFallback returns the value of a grid line left out of a shorthand, given the one
+// it mirrors
+func gridLineFallback(line models.Value) models.Value {
+	if line.ValueType == models.KeywordValue && !line.IsAuto() && line.Keyword != "span" {
+		return line
+	}
+	return models.NewKeyword("auto")
+}
@@ -1,168 +1,509 @@
 package utils
 
 import (
+	"sort"
 	"strings"
 
 	"github.com/bern/go-browse/cmd/go-browse/models"
 )
 
-// HTMLParser represents a parser tied to a specific HTML file
-type HTMLParser struct {
-	FilePath string
-	Parser   *Parser
-}
+// insertionMode is the state of the tree builder, following the WHATWG tree construction stage
+type insertionMode int
+
+const (
+	initialMode insertionMode = iota
+	beforeHTMLMode
+	beforeHeadMode
+	inHeadMode
+	afterHeadMode
+	inBodyMode
+	textMode
+	afterBodyMode
+	afterAfterBodyMode
+)
 
-// assertStringParsed throws an error if a parsed string does not match its expected value
-func (p *HTMLParser) assertStringParsed(actual string, expected ...string) {
-	for _, test := range expected {
-		if actual == test {
-			return
-		}
-	}
+// htmlNode is a mutable node used while the tree is being built
+type htmlNode struct {
+	nodeType models.NodeType
+	tagName  string
+	attrs    map[string]string
+	text     string
+	parent   *htmlNode
+	children []*htmlNode
+}
 
-	p.expectedStringError(expected...)
+// HTMLParser represents a parser tied to a specific HTML file
+type HTMLParser struct {
+	FilePath  string
+	Parser    *Parser
+	Tokenizer *HTMLTokenizer
+	Errors    []htmlParseError
+
+	mode             insertionMode
+	originalMode     insertionMode
+	document         *htmlNode
+	head             *htmlNode
+	openElements     []*htmlNode
+	activeFormatting []*htmlNode // nil entries are markers
+	skipNewline      bool
+	stopped          bool
 }
 
-// ParseHTML parses an HTML source file and returns the root Node
-func ParseHTML(filepath, src string) models.Node {
+// ParseHTML parses an HTML source file and returns the root html Node. Like a
+// browser it never gives up on malformed markup: the returned Node is always
+// usable, and a non-nil error is a ParseErrorList of the problems that were
+// recovered from.
+func ParseHTML(filepath, src string) (models.Node, error) {
+	tokenizer := NewHTMLTokenizer(src)
 	parser := &HTMLParser{
 		FilePath: filepath,
 		Parser: &Parser{
-			Input: src,
+			Input: tokenizer.Input,
 			Pos:   0,
 		},
+		Tokenizer: tokenizer,
+		mode:      initialMode,
+		document:  &htmlNode{nodeType: models.Element},
 	}
 
-	nodes := parser.ParseNodes()
+	parser.Run()
+	return parser.document.children[0].toNode(), parser.errorList()
+}
 
-	// We need to make sure the Node we return is the root
-	if len(nodes) > 1 {
-		return ElementNode("html", make(map[string]string, 0), nodes)
+// Run feeds every token to the tree builder until the end of the input
+func (p *HTMLParser) Run() {
+	for !p.stopped {
+		token := p.Tokenizer.NextToken()
+
+		if p.skipNewline {
+			p.skipNewline = false
+			if token.TokenType == HTMLCharacterToken && strings.HasPrefix(token.Data, "\n") {
+				token.Data = token.Data[1:]
+				if token.Data == "" {
+					continue
+				}
+			}
+		}
+
+		if token.TokenType == HTMLStartTagToken && token.SelfClosing && !voidElements[token.Name] && !isOneOf(token.Name, "math", "svg") {
+			p.parseError(token, "self-closing syntax on non-void element <"+token.Name+">")
+		}
+
+		p.processToken(token)
+	}
+}
+
+// errorList merges the tokenizer's and tree builder's errors in source order
+func (p *HTMLParser) errorList() error {
+	errs := append(p.Tokenizer.Errors, p.Errors...)
+	if len(errs) == 0 {
+		return nil
 	}
 
-	return nodes[0]
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].pos < errs[j].pos
+	})
+
+	list := make(ParseErrorList, 0, len(errs))
+	for _, err := range errs {
+		list = append(list, messageError(p.FilePath, p.Parser, err.pos, err.message))
+	}
+	return list
 }
 
-// ParseNodes recursively looks at all nodes until
-// we hit either a closing tag or the end of our file
-func (p *HTMLParser) ParseNodes() []models.Node {
-	nodes := make([]models.Node, 0)
+func (p *HTMLParser) parseError(token HTMLToken, message string) {
+	p.Errors = append(p.Errors, htmlParseError{pos: token.Pos, message: message})
+}
+
+// processToken hands a token to the rules for the current insertion mode
+func (p *HTMLParser) processToken(token HTMLToken) {
+	switch p.mode {
+	case initialMode:
+		p.initialMode(token)
+	case beforeHTMLMode:
+		p.beforeHTMLMode(token)
+	case beforeHeadMode:
+		p.beforeHeadMode(token)
+	case inHeadMode:
+		p.inHeadMode(token)
+	case afterHeadMode:
+		p.afterHeadMode(token)
+	case inBodyMode:
+		p.inBodyMode(token)
+	case textMode:
+		p.textMode(token)
+	case afterBodyMode:
+		p.afterBodyMode(token)
+	case afterAfterBodyMode:
+		p.afterAfterBodyMode(token)
+	}
+}
 
-	for {
-		p.Parser.ConsumeWhitespace()
+// splitLeadingWhitespace processes the leading whitespace of a character token with
+// whitespace and returns the rest of the token, or false if nothing is left
+func (p *HTMLParser) splitLeadingWhitespace(token HTMLToken, whitespace func(HTMLToken)) (HTMLToken, bool) {
+	if token.TokenType != HTMLCharacterToken {
+		return token, true
+	}
 
-		if p.Parser.EOF() || p.Parser.StartsWith("</") {
-			break
-		}
+	i := 0
+	for i < len(token.Data) && isHTMLWhitespace(token.Data[i]) {
+		i++
+	}
+	if i > 0 && whitespace != nil {
+		whitespace(HTMLToken{TokenType: HTMLCharacterToken, Data: token.Data[:i], Pos: token.Pos})
+	}
+	if i == len(token.Data) {
+		return token, false
+	}
+
+	token.Data = token.Data[i:]
+	token.Pos += i
+	return token, true
+}
+
+func (p *HTMLParser) initialMode(token HTMLToken) {
+	token, ok := p.splitLeadingWhitespace(token, nil)
+	if !ok {
+		return
+	}
 
-		if p.Parser.StartsWith("<!--") {
-			p.ParseComment()
-			continue
+	switch token.TokenType {
+	case HTMLCommentToken:
+		return
+	case HTMLDoctypeToken:
+		if token.Name != "html" {
+			p.parseError(token, "unexpected doctype "+token.Name)
 		}
+		p.mode = beforeHTMLMode
+		return
+	}
+
+	p.mode = beforeHTMLMode
+	p.processToken(token)
+}
 
-		nodes = append(nodes, p.ParseNode())
+func (p *HTMLParser) beforeHTMLMode(token HTMLToken) {
+	token, ok := p.splitLeadingWhitespace(token, nil)
+	if !ok {
+		return
 	}
 
-	return nodes
+	switch token.TokenType {
+	case HTMLCommentToken:
+		return
+	case HTMLDoctypeToken:
+		p.parseError(token, "unexpected doctype")
+		return
+	case HTMLStartTagToken:
+		if token.Name == "html" {
+			p.insertElement(token)
+			p.mode = beforeHeadMode
+			return
+		}
+	case HTMLEndTagToken:
+		if !isOneOf(token.Name, "head", "body", "html", "br") {
+			p.parseError(token, "unexpected end tag </"+token.Name+">")
+			return
+		}
+	}
+
+	p.insertElement(syntheticStartTag("html", token.Pos))
+	p.mode = beforeHeadMode
+	p.processToken(token)
 }
 
-// ParseNode creates a Node based off of the parser's current position
-func (p *HTMLParser) ParseNode() models.Node {
-	switch p.Parser.NextChar() {
-	case "<":
-		return p.ParseElement()
-	default:
-		return p.ParseText()
+func (p *HTMLParser) beforeHeadMode(token HTMLToken) {
+	token, ok := p.splitLeadingWhitespace(token, nil)
+	if !ok {
+		return
 	}
+
+	switch token.TokenType {
+	case HTMLCommentToken:
+		return
+	case HTMLDoctypeToken:
+		p.parseError(token, "unexpected doctype")
+		return
+	case HTMLStartTagToken:
+		switch token.Name {
+		case "html":
+			p.inBodyMode(token)
+			return
+		case "head":
+			p.head = p.insertElement(token)
+			p.mode = inHeadMode
+			return
+		}
+	case HTMLEndTagToken:
+		if !isOneOf(token.Name, "head", "body", "html", "br") {
+			p.parseError(token, "unexpected end tag </"+token.Name+">")
+			return
+		}
+	}
+
+	p.head = p.insertElement(syntheticStartTag("head", token.Pos))
+	p.mode = inHeadMode
+	p.processToken(token)
 }
 
-// ParseComment skims over an HTML comment and does not create a node for it
-func (p *HTMLParser) ParseComment() {
-	for {
-		if p.Parser.EOF() || p.Parser.StartsWith("-->") {
-			p.assertStringParsed(p.Parser.ConsumeChar(), "-")
-			p.assertStringParsed(p.Parser.ConsumeChar(), "-")
-			p.assertStringParsed(p.Parser.ConsumeChar(), ">")
-			break
+func (p *HTMLParser) inHeadMode(token HTMLToken) {
+	token, ok := p.splitLeadingWhitespace(token, p.insertCharacters)
+	if !ok {
+		return
+	}
+
+	switch token.TokenType {
+	case HTMLCommentToken:
+		return
+	case HTMLDoctypeToken:
+		p.parseError(token, "unexpected doctype")
+		return
+	case HTMLStartTagToken:
+		switch token.Name {
+		case "html":
+			p.inBodyMode(token)
+			return
+		case "base", "basefont", "bgsound", "link", "meta":
+			p.insertVoidElement(token)
+			return
+		case "title":
+			p.parseRawText(token, RCDATAState)
+			return
+		case "noscript", "noframes", "style", "script":
+			p.parseRawText(token, RawTextState)
+			return
+		case "head":
+			p.parseError(token, "unexpected start tag <head>")
+			return
+		}
+	case HTMLEndTagToken:
+		switch token.Name {
+		case "head":
+			p.pop()
+			p.mode = afterHeadMode
+			return
+		case "body", "html", "br":
+		default:
+			p.parseError(token, "unexpected end tag </"+token.Name+">")
+			return
 		}
-		p.Parser.ConsumeChar()
 	}
+
+	p.pop()
+	p.mode = afterHeadMode
+	p.processToken(token)
 }
 
-// ParseText creates a TextNode out of an uninterrupted text block
-func (p *HTMLParser) ParseText() models.Node {
-	text := p.Parser.ConsumeWhile(func(s string) bool {
-		return s != "<"
-	})
+func (p *HTMLParser) afterHeadMode(token HTMLToken) {
+	token, ok := p.splitLeadingWhitespace(token, p.insertCharacters)
+	if !ok {
+		return
+	}
 
-	return TextNode(strings.Trim(text, " \n\t"))
+	switch token.TokenType {
+	case HTMLCommentToken:
+		return
+	case HTMLDoctypeToken:
+		p.parseError(token, "unexpected doctype")
+		return
+	case HTMLStartTagToken:
+		switch token.Name {
+		case "html":
+			p.inBodyMode(token)
+			return
+		case "body", "frameset":
+			p.insertElement(token)
+			p.mode = inBodyMode
+			return
+		case "base", "basefont", "bgsound", "link", "meta", "noframes", "script", "style", "title":
+			// these belong in the head even when they show up after it
+			p.parseError(token, "unexpected start tag <"+token.Name+"> after head")
+			p.openElements = append(p.openElements, p.head)
+			p.inHeadMode(token)
+			p.removeOpenElement(p.head)
+			return
+		case "head":
+			p.parseError(token, "unexpected start tag <head>")
+			return
+		}
+	case HTMLEndTagToken:
+		if !isOneOf(token.Name, "body", "html", "br") {
+			p.parseError(token, "unexpected end tag </"+token.Name+">")
+			return
+		}
+	}
+
+	p.insertElement(syntheticStartTag("body", token.Pos))
+	p.mode = inBodyMode
+	p.processToken(token)
 }
 
-// ParseElement creates an ElementNode out of a set of open/close tags
-func (p *HTMLParser) ParseElement() models.Node {
-	name := ""
-	attrs := make(map[string]string, 0)
-	children := make([]models.Node, 0)
+func (p *HTMLParser) textMode(token HTMLToken) {
+	switch token.TokenType {
+	case HTMLCharacterToken:
+		p.insertCharacters(token)
+	case HTMLEOFToken:
+		p.parseError(token, "unexpected end of file in <"+p.currentNode().tagName+">")
+		p.pop()
+		p.mode = p.originalMode
+		p.processToken(token)
+	case HTMLEndTagToken:
+		p.pop()
+		p.mode = p.originalMode
+	}
+}
 
-	// Opening tag
-	p.assertStringParsed(p.Parser.ConsumeChar(), "<")
-	name = p.Parser.ConsumeName()
-	attrs = p.ParseAttributes()
+func (p *HTMLParser) afterBodyMode(token HTMLToken) {
+	token, ok := p.splitLeadingWhitespace(token, p.inBodyMode)
+	if !ok {
+		return
+	}
+
+	switch token.TokenType {
+	case HTMLCommentToken:
+		return
+	case HTMLDoctypeToken:
+		p.parseError(token, "unexpected doctype")
+		return
+	case HTMLStartTagToken:
+		if token.Name == "html" {
+			p.inBodyMode(token)
+			return
+		}
+	case HTMLEndTagToken:
+		if token.Name == "html" {
+			p.mode = afterAfterBodyMode
+			return
+		}
+	case HTMLEOFToken:
+		p.stopParsing()
+		return
+	}
 
-	// Check for self-closing tag
-	if p.Parser.StartsWith("/>") {
-		p.assertStringParsed(p.Parser.ConsumeChar(), "/")
-		p.assertStringParsed(p.Parser.ConsumeChar(), ">")
+	p.parseError(token, "unexpected content after </body>")
+	p.mode = inBodyMode
+	p.processToken(token)
+}
 
-		return ElementNode(name, attrs, children)
+func (p *HTMLParser) afterAfterBodyMode(token HTMLToken) {
+	token, ok := p.splitLeadingWhitespace(token, p.inBodyMode)
+	if !ok {
+		return
 	}
 
-	p.assertStringParsed(p.Parser.ConsumeChar(), ">")
+	switch token.TokenType {
+	case HTMLCommentToken:
+		return
+	case HTMLDoctypeToken:
+		p.inBodyMode(token)
+		return
+	case HTMLStartTagToken:
+		if token.Name == "html" {
+			p.inBodyMode(token)
+			return
+		}
+	case HTMLEOFToken:
+		p.stopParsing()
+		return
+	}
 
-	// Contents
-	children = p.ParseNodes()
+	p.parseError(token, "unexpected content after </html>")
+	p.mode = inBodyMode
+	p.processToken(token)
+}
 
-	// Closing tag
-	p.assertStringParsed(p.Parser.ConsumeChar(), "<")
-	p.assertStringParsed(p.Parser.ConsumeChar(), "/")
-	p.assertStringParsed(p.Parser.ConsumeName(), name)
-	p.assertStringParsed(p.Parser.ConsumeChar(), ">")
+// parseRawText inserts an element whose contents are raw text or RCDATA, like <style> or <title>
+func (p *HTMLParser) parseRawText(token HTMLToken, state HTMLTokenizerState) {
+	p.insertElement(token)
+	p.Tokenizer.State = state
+	p.originalMode = p.mode
+	p.mode = textMode
+}
 
-	return ElementNode(name, attrs, children)
+// stopParsing pops every open element once the input is exhausted
+func (p *HTMLParser) stopParsing() {
+	p.openElements = p.openElements[:0]
+	p.stopped = true
 }
 
-// ParseAttributes retrieves and maps all key="value" pairs in an element tag
-func (p *HTMLParser) ParseAttributes() map[string]string {
-	attrs := make(map[string]string, 0)
+// syntheticStartTag creates a start tag for an element whose tag was omitted from the source
+func syntheticStartTag(name string, pos int) HTMLToken {
+	return HTMLToken{
+		TokenType:  HTMLStartTagToken,
+		Name:       name,
+		Attributes: make([]HTMLAttribute, 0),
+		Pos:        pos,
+	}
+}
 
-	for {
-		p.Parser.ConsumeWhitespace()
-		if p.Parser.NextChar() == ">" || p.Parser.StartsWith("/>") {
-			break
+// isOneOf returns true if name is any of the given tag names
+func isOneOf(name string, names ...string) bool {
+	for _, n := range names {
+		if name == n {
+			return true
 		}
+	}
+	return false
+}
+
+// tagSet builds a lookup set of tag names
+func tagSet(names ...string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
 
-		name, value := p.ParseAttribute()
+// toNode converts a finished htmlNode and its descendants into a models.Node
+func (n *htmlNode) toNode() models.Node {
+	if n.nodeType == models.Text {
+		return TextNode(n.text)
+	}
+
+	children := make([]models.Node, 0, len(n.children))
+	for _, child := range n.children {
+		children = append(children, child.toNode())
+	}
+	return ElementNode(n.tagName, n.attrs, children)
+}
+
+// clone creates a copy of an element without its children
+func (n *htmlNode) clone() *htmlNode {
+	attrs := make(map[string]string, len(n.attrs))
+	for name, value := range n.attrs {
 		attrs[name] = value
 	}
+	return &htmlNode{
+		nodeType: n.nodeType,
+		tagName:  n.tagName,
+		attrs:    attrs,
+	}
+}
 
-	return attrs
+// appendChild moves a node to the end of n's children
+func (n *htmlNode) appendChild(child *htmlNode) {
+	if child.parent != nil {
+		child.parent.removeChild(child)
+	}
+	child.parent = n
+	n.children = append(n.children, child)
 }
 
-// ParseAttribute returns a string pair corresponding to Name,Value of an attribute
-func (p *HTMLParser) ParseAttribute() (string, string) {
-	name := p.Parser.ConsumeName()
-	p.assertStringParsed(p.Parser.ConsumeChar(), "=")
-	value := p.ConsumeAttributeValue()
-	return name, value
+func (n *htmlNode) removeChild(child *htmlNode) {
+	for i, c := range n.children {
+		if c == child {
+			n.children = append(n.children[:i], n.children[i+1:]...)
+			child.parent = nil
+			return
+		}
+	}
 }
 
-// ConsumeAttributeValue expects a quoted string and returns it
-func (p *HTMLParser) ConsumeAttributeValue() string {
-	openQuote := p.Parser.ConsumeChar()
-	p.assertStringParsed(openQuote, "'", `"`)
-	value := p.Parser.ConsumeWhile(func(s string) bool {
-		return s != openQuote
-	})
-	p.assertStringParsed(p.Parser.ConsumeChar(), openQuote)
-	return value
+// reparentChildren moves all of n's children to the end of another node
+func (n *htmlNode) reparentChildren(to *htmlNode) {
+	for len(n.children) > 0 {
+		to.appendChild(n.children[0])
+	}
 }
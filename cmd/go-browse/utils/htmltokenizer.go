@@ -0,0 +1,466 @@
+package utils
+
+import (
+	"strings"
+)
+
+// HTMLTokenType is an enum of the tokens emitted by the HTMLTokenizer
+type HTMLTokenType int
+
+const (
+	// HTMLDoctypeToken is a <!DOCTYPE> declaration
+	HTMLDoctypeToken HTMLTokenType = iota
+	// HTMLStartTagToken is an opening tag such as <div class="a">
+	HTMLStartTagToken
+	// HTMLEndTagToken is a closing tag such as </div>
+	HTMLEndTagToken
+	// HTMLCommentToken is a <!-- comment -->
+	HTMLCommentToken
+	// HTMLCharacterToken is a run of text
+	HTMLCharacterToken
+	// HTMLEOFToken marks the end of the input
+	HTMLEOFToken
+)
+
+// HTMLAttribute is a single name/value pair on a tag, kept in source order
+type HTMLAttribute struct {
+	Name  string
+	Value string
+}
+
+// HTMLToken is a single token produced by the HTMLTokenizer
+type HTMLToken struct {
+	TokenType   HTMLTokenType
+	Name        string // tag or doctype name, always lowercase
+	Attributes  []HTMLAttribute
+	SelfClosing bool
+	Data        string // text or comment contents
+	Pos         int    // byte offset of the token in the source
+}
+
+// HTMLTokenizerState is the subset of the WHATWG tokenizer states the tree builder can switch between
+type HTMLTokenizerState int
+
+const (
+	// DataState is the normal state for markup
+	DataState HTMLTokenizerState = iota
+	// RCDATAState is used for the contents of <title> and <textarea>
+	RCDATAState
+	// RawTextState is used for the contents of <style>, <script>, <xmp>, <iframe> and friends
+	RawTextState
+	// PlainTextState is used after a <plaintext> tag, which can never be closed
+	PlainTextState
+)
+
+// HTMLTokenizer splits HTML source text into tokens following the WHATWG tokenization rules
+type HTMLTokenizer struct {
+	Input        string
+	Pos          int
+	State        HTMLTokenizerState
+	LastStartTag string
+	Errors       []htmlParseError
+}
+
+// htmlParseError is a recoverable error found while tokenizing or building the tree
+type htmlParseError struct {
+	pos     int
+	message string
+}
+
+// NewHTMLTokenizer creates a tokenizer for a source string, normalizing its newlines
+func NewHTMLTokenizer(src string) *HTMLTokenizer {
+	src = strings.Replace(src, "\r\n", "\n", -1)
+	src = strings.Replace(src, "\r", "\n", -1)
+
+	return &HTMLTokenizer{
+		Input: src,
+		State: DataState,
+	}
+}
+
+func (t *HTMLTokenizer) parseError(pos int, message string) {
+	t.Errors = append(t.Errors, htmlParseError{pos: pos, message: message})
+}
+
+func (t *HTMLTokenizer) eof() bool {
+	return t.Pos >= len(t.Input)
+}
+
+// peek returns the byte n bytes past the current position, or 0 at EOF
+func (t *HTMLTokenizer) peek(n int) byte {
+	if t.Pos+n >= len(t.Input) {
+		return 0
+	}
+	return t.Input[t.Pos+n]
+}
+
+func (t *HTMLTokenizer) startsWith(prefix string) bool {
+	return strings.HasPrefix(t.Input[t.Pos:], prefix)
+}
+
+func (t *HTMLTokenizer) startsWithFold(prefix string) bool {
+	return len(t.Input)-t.Pos >= len(prefix) && strings.EqualFold(t.Input[t.Pos:t.Pos+len(prefix)], prefix)
+}
+
+// NextToken consumes and returns the next token in the input
+func (t *HTMLTokenizer) NextToken() HTMLToken {
+	start := t.Pos
+	token := t.nextToken()
+	token.Pos = start
+	return token
+}
+
+func (t *HTMLTokenizer) nextToken() HTMLToken {
+	if t.eof() {
+		return HTMLToken{TokenType: HTMLEOFToken}
+	}
+
+	switch t.State {
+	case RCDATAState, RawTextState:
+		start := t.Pos
+		if text := t.consumeRawText(); text != "" {
+			if t.State == RCDATAState {
+				text = t.decodeCharacterReferences(text, start, false)
+			}
+			return t.characterToken(text)
+		}
+		t.State = DataState
+		if t.eof() {
+			return HTMLToken{TokenType: HTMLEOFToken}
+		}
+	case PlainTextState:
+		text := t.Input[t.Pos:]
+		t.Pos = len(t.Input)
+		return t.characterToken(text)
+	}
+
+	if t.peek(0) != '<' {
+		start := t.Pos
+		return t.characterToken(t.decodeCharacterReferences(t.consumeText(), start, false))
+	}
+
+	switch next := t.peek(1); {
+	case next == '!':
+		return t.consumeMarkupDeclaration()
+	case next == '/':
+		return t.consumeEndTagOpen()
+	case isASCIIAlpha(next):
+		t.Pos++ // <
+		return t.consumeTag(HTMLStartTagToken)
+	case next == '?':
+		t.parseError(t.Pos, "unexpected question mark instead of tag name")
+		t.Pos++ // <
+		return t.consumeBogusComment()
+	}
+
+	t.parseError(t.Pos, "invalid first character of tag name")
+	t.Pos++ // <
+	return t.characterToken("<")
+}
+
+// characterToken builds a character token, replacing any NULL code points
+func (t *HTMLTokenizer) characterToken(text string) HTMLToken {
+	if strings.Contains(text, "\x00") {
+		t.parseError(t.Pos, "unexpected null character")
+		text = strings.Replace(text, "\x00", "", -1)
+	}
+	return HTMLToken{TokenType: HTMLCharacterToken, Data: text}
+}
+
+// consumeText consumes character data up to the next <
+func (t *HTMLTokenizer) consumeText() string {
+	start := t.Pos
+	end := strings.IndexByte(t.Input[t.Pos:], '<')
+	if end < 0 {
+		t.Pos = len(t.Input)
+	} else {
+		t.Pos += end
+	}
+	return t.Input[start:t.Pos]
+}
+
+// consumeRawText consumes the contents of a raw text or RCDATA element up to its appropriate end tag
+func (t *HTMLTokenizer) consumeRawText() string {
+	start := t.Pos
+
+	for !t.eof() {
+		if t.startsWith("</") && t.isAppropriateEndTag(t.Pos+2) {
+			break
+		}
+		t.Pos++
+	}
+
+	return t.Input[start:t.Pos]
+}
+
+// isAppropriateEndTag checks whether the tag name at an offset closes the last start tag
+func (t *HTMLTokenizer) isAppropriateEndTag(offset int) bool {
+	end := offset + len(t.LastStartTag)
+	if end > len(t.Input) || !strings.EqualFold(t.Input[offset:end], t.LastStartTag) {
+		return false
+	}
+	if end == len(t.Input) {
+		return false
+	}
+
+	switch t.Input[end] {
+	case ' ', '\t', '\n', '\f', '/', '>':
+		return true
+	}
+	return false
+}
+
+// consumeMarkupDeclaration consumes a comment, doctype or bogus comment starting with <!
+func (t *HTMLTokenizer) consumeMarkupDeclaration() HTMLToken {
+	t.Pos += 2 // <!
+
+	switch {
+	case t.startsWith("--"):
+		t.Pos += 2
+		return t.consumeComment()
+	case t.startsWithFold("doctype"):
+		t.Pos += len("doctype")
+		return t.consumeDoctype()
+	case t.startsWith("[CDATA["):
+		t.parseError(t.Pos, "cdata in html content")
+	default:
+		t.parseError(t.Pos, "incorrectly opened comment")
+	}
+
+	return t.consumeBogusComment()
+}
+
+// consumeComment consumes the rest of a comment after its opening <!--
+func (t *HTMLTokenizer) consumeComment() HTMLToken {
+	if t.startsWith(">") || t.startsWith("->") {
+		t.parseError(t.Pos, "abrupt closing of empty comment")
+		t.Pos += strings.IndexByte(t.Input[t.Pos:], '>') + 1
+		return HTMLToken{TokenType: HTMLCommentToken}
+	}
+
+	rest := t.Input[t.Pos:]
+	end := strings.Index(rest, "-->")
+	bang := strings.Index(rest, "--!>")
+
+	switch {
+	case bang >= 0 && (end < 0 || bang < end):
+		t.parseError(t.Pos+bang, "incorrectly closed comment")
+		t.Pos += bang + len("--!>")
+		return HTMLToken{TokenType: HTMLCommentToken, Data: rest[:bang]}
+	case end >= 0:
+		t.Pos += end + len("-->")
+		return HTMLToken{TokenType: HTMLCommentToken, Data: rest[:end]}
+	}
+
+	t.parseError(len(t.Input), "eof in comment")
+	t.Pos = len(t.Input)
+	return HTMLToken{TokenType: HTMLCommentToken, Data: rest}
+}
+
+// consumeBogusComment treats everything up to the next > as a comment
+func (t *HTMLTokenizer) consumeBogusComment() HTMLToken {
+	rest := t.Input[t.Pos:]
+	end := strings.IndexByte(rest, '>')
+	if end < 0 {
+		t.Pos = len(t.Input)
+		return HTMLToken{TokenType: HTMLCommentToken, Data: rest}
+	}
+
+	t.Pos += end + 1
+	return HTMLToken{TokenType: HTMLCommentToken, Data: rest[:end]}
+}
+
+// consumeDoctype consumes a DOCTYPE after its <!DOCTYPE keyword, keeping only its name
+func (t *HTMLTokenizer) consumeDoctype() HTMLToken {
+	if !isHTMLWhitespace(t.peek(0)) && t.peek(0) != '>' && !t.eof() {
+		t.parseError(t.Pos, "missing whitespace before doctype name")
+	}
+	t.skipWhitespace()
+
+	start := t.Pos
+	for !t.eof() && !isHTMLWhitespace(t.peek(0)) && t.peek(0) != '>' {
+		t.Pos++
+	}
+	name := strings.ToLower(t.Input[start:t.Pos])
+	if name == "" {
+		t.parseError(t.Pos, "missing doctype name")
+	}
+
+	end := strings.IndexByte(t.Input[t.Pos:], '>')
+	if end < 0 {
+		t.parseError(len(t.Input), "eof in doctype")
+		t.Pos = len(t.Input)
+	} else {
+		t.Pos += end + 1
+	}
+
+	return HTMLToken{TokenType: HTMLDoctypeToken, Name: name}
+}
+
+// consumeEndTagOpen handles the </ that begins an end tag
+func (t *HTMLTokenizer) consumeEndTagOpen() HTMLToken {
+	start := t.Pos
+	t.Pos += 2 // </
+
+	switch {
+	case isASCIIAlpha(t.peek(0)):
+		return t.consumeTag(HTMLEndTagToken)
+	case t.peek(0) == '>':
+		t.parseError(start, "missing end tag name")
+		t.Pos++
+		return t.NextToken()
+	case t.eof():
+		t.parseError(start, "eof before tag name")
+		return t.characterToken("</")
+	}
+
+	t.parseError(start, "invalid first character of tag name")
+	return t.consumeBogusComment()
+}
+
+// consumeTag consumes a tag name and its attributes, with the parser just past the < or </
+func (t *HTMLTokenizer) consumeTag(tokenType HTMLTokenType) HTMLToken {
+	token := HTMLToken{
+		TokenType:  tokenType,
+		Attributes: make([]HTMLAttribute, 0),
+	}
+
+	start := t.Pos
+	for !t.eof() && !isHTMLWhitespace(t.peek(0)) && t.peek(0) != '/' && t.peek(0) != '>' {
+		t.Pos++
+	}
+	token.Name = strings.ToLower(strings.Replace(t.Input[start:t.Pos], "\x00", "�", -1))
+
+	for {
+		t.skipWhitespace()
+
+		switch {
+		case t.eof():
+			t.parseError(t.Pos, "eof in tag")
+			return HTMLToken{TokenType: HTMLEOFToken}
+		case t.peek(0) == '>':
+			t.Pos++
+			return t.emitTag(token)
+		case t.peek(0) == '/':
+			t.Pos++
+			if t.peek(0) == '>' {
+				t.Pos++
+				token.SelfClosing = true
+				return t.emitTag(token)
+			}
+			if !t.eof() {
+				t.parseError(t.Pos, "unexpected solidus in tag")
+			}
+			continue
+		}
+
+		attrPos := t.Pos
+		attr, ok := t.consumeAttribute()
+		if !ok {
+			continue
+		}
+		if hasAttribute(token.Attributes, attr.Name) {
+			t.parseError(attrPos, "duplicate attribute "+attr.Name)
+			continue
+		}
+		token.Attributes = append(token.Attributes, attr)
+	}
+}
+
+// emitTag finishes a tag, remembering start tags so raw text can find its end tag
+func (t *HTMLTokenizer) emitTag(token HTMLToken) HTMLToken {
+	if token.TokenType == HTMLStartTagToken {
+		t.LastStartTag = token.Name
+		return token
+	}
+
+	if len(token.Attributes) > 0 {
+		t.parseError(t.Pos, "end tag with attributes")
+	}
+	if token.SelfClosing {
+		t.parseError(t.Pos, "end tag with trailing solidus")
+	}
+	return token
+}
+
+// consumeAttribute consumes a name and its optional, possibly unquoted, value
+func (t *HTMLTokenizer) consumeAttribute() (HTMLAttribute, bool) {
+	start := t.Pos
+	if t.peek(0) == '=' {
+		t.parseError(t.Pos, "unexpected equals sign before attribute name")
+		t.Pos++
+	}
+	for !t.eof() && !isHTMLWhitespace(t.peek(0)) && t.peek(0) != '/' && t.peek(0) != '>' && t.peek(0) != '=' {
+		switch t.peek(0) {
+		case '"', '\'', '<':
+			t.parseError(t.Pos, "unexpected character in attribute name")
+		}
+		t.Pos++
+	}
+	attr := HTMLAttribute{
+		Name: strings.ToLower(strings.Replace(t.Input[start:t.Pos], "\x00", "�", -1)),
+	}
+
+	t.skipWhitespace()
+	if t.peek(0) != '=' {
+		return attr, attr.Name != ""
+	}
+	t.Pos++ // =
+	t.skipWhitespace()
+
+	valueStart := t.Pos
+	switch t.peek(0) {
+	case '"', '\'':
+		quote := t.peek(0)
+		t.Pos++
+		valueStart = t.Pos
+		end := strings.IndexByte(t.Input[t.Pos:], quote)
+		if end < 0 {
+			t.Pos = len(t.Input)
+			return attr, false
+		}
+		attr.Value = t.Input[t.Pos : t.Pos+end]
+		t.Pos += end + 1
+		if !t.eof() && !isHTMLWhitespace(t.peek(0)) && t.peek(0) != '/' && t.peek(0) != '>' {
+			t.parseError(t.Pos, "missing whitespace between attributes")
+		}
+	case '>':
+		t.parseError(t.Pos, "missing attribute value")
+	default:
+		for !t.eof() && !isHTMLWhitespace(t.peek(0)) && t.peek(0) != '>' {
+			switch t.peek(0) {
+			case '"', '\'', '<', '=', '`':
+				t.parseError(t.Pos, "unexpected character in unquoted attribute value")
+			}
+			t.Pos++
+		}
+		attr.Value = t.Input[valueStart:t.Pos]
+	}
+
+	attr.Value = t.decodeCharacterReferences(attr.Value, valueStart, true)
+	attr.Value = strings.Replace(attr.Value, "\x00", "�", -1)
+	return attr, attr.Name != ""
+}
+
+func (t *HTMLTokenizer) skipWhitespace() {
+	for !t.eof() && isHTMLWhitespace(t.peek(0)) {
+		t.Pos++
+	}
+}
+
+func hasAttribute(attrs []HTMLAttribute, name string) bool {
+	for _, attr := range attrs {
+		if attr.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isHTMLWhitespace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\f'
+}
+
+func isASCIIAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,725 @@
+package utils
+
+import "github.com/bern/go-browse/cmd/go-browse/models"
+
+var (
+	// elements with special parsing rules, which stop the search for an element to close
+	specialElements = tagSet(
+		"address", "applet", "area", "article", "aside", "base", "basefont", "bgsound", "blockquote",
+		"body", "br", "button", "caption", "center", "col", "colgroup", "dd", "details", "dir", "div",
+		"dl", "dt", "embed", "fieldset", "figcaption", "figure", "footer", "form", "frame", "frameset",
+		"h1", "h2", "h3", "h4", "h5", "h6", "head", "header", "hgroup", "hr", "html", "iframe", "img",
+		"input", "keygen", "li", "link", "listing", "main", "marquee", "menu", "meta", "nav", "noembed",
+		"noframes", "noscript", "object", "ol", "p", "param", "plaintext", "pre", "script", "search",
+		"section", "select", "source", "style", "summary", "table", "tbody", "td", "template",
+		"textarea", "tfoot", "th", "thead", "title", "tr", "track", "ul", "wbr", "xmp",
+	)
+
+	// elements whose end tags may be omitted when their parent closes
+	impliedEndTags = tagSet("dd", "dt", "li", "optgroup", "option", "p", "rb", "rp", "rt", "rtc")
+
+	// elements that may still be open when the body ends without it being a parse error
+	optionalEndTags = tagSet(
+		"dd", "dt", "li", "optgroup", "option", "p", "rb", "rp", "rt", "rtc",
+		"tbody", "td", "tfoot", "th", "thead", "tr", "body", "html",
+	)
+
+	// elements that push a marker onto the list of active formatting elements
+	markerElements = tagSet("applet", "caption", "marquee", "object", "td", "th", "template")
+
+	// the scopes used to decide whether an element is "in scope"
+	defaultScope    = tagSet("applet", "caption", "html", "table", "td", "th", "marquee", "object", "template")
+	listItemScope   = tagSet("applet", "caption", "html", "table", "td", "th", "marquee", "object", "template", "ol", "ul")
+	buttonScope     = tagSet("applet", "caption", "html", "table", "td", "th", "marquee", "object", "template", "button")
+	tableScope      = tagSet("html", "table", "template")
+	headingScope    = []string{"h1", "h2", "h3", "h4", "h5", "h6"}
+	tableSections   = []string{"tbody", "thead", "tfoot"}
+	tableContexts   = []string{"table", "tbody", "thead", "tfoot", "tr"}
+	closesParagraph = tagSet(
+		"address", "article", "aside", "blockquote", "center", "details", "dialog", "dir", "div", "dl",
+		"fieldset", "figcaption", "figure", "footer", "header", "hgroup", "main", "menu", "nav", "ol",
+		"p", "search", "section", "summary", "ul",
+	)
+	formattingElements = tagSet("a", "b", "big", "code", "em", "font", "i", "nobr", "s", "small", "strike", "strong", "tt", "u")
+	voidElements       = tagSet("area", "base", "basefont", "bgsound", "br", "col", "embed", "hr", "img", "input", "keygen", "link", "meta", "param", "source", "track", "wbr")
+)
+
+// inBodyMode handles the tokens making up the body of the document
+func (p *HTMLParser) inBodyMode(token HTMLToken) {
+	switch token.TokenType {
+	case HTMLCharacterToken:
+		p.reconstructActiveFormattingElements()
+		p.insertCharacters(token)
+	case HTMLCommentToken:
+		return
+	case HTMLDoctypeToken:
+		p.parseError(token, "unexpected doctype")
+	case HTMLStartTagToken:
+		p.inBodyStartTag(token)
+	case HTMLEndTagToken:
+		p.inBodyEndTag(token)
+	case HTMLEOFToken:
+		p.checkUnclosedElements(token)
+		p.stopParsing()
+	}
+}
+
+func (p *HTMLParser) inBodyStartTag(token HTMLToken) {
+	name := token.Name
+
+	switch {
+	case name == "html":
+		p.parseError(token, "unexpected start tag <html>")
+		p.mergeAttributes(p.openElements[0], token)
+	case isOneOf(name, "base", "basefont", "bgsound", "link", "meta", "noframes", "script", "style", "title"):
+		p.inHeadMode(token)
+	case name == "body":
+		p.parseError(token, "unexpected start tag <body>")
+		if len(p.openElements) > 1 && p.openElements[1].tagName == "body" {
+			p.mergeAttributes(p.openElements[1], token)
+		}
+	case isOneOf(name, "head", "frame", "frameset"):
+		p.parseError(token, "unexpected start tag <"+name+">")
+	case closesParagraph[name]:
+		p.closePElementInButtonScope()
+		p.insertElement(token)
+	case isOneOf(name, headingScope...):
+		p.closePElementInButtonScope()
+		if isOneOf(p.currentNode().tagName, headingScope...) {
+			p.parseError(token, "unexpected start tag <"+name+"> inside <"+p.currentNode().tagName+">")
+			p.pop()
+		}
+		p.insertElement(token)
+	case isOneOf(name, "pre", "listing"):
+		p.closePElementInButtonScope()
+		p.insertElement(token)
+		p.skipNewline = true
+	case name == "form":
+		p.closePElementInButtonScope()
+		p.insertElement(token)
+	case isOneOf(name, "li", "dd", "dt"):
+		p.closeListItem(token)
+		p.closePElementInButtonScope()
+		p.insertElement(token)
+	case name == "plaintext":
+		p.closePElementInButtonScope()
+		p.insertElement(token)
+		p.Tokenizer.State = PlainTextState
+	case name == "button":
+		if p.inScope(defaultScope, "button") {
+			p.parseError(token, "unexpected start tag <button> inside <button>")
+			p.generateImpliedEndTags("")
+			p.popUntil("button")
+		}
+		p.reconstructActiveFormattingElements()
+		p.insertElement(token)
+	case name == "a":
+		if a := p.activeFormattingElement("a"); a != nil {
+			p.parseError(token, "unexpected start tag <a> inside <a>")
+			p.adoptionAgency(token, "a")
+			p.removeActiveFormattingElement(a)
+			p.removeOpenElement(a)
+		}
+		p.reconstructActiveFormattingElements()
+		p.pushActiveFormattingElement(p.insertElement(token))
+	case name == "nobr":
+		p.reconstructActiveFormattingElements()
+		if p.inScope(defaultScope, "nobr") {
+			p.parseError(token, "unexpected start tag <nobr> inside <nobr>")
+			p.adoptionAgency(token, "nobr")
+			p.reconstructActiveFormattingElements()
+		}
+		p.pushActiveFormattingElement(p.insertElement(token))
+	case formattingElements[name]:
+		p.reconstructActiveFormattingElements()
+		p.pushActiveFormattingElement(p.insertElement(token))
+	case isOneOf(name, "applet", "marquee", "object"):
+		p.reconstructActiveFormattingElements()
+		p.insertElement(token)
+		p.activeFormatting = append(p.activeFormatting, nil)
+	case name == "table":
+		p.startTable(token)
+	case isOneOf(name, "caption", "colgroup", "col", "tbody", "thead", "tfoot", "tr", "td", "th"):
+		p.startTablePart(token)
+	case name == "hr":
+		p.closePElementInButtonScope()
+		p.insertVoidElement(token)
+	case name == "image":
+		p.parseError(token, "unexpected start tag <image>, treating it as <img>")
+		token.Name = "img"
+		p.inBodyStartTag(token)
+	case voidElements[name]:
+		p.reconstructActiveFormattingElements()
+		p.insertVoidElement(token)
+	case name == "textarea":
+		p.parseRawText(token, RCDATAState)
+		p.skipNewline = true
+	case name == "xmp":
+		p.closePElementInButtonScope()
+		p.reconstructActiveFormattingElements()
+		p.parseRawText(token, RawTextState)
+	case isOneOf(name, "iframe", "noembed"):
+		p.parseRawText(token, RawTextState)
+	case isOneOf(name, "optgroup", "option"):
+		if p.currentNode().tagName == "option" {
+			p.pop()
+		}
+		p.reconstructActiveFormattingElements()
+		p.insertElement(token)
+	case isOneOf(name, "rb", "rtc"):
+		if p.inScope(defaultScope, "ruby") {
+			p.generateImpliedEndTags("")
+		}
+		p.insertElement(token)
+	case isOneOf(name, "rp", "rt"):
+		if p.inScope(defaultScope, "ruby") {
+			p.generateImpliedEndTags("rtc")
+		}
+		p.insertElement(token)
+	case isOneOf(name, "math", "svg"):
+		// foreign elements are kept as ordinary elements, but may self-close
+		p.reconstructActiveFormattingElements()
+		p.insertElement(token)
+		if token.SelfClosing {
+			p.pop()
+		}
+	default:
+		p.reconstructActiveFormattingElements()
+		p.insertElement(token)
+	}
+}
+
+func (p *HTMLParser) inBodyEndTag(token HTMLToken) {
+	name := token.Name
+
+	switch {
+	case name == "body" || name == "html":
+		if !p.inScope(defaultScope, "body") {
+			p.parseError(token, "unexpected end tag </"+name+">")
+			return
+		}
+		p.checkUnclosedElements(token)
+		p.mode = afterBodyMode
+		if name == "html" {
+			p.processToken(token)
+		}
+	case name == "p":
+		if !p.inScope(buttonScope, "p") {
+			p.parseError(token, "unexpected end tag </p> without an open <p>")
+			p.insertElement(syntheticStartTag("p", token.Pos))
+		}
+		p.closePElement()
+	case name == "li":
+		p.closeElementInScope(token, listItemScope)
+	case isOneOf(name, "dd", "dt"):
+		p.closeElementInScope(token, defaultScope)
+	case isOneOf(name, headingScope...):
+		if !p.inScope(defaultScope, headingScope...) {
+			p.parseError(token, "unexpected end tag </"+name+">")
+			return
+		}
+		p.generateImpliedEndTags("")
+		if p.currentNode().tagName != name {
+			p.parseError(token, "end tag </"+name+"> closes <"+p.currentNode().tagName+">")
+		}
+		p.popUntil(headingScope...)
+	case closesParagraph[name] || isOneOf(name, "button", "form", "listing", "pre", "applet", "marquee", "object"):
+		p.closeElementInScope(token, defaultScope)
+	case formattingElements[name]:
+		if !p.adoptionAgency(token, name) {
+			p.anyOtherEndTag(token)
+		}
+	case name == "br":
+		p.parseError(token, "unexpected end tag </br>, treating it as <br>")
+		p.reconstructActiveFormattingElements()
+		p.insertVoidElement(syntheticStartTag("br", token.Pos))
+	case name == "table":
+		if !p.inScope(tableScope, "table") {
+			p.parseError(token, "unexpected end tag </table>")
+			return
+		}
+		p.popUntil("table")
+	case isOneOf(name, "caption", "tbody", "thead", "tfoot", "tr", "td", "th"):
+		p.closeElementInScope(token, tableScope)
+	default:
+		p.anyOtherEndTag(token)
+	}
+}
+
+// anyOtherEndTag closes the nearest open element with a matching name, unless a
+// special element is in the way
+func (p *HTMLParser) anyOtherEndTag(token HTMLToken) {
+	for i := len(p.openElements) - 1; i >= 0; i-- {
+		node := p.openElements[i]
+
+		if node.tagName == token.Name {
+			p.generateImpliedEndTags(token.Name)
+			if p.currentNode() != node {
+				p.parseError(token, "end tag </"+token.Name+"> closes <"+p.currentNode().tagName+">")
+			}
+			for len(p.openElements) > i {
+				p.pop()
+			}
+			return
+		}
+
+		if specialElements[node.tagName] {
+			p.parseError(token, "unexpected end tag </"+token.Name+">")
+			return
+		}
+	}
+}
+
+// closeElementInScope handles an end tag that closes the nearest matching element in a scope
+func (p *HTMLParser) closeElementInScope(token HTMLToken, scope map[string]bool) {
+	if !p.inScope(scope, token.Name) {
+		p.parseError(token, "unexpected end tag </"+token.Name+">")
+		return
+	}
+
+	except := token.Name
+	if !impliedEndTags[except] {
+		except = ""
+	}
+	p.generateImpliedEndTags(except)
+	if p.currentNode().tagName != token.Name {
+		p.parseError(token, "end tag </"+token.Name+"> closes <"+p.currentNode().tagName+">")
+	}
+	p.popUntil(token.Name)
+}
+
+// closeListItem implicitly closes an open <li>, <dd> or <dt> before a new one starts
+func (p *HTMLParser) closeListItem(token HTMLToken) {
+	closes := []string{"li"}
+	if token.Name != "li" {
+		closes = []string{"dd", "dt"}
+	}
+
+	for i := len(p.openElements) - 1; i >= 0; i-- {
+		node := p.openElements[i]
+
+		if isOneOf(node.tagName, closes...) {
+			p.generateImpliedEndTags(node.tagName)
+			if p.currentNode() != node {
+				p.parseError(token, "start tag <"+token.Name+"> closes <"+p.currentNode().tagName+">")
+			}
+			p.popUntil(node.tagName)
+			return
+		}
+
+		if specialElements[node.tagName] && !isOneOf(node.tagName, "address", "div", "p") {
+			return
+		}
+	}
+}
+
+// startTable opens a table, first closing any table whose contents we are directly in
+func (p *HTMLParser) startTable(token HTMLToken) {
+	if isOneOf(p.currentNode().tagName, tableContexts...) {
+		p.parseError(token, "unexpected start tag <table> inside <table>")
+		p.popUntil("table")
+	}
+
+	p.closePElementInButtonScope()
+	p.insertElement(token)
+}
+
+// startTablePart opens a table section, row, cell or caption, implying any
+// missing <tbody> or <tr> and closing the parts it replaces
+func (p *HTMLParser) startTablePart(token HTMLToken) {
+	name := token.Name
+
+	if !p.inScope(tableScope, "table") {
+		p.parseError(token, "unexpected start tag <"+name+"> outside of a table")
+		return
+	}
+
+	if p.inScope(tableScope, "td", "th") {
+		p.generateImpliedEndTags("")
+		p.popUntil("td", "th")
+	}
+
+	switch name {
+	case "caption", "colgroup", "col", "tbody", "thead", "tfoot":
+		p.clearStackBackTo("table")
+	case "tr":
+		p.clearStackBackTo(append(tableSections, "table")...)
+	case "td", "th":
+		p.clearStackBackTo(append(tableSections, "table", "tr")...)
+	}
+
+	if isOneOf(name, "tr", "td", "th") && p.currentNode().tagName == "table" {
+		p.insertElement(syntheticStartTag("tbody", token.Pos))
+	}
+	if isOneOf(name, "td", "th") && isOneOf(p.currentNode().tagName, tableSections...) {
+		p.insertElement(syntheticStartTag("tr", token.Pos))
+	}
+	if name == "col" && p.currentNode().tagName == "table" {
+		p.insertElement(syntheticStartTag("colgroup", token.Pos))
+	}
+
+	if name == "col" {
+		p.insertVoidElement(token)
+		return
+	}
+
+	p.insertElement(token)
+	if markerElements[name] {
+		p.activeFormatting = append(p.activeFormatting, nil)
+	}
+}
+
+// clearStackBackTo pops elements until the current node is one of the given table elements
+func (p *HTMLParser) clearStackBackTo(names ...string) {
+	for !isOneOf(p.currentNode().tagName, append(names, "html", "template")...) {
+		p.pop()
+	}
+}
+
+// checkUnclosedElements reports elements whose end tags are required but missing
+func (p *HTMLParser) checkUnclosedElements(token HTMLToken) {
+	for _, node := range p.openElements {
+		if !optionalEndTags[node.tagName] {
+			p.parseError(token, "unclosed element <"+node.tagName+">")
+		}
+	}
+}
+
+// mergeAttributes adds a token's attributes to an element that doesn't have them yet
+func (p *HTMLParser) mergeAttributes(node *htmlNode, token HTMLToken) {
+	for _, attr := range token.Attributes {
+		if _, ok := node.attrs[attr.Name]; !ok {
+			node.attrs[attr.Name] = attr.Value
+		}
+	}
+}
+
+// currentNode returns the bottommost element on the stack of open elements
+func (p *HTMLParser) currentNode() *htmlNode {
+	if len(p.openElements) == 0 {
+		return p.document
+	}
+	return p.openElements[len(p.openElements)-1]
+}
+
+// insertElement creates an element for a start tag, appends it to the current node and opens it
+func (p *HTMLParser) insertElement(token HTMLToken) *htmlNode {
+	attrs := make(map[string]string, len(token.Attributes))
+	for _, attr := range token.Attributes {
+		attrs[attr.Name] = attr.Value
+	}
+
+	node := &htmlNode{
+		nodeType: models.Element,
+		tagName:  token.Name,
+		attrs:    attrs,
+	}
+	p.currentNode().appendChild(node)
+	p.openElements = append(p.openElements, node)
+	return node
+}
+
+// insertVoidElement inserts an element that can never have children
+func (p *HTMLParser) insertVoidElement(token HTMLToken) {
+	p.insertElement(token)
+	p.pop()
+}
+
+// insertCharacters appends text to the current node, merging it with a preceding text node
+func (p *HTMLParser) insertCharacters(token HTMLToken) {
+	parent := p.currentNode()
+	if parent == p.document || token.Data == "" {
+		return
+	}
+
+	if len(parent.children) > 0 {
+		last := parent.children[len(parent.children)-1]
+		if last.nodeType == models.Text {
+			last.text += token.Data
+			return
+		}
+	}
+
+	parent.appendChild(&htmlNode{
+		nodeType: models.Text,
+		text:     token.Data,
+	})
+}
+
+// pop closes the current node, clearing the formatting elements opened inside a marker element
+func (p *HTMLParser) pop() *htmlNode {
+	node := p.openElements[len(p.openElements)-1]
+	p.openElements = p.openElements[:len(p.openElements)-1]
+
+	if markerElements[node.tagName] {
+		p.clearActiveFormattingElementsToLastMarker()
+	}
+	return node
+}
+
+// popUntil pops elements until one with any of the given names has been popped
+func (p *HTMLParser) popUntil(names ...string) {
+	for len(p.openElements) > 0 {
+		if isOneOf(p.pop().tagName, names...) {
+			return
+		}
+	}
+}
+
+func (p *HTMLParser) removeOpenElement(node *htmlNode) {
+	for i, open := range p.openElements {
+		if open == node {
+			p.openElements = append(p.openElements[:i], p.openElements[i+1:]...)
+			return
+		}
+	}
+}
+
+func (p *HTMLParser) openElementIndex(node *htmlNode) int {
+	for i, open := range p.openElements {
+		if open == node {
+			return i
+		}
+	}
+	return -1
+}
+
+// inScope returns true if an element with one of the given names is open, without
+// any of the scope's boundary elements between it and the current node
+func (p *HTMLParser) inScope(scope map[string]bool, names ...string) bool {
+	for i := len(p.openElements) - 1; i >= 0; i-- {
+		node := p.openElements[i]
+		if isOneOf(node.tagName, names...) {
+			return true
+		}
+		if scope[node.tagName] {
+			return false
+		}
+	}
+	return false
+}
+
+// generateImpliedEndTags closes elements with optional end tags, except for the given one
+func (p *HTMLParser) generateImpliedEndTags(except string) {
+	for len(p.openElements) > 0 {
+		name := p.currentNode().tagName
+		if !impliedEndTags[name] || name == except {
+			return
+		}
+		p.pop()
+	}
+}
+
+// closePElementInButtonScope implicitly closes an open paragraph before a block starts
+func (p *HTMLParser) closePElementInButtonScope() {
+	if p.inScope(buttonScope, "p") {
+		p.closePElement()
+	}
+}
+
+func (p *HTMLParser) closePElement() {
+	p.generateImpliedEndTags("p")
+	p.popUntil("p")
+}
+
+// activeFormattingElement returns the open formatting element with a name after the last marker
+func (p *HTMLParser) activeFormattingElement(name string) *htmlNode {
+	for i := len(p.activeFormatting) - 1; i >= 0; i-- {
+		node := p.activeFormatting[i]
+		if node == nil {
+			return nil
+		}
+		if node.tagName == name {
+			return node
+		}
+	}
+	return nil
+}
+
+func (p *HTMLParser) activeFormattingIndex(node *htmlNode) int {
+	for i, entry := range p.activeFormatting {
+		if entry == node && entry != nil {
+			return i
+		}
+	}
+	return -1
+}
+
+func (p *HTMLParser) removeActiveFormattingElement(node *htmlNode) {
+	if i := p.activeFormattingIndex(node); i >= 0 {
+		p.activeFormatting = append(p.activeFormatting[:i], p.activeFormatting[i+1:]...)
+	}
+}
+
+// pushActiveFormattingElement adds a formatting element to the list, keeping at most three
+// identical entries after the last marker
+func (p *HTMLParser) pushActiveFormattingElement(node *htmlNode) {
+	matches := make([]int, 0)
+	for i := len(p.activeFormatting) - 1; i >= 0; i-- {
+		entry := p.activeFormatting[i]
+		if entry == nil {
+			break
+		}
+		if entry.tagName == node.tagName && sameAttributes(entry.attrs, node.attrs) {
+			matches = append(matches, i)
+		}
+	}
+
+	if len(matches) >= 3 {
+		earliest := matches[len(matches)-1]
+		p.activeFormatting = append(p.activeFormatting[:earliest], p.activeFormatting[earliest+1:]...)
+	}
+	p.activeFormatting = append(p.activeFormatting, node)
+}
+
+func sameAttributes(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		if other, ok := b[name]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *HTMLParser) clearActiveFormattingElementsToLastMarker() {
+	for len(p.activeFormatting) > 0 {
+		entry := p.activeFormatting[len(p.activeFormatting)-1]
+		p.activeFormatting = p.activeFormatting[:len(p.activeFormatting)-1]
+		if entry == nil {
+			return
+		}
+	}
+}
+
+// reconstructActiveFormattingElements reopens formatting elements that were implicitly
+// closed, so <b>1<p>2 puts the 2 in a <b> inside the <p>
+func (p *HTMLParser) reconstructActiveFormattingElements() {
+	if len(p.activeFormatting) == 0 {
+		return
+	}
+
+	i := len(p.activeFormatting) - 1
+	if entry := p.activeFormatting[i]; entry == nil || p.openElementIndex(entry) >= 0 {
+		return
+	}
+
+	for i > 0 {
+		entry := p.activeFormatting[i-1]
+		if entry == nil || p.openElementIndex(entry) >= 0 {
+			break
+		}
+		i--
+	}
+
+	for ; i < len(p.activeFormatting); i++ {
+		clone := p.activeFormatting[i].clone()
+		p.currentNode().appendChild(clone)
+		p.openElements = append(p.openElements, clone)
+		p.activeFormatting[i] = clone
+	}
+}
+
+// adoptionAgency fixes up misnested formatting elements such as <b>1<p>2</b>3</p>. It
+// returns false if the end tag should be handled like any other end tag instead.
+func (p *HTMLParser) adoptionAgency(token HTMLToken, subject string) bool {
+	current := p.currentNode()
+	if current.tagName == subject && p.activeFormattingIndex(current) < 0 {
+		p.pop()
+		return true
+	}
+
+	for outer := 0; outer < 8; outer++ {
+		formattingElement := p.activeFormattingElement(subject)
+		if formattingElement == nil {
+			return false
+		}
+
+		formattingIndex := p.openElementIndex(formattingElement)
+		if formattingIndex < 0 {
+			p.parseError(token, "formatting element <"+subject+"> is not open")
+			p.removeActiveFormattingElement(formattingElement)
+			return true
+		}
+		if !p.inScope(defaultScope, subject) {
+			p.parseError(token, "formatting element <"+subject+"> is not in scope")
+			return true
+		}
+		if formattingElement != p.currentNode() {
+			p.parseError(token, "misnested end tag </"+subject+">")
+		}
+
+		var furthestBlock *htmlNode
+		for _, node := range p.openElements[formattingIndex+1:] {
+			if specialElements[node.tagName] {
+				furthestBlock = node
+				break
+			}
+		}
+
+		if furthestBlock == nil {
+			for len(p.openElements) > formattingIndex {
+				p.pop()
+			}
+			p.removeActiveFormattingElement(formattingElement)
+			return true
+		}
+
+		commonAncestor := p.openElements[formattingIndex-1]
+		bookmark := p.activeFormattingIndex(formattingElement)
+
+		node, lastNode := furthestBlock, furthestBlock
+		nodeIndex := p.openElementIndex(furthestBlock)
+		for inner := 1; ; inner++ {
+			nodeIndex--
+			node = p.openElements[nodeIndex]
+			if node == formattingElement {
+				break
+			}
+
+			entryIndex := p.activeFormattingIndex(node)
+			if inner > 3 && entryIndex >= 0 {
+				p.removeActiveFormattingElement(node)
+				if entryIndex < bookmark {
+					bookmark--
+				}
+				entryIndex = -1
+			}
+			if entryIndex < 0 {
+				p.openElements = append(p.openElements[:nodeIndex], p.openElements[nodeIndex+1:]...)
+				continue
+			}
+
+			clone := node.clone()
+			p.activeFormatting[entryIndex] = clone
+			p.openElements[nodeIndex] = clone
+			node = clone
+
+			if lastNode == furthestBlock {
+				bookmark = entryIndex + 1
+			}
+			node.appendChild(lastNode)
+			lastNode = node
+		}
+
+		commonAncestor.appendChild(lastNode)
+
+		clone := formattingElement.clone()
+		furthestBlock.reparentChildren(clone)
+		furthestBlock.appendChild(clone)
+
+		if oldIndex := p.activeFormattingIndex(formattingElement); oldIndex >= 0 && oldIndex < bookmark {
+			bookmark--
+		}
+		p.removeActiveFormattingElement(formattingElement)
+		p.activeFormatting = append(p.activeFormatting[:bookmark], append([]*htmlNode{clone}, p.activeFormatting[bookmark:]...)...)
+
+		p.removeOpenElement(formattingElement)
+		furthestIndex := p.openElementIndex(furthestBlock)
+		p.openElements = append(p.openElements[:furthestIndex+1], append([]*htmlNode{clone}, p.openElements[furthestIndex+1:]...)...)
+	}
+
+	return true
+}
@@ -0,0 +1,229 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/bern/go-browse/cmd/go-browse/models"
+)
+
+// layoutDocument styles a document, builds its layout tree and lays it out in a 1024x768
+// viewport, like the browser does
+func layoutDocument(t *testing.T, document Document) *models.LayoutBox {
+	t.Helper()
+	root, err := BuildLayoutTree(StyleTree(document.Root, document.Stylesheet))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root.Layout(models.Dimensions{
+		Content: models.Rectangle{
+			Width:  models.FromPixels(1024),
+			Height: models.FromPixels(768),
+		},
+	})
+	return &root
+}
+
+// findBox returns the first box in document order whose element has a class, or the tag
+// name if the selector doesn't start with a dot
+func findBox(box *models.LayoutBox, selector string) *models.LayoutBox {
+	if box.Node != nil && box.Node.Node.Element != nil {
+		element := box.Node.Node.Element
+		if selector == element.TagName {
+			return box
+		}
+		if classes := element.Classes(); classes != nil && selector[0] == '.' {
+			for _, class := range *classes {
+				if "."+class == selector {
+					return box
+				}
+			}
+		}
+	}
+	for _, child := range box.Children {
+		if found := findBox(child, selector); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// elementChildren returns the children of a box that belong to elements, leaving out the
+// anonymous boxes around whitespace
+func elementChildren(box *models.LayoutBox) []*models.LayoutBox {
+	children := make([]*models.LayoutBox, 0)
+	for _, child := range box.Children {
+		if child.Node != nil && child.Node.Node.Element != nil {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// TestBlockHeights lays out index3.html, which stacks blocks with heights clamped by
+// min-height and max-height, and checks where each block's content box ends up
+func TestBlockHeights(t *testing.T) {
+	document, err := LoadDocument("../../../test_files/index3.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := layoutDocument(t, document)
+
+	tests := []struct {
+		selector  string
+		y, height float64
+	}{
+		{".header", 0, 50},
+		{".spaced", 65, 100},
+		{".short", 65, 40},
+		{".tall", 105, 60},     // min-height beats height
+		{".clamped", 172, 80},  // max-height beats height
+		{".conflict", 252, 20}, // min-height beats max-height
+		{"body", 0, 272},
+	}
+	for _, test := range tests {
+		t.Run(test.selector, func(t *testing.T) {
+			box := findBox(root, test.selector)
+			if box == nil {
+				t.Fatalf("no box for %s", test.selector)
+			}
+			content := box.Dimensions.Content
+			if content.Y != models.FromPixels(test.y) || content.Height != models.FromPixels(test.height) {
+				t.Errorf("content box is at y:%v with height:%v, want y:%v height:%v", content.Y, content.Height, test.y, test.height)
+			}
+		})
+	}
+
+	// none of the blocks have margins that collapse with each other, so each one starts where
+	// the one before it ends
+	for _, selector := range []string{"body", ".spaced"} {
+		t.Run(selector+" stacking", func(t *testing.T) {
+			parent := findBox(root, selector)
+			if parent == nil {
+				t.Fatalf("no box for %s", selector)
+			}
+			children := elementChildren(parent)
+			if len(children) < 2 {
+				t.Fatalf("%s has %d children, want at least 2", selector, len(children))
+			}
+			bottom := parent.Dimensions.Content.Y
+			for i, child := range children {
+				margin := child.Dimensions.MarginBox()
+				if margin.Y != bottom {
+					t.Errorf("child %d starts at y:%v, want y:%v", i, margin.Y, bottom)
+				}
+				bottom = margin.Y + margin.Height
+			}
+		})
+	}
+}
+
+// TestMarginCollapsing checks where blocks end up when their vertical margins collapse: with
+// their siblings, with their parent's, and through empty blocks, positive and negative
+func TestMarginCollapsing(t *testing.T) {
+	tests := []struct {
+		name     string
+		css      string
+		body     string
+		selector string
+		y        float64
+	}{
+		{
+			name:     "siblings take the larger margin",
+			css:      ".a { height: 10px; margin-bottom: 20px; } .b { height: 10px; margin-top: 30px; }",
+			body:     `<div class="a"></div><div class="b"></div>`,
+			selector: ".b",
+			y:        40,
+		},
+		{
+			name:     "equal sibling margins",
+			css:      ".a { height: 10px; margin-bottom: 20px; } .b { height: 10px; margin-top: 20px; }",
+			body:     `<div class="a"></div><div class="b"></div>`,
+			selector: ".b",
+			y:        30,
+		},
+		{
+			name:     "parent and first child",
+			css:      ".a { height: 10px; } .parent { margin-top: 10px; } .child { height: 10px; margin-top: 30px; }",
+			body:     `<div class="a"></div><div class="parent"><div class="child"></div></div>`,
+			selector: ".parent",
+			y:        40,
+		},
+		{
+			name:     "first child moves with its parent",
+			css:      ".a { height: 10px; } .parent { margin-top: 10px; } .child { height: 10px; margin-top: 30px; }",
+			body:     `<div class="a"></div><div class="parent"><div class="child"></div></div>`,
+			selector: ".child",
+			y:        40,
+		},
+		{
+			name:     "padding keeps parent and first child apart",
+			css:      ".a { height: 10px; } .parent { margin-top: 10px; padding-top: 1px; } .child { height: 10px; margin-top: 30px; }",
+			body:     `<div class="a"></div><div class="parent"><div class="child"></div></div>`,
+			selector: ".child",
+			y:        51,
+		},
+		{
+			name:     "parent and last child",
+			css:      ".parent { margin-bottom: 10px; } .child { height: 10px; margin-bottom: 30px; } .b { height: 10px; }",
+			body:     `<div class="parent"><div class="child"></div></div><div class="b"></div>`,
+			selector: ".b",
+			y:        40,
+		},
+		{
+			name:     "border keeps parent and last child apart",
+			css:      ".parent { margin-bottom: 10px; border-bottom: 1px solid; } .child { height: 10px; margin-bottom: 30px; } .b { height: 10px; }",
+			body:     `<div class="parent"><div class="child"></div></div><div class="b"></div>`,
+			selector: ".b",
+			y:        51,
+		},
+		{
+			name:     "through an empty block",
+			css:      ".a { height: 10px; margin-bottom: 10px; } .empty { margin-top: 20px; margin-bottom: 15px; } .b { height: 10px; margin-top: 5px; }",
+			body:     `<div class="a"></div><div class="empty"></div><div class="b"></div>`,
+			selector: ".b",
+			y:        30,
+		},
+		{
+			name:     "through an empty parent",
+			css:      ".a { height: 10px; margin-bottom: 10px; } .parent { margin-bottom: 5px; } .empty { margin-top: 25px; } .b { height: 10px; }",
+			body:     `<div class="a"></div><div class="parent"><div class="empty"></div></div><div class="b"></div>`,
+			selector: ".b",
+			y:        35,
+		},
+		{
+			name:     "negative margin subtracts from the positive one",
+			css:      ".a { height: 10px; margin-bottom: 20px; } .b { height: 10px; margin-top: -5px; }",
+			body:     `<div class="a"></div><div class="b"></div>`,
+			selector: ".b",
+			y:        25,
+		},
+		{
+			name:     "negative margins take the most negative",
+			css:      ".a { height: 10px; margin-bottom: -10px; } .b { height: 10px; margin-top: -20px; }",
+			body:     `<div class="a"></div><div class="b"></div>`,
+			selector: ".b",
+			y:        -10,
+		},
+		{
+			name:     "negative margin through an empty block",
+			css:      ".a { height: 10px; margin-bottom: 30px; } .empty { margin-top: -10px; } .b { height: 10px; margin-top: 5px; }",
+			body:     `<div class="a"></div><div class="empty"></div><div class="b"></div>`,
+			selector: ".b",
+			y:        30,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root, _ := ParseHTML("<test>", "<html><body>"+test.body+"</body></html>")
+			css := "body { margin: 0; } " + test.css
+			box := findBox(layoutDocument(t, Document{Root: root, Stylesheet: ParseCSS("<style>", css)}), test.selector)
+			if box == nil {
+				t.Fatalf("no box for %s", test.selector)
+			}
+			if y := box.Dimensions.Content.Y; y != models.FromPixels(test.y) {
+				t.Errorf("%s is at y:%v, want y:%v", test.selector, y, test.y)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/bern/go-browse/cmd/go-browse/models"
+)
+
+// Document is a parsed HTML file together with the author styles it embeds and links to
+type Document struct {
+	Root       models.Node
+	Stylesheet models.Stylesheet // the <style> and <link rel="stylesheet"> rules, in document order
+	Warnings   []error           // recoverable problems with the markup and its stylesheets
+}
+
+// LoadDocument reads and parses an HTML file, then collects the contents of its <style>
+// elements and the files its <link rel="stylesheet"> elements point at, resolved relative to
+// the HTML file. Only a failure to read the HTML file itself is returned as an error.
+func LoadDocument(path string) (Document, error) {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Document{}, err
+	}
+
+	root, err := ParseHTML(path, string(dat))
+	document := Document{
+		Root: root,
+		Stylesheet: models.Stylesheet{
+			Rules:    make([]models.Rule, 0),
+			Origin:   models.AuthorOrigin,
+			Warnings: make([]error, 0),
+		},
+		Warnings: make([]error, 0),
+	}
+	if errs, ok := err.(ParseErrorList); ok {
+		for _, parseError := range errs {
+			document.Warnings = append(document.Warnings, parseError)
+		}
+	}
+
+	document.collectStylesheets(root, filepath.Dir(path))
+	return document, nil
+}
+
+// collectStylesheets walks the tree in document order, appending the rules of each style
+// element and linked stylesheet to the document's stylesheet
+func (d *Document) collectStylesheets(node models.Node, dir string) {
+	if node.NodeType != models.Element {
+		return
+	}
+
+	switch node.Element.TagName {
+	case "style":
+		d.addStylesheet(ParseCSS("<style>", textContent(node)))
+		return
+	case "link":
+		if href, ok := stylesheetLink(*node.Element); ok {
+			d.loadStylesheet(href, dir)
+		}
+		return
+	}
+
+	for _, child := range node.Children {
+		d.collectStylesheets(child, dir)
+	}
+}
+
+// loadStylesheet reads and adds the stylesheet a link points at
+func (d *Document) loadStylesheet(href, dir string) {
+	if strings.Contains(href, "://") {
+		d.Warnings = append(d.Warnings, fmt.Errorf("skipped stylesheet %s: remote stylesheets aren't supported", href))
+		return
+	}
+
+	// query strings and fragments don't mean anything for files on disk
+	if i := strings.IndexAny(href, "?#"); i >= 0 {
+		href = href[:i]
+	}
+
+	path := filepath.FromSlash(href)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		d.Warnings = append(d.Warnings, fmt.Errorf("skipped stylesheet %s: %s", href, err))
+		return
+	}
+	d.addStylesheet(ParseCSS(path, string(dat)))
+}
+
+// addStylesheet appends the rules of a parsed stylesheet to the document's stylesheet
+func (d *Document) addStylesheet(stylesheet models.Stylesheet) {
+	d.Stylesheet.Rules = append(d.Stylesheet.Rules, stylesheet.Rules...)
+	d.Stylesheet.Warnings = append(d.Stylesheet.Warnings, stylesheet.Warnings...)
+}
+
+// stylesheetLink returns the href of a link element if it points at a stylesheet
+func stylesheetLink(element models.ElementData) (string, bool) {
+	href, ok := element.Attributes["href"]
+	if !ok || strings.TrimSpace(href) == "" {
+		return "", false
+	}
+
+	isStylesheet := false
+	for _, rel := range strings.Fields(strings.ToLower(element.Attributes["rel"])) {
+		switch rel {
+		case "stylesheet":
+			isStylesheet = true
+		case "alternate":
+			return "", false
+		}
+	}
+
+	return strings.TrimSpace(href), isStylesheet
+}
+
+// textContent joins the text of all descendants of a node
+func textContent(node models.Node) string {
+	if node.NodeType == models.Text {
+		return *node.Text
+	}
+
+	var sb strings.Builder
+	for _, child := range node.Children {
+		sb.WriteString(textContent(child))
+	}
+	return sb.String()
+}
@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"image"
+	"strings"
+
+	"github.com/bern/go-browse/cmd/go-browse/models"
+	"github.com/fogleman/gg"
+)
+
+// BuildDisplayList walks down a laid out LayoutBox and creates the commands needed to paint it
+func BuildDisplayList(root models.LayoutBox) models.DisplayList {
+	list := make(models.DisplayList, 0)
+	renderLayoutBox(&list, root)
+	return list
+}
+
+// renderLayoutBox appends the commands for a box, followed by those of its children. Inline
+// boxes are painted once for each line they are on.
+func renderLayoutBox(list *models.DisplayList, box models.LayoutBox) {
+	areas := []models.Dimensions{box.Dimensions}
+	if box.BoxType == models.InlineNode {
+		areas = areas[:0]
+		for _, fragment := range box.Fragments {
+			areas = append(areas, fragment.Dimensions)
+		}
+	}
+
+	for _, d := range areas {
+		renderBackground(list, box, d)
+		renderBorders(list, box, d)
+	}
+	renderText(list, box)
+
+	for _, child := range box.Children {
+		renderLayoutBox(list, *child)
+	}
+}
+
+// renderBackground fills the border box of an area of a LayoutBox with its background color
+func renderBackground(list *models.DisplayList, box models.LayoutBox, d models.Dimensions) {
+	color := getColor(box, "background-color")
+	if color == nil {
+		return
+	}
+
+	*list = append(*list, models.DisplayCommand{
+		CommandType: models.SolidColor,
+		Color:       *color,
+		Rect:        d.BorderBox(),
+	})
+}
+
+// renderText draws the text a text box holds on each of its lines
+func renderText(list *models.DisplayList, box models.LayoutBox) {
+	styledNode := box.GetStyledNode()
+	if box.BoxType != models.InlineNode || styledNode.Node.Text == nil {
+		return
+	}
+
+	color := styledNode.Color("color")
+	if color == nil {
+		color = &models.Color{A: 255}
+	}
+	face := models.FontFor(styledNode)
+
+	for _, fragment := range box.Fragments {
+		if strings.TrimSpace(fragment.Text) == "" {
+			continue
+		}
+		*list = append(*list, models.DisplayCommand{
+			CommandType: models.DrawText,
+			Color:       *color,
+			Rect:        fragment.Dimensions.Content,
+			Text:        fragment.Text,
+			Face:        face,
+			Baseline:    fragment.Baseline,
+		})
+	}
+}
+
+// getColor returns the first color found on a box for a list of properties
+func getColor(box models.LayoutBox, names ...string) *models.Color {
+	if box.BoxType == models.AnonymousBlock {
+		return nil
+	}
+
+	styledNode := box.GetStyledNode()
+	for _, name := range names {
+		if color := styledNode.Color(name); color != nil {
+			return color
+		}
+	}
+
+	return nil
+}
+
+// Rasterize paints a display list onto a white canvas of the given size, snapping rectangles
+// to whole pixels. Polygons are drawn where they are, antialiased.
+func Rasterize(list models.DisplayList, width, height int) image.Image {
+	dc := gg.NewContext(width, height)
+
+	dc.SetRGB(1, 1, 1)
+	dc.Clear()
+
+	for _, command := range list {
+		switch command.CommandType {
+		case models.SolidColor:
+			x, y, width, height := command.Rect.PixelSnapped()
+			dc.DrawRectangle(float64(x), float64(y), float64(width), float64(height))
+			dc.SetRGBA255(int(command.Color.R), int(command.Color.G), int(command.Color.B), int(command.Color.A))
+			dc.Fill()
+		case models.DrawText:
+			dc.SetFontFace(command.Face.FontFace())
+			dc.SetRGBA255(int(command.Color.R), int(command.Color.G), int(command.Color.B), int(command.Color.A))
+			// text keeps its fractional position along the line, but sits on a whole-pixel baseline
+			dc.DrawString(command.Text, command.Rect.X.Pixels(), float64(command.Baseline.Round()))
+		case models.FillPolygon:
+			for _, point := range command.Points {
+				dc.LineTo(point.X.Pixels(), point.Y.Pixels())
+			}
+			dc.ClosePath()
+			dc.SetRGBA255(int(command.Color.R), int(command.Color.G), int(command.Color.B), int(command.Color.A))
+			dc.Fill()
+		}
+	}
+
+	return dc.Image()
+}
+
+// PaintPNG paints a laid out LayoutBox and saves the result as a png
+func PaintPNG(root models.LayoutBox, width, height int, path string) error {
+	img := Rasterize(BuildDisplayList(root), width, height)
+	return gg.SavePNG(path, img)
+}
@@ -13,6 +13,9 @@ type Parser struct {
 
 // NextChar reveals the next character that will be visited by the parser
 func (p *Parser) NextChar() string {
+	if p.EOF() {
+		return ""
+	}
 	return string(p.Input[p.Pos])
 }
 
@@ -0,0 +1,284 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bern/go-browse/cmd/go-browse/models"
+)
+
+// anPlusBPattern matches a compacted an+b expression, like 2n+1, -n+3, n or 4
+var anPlusBPattern = regexp.MustCompile(`^(?:([+-]?\d*)n)?([+-]?\d+)?$`)
+
+// ParsePseudoClass parses a pseudo-class starting at the colon in values[i], returning the
+// index just past it
+func (p *CSSParser) ParsePseudoClass(values []ComponentValue, i int) (models.PseudoClass, int, error) {
+	if i+1 >= len(values) {
+		return models.PseudoClass{}, i, fmt.Errorf("expected a pseudo-class after :")
+	}
+
+	value := values[i+1]
+	next := i + 2
+	name := strings.ToLower(value.Token.Value)
+
+	switch {
+	case value.Is(ColonToken):
+		return models.PseudoClass{}, i, fmt.Errorf("unsupported pseudo-element :%s", serializeComponentValues(values[i+1:]))
+	case value.Is(IdentToken):
+		switch name {
+		case "first-child", "last-child", "only-child", "first-of-type", "last-of-type", "only-of-type", "empty", "root":
+			return models.PseudoClass{Name: name}, next, nil
+		}
+	case value.IsFunction():
+		pseudoClass := models.PseudoClass{Name: name}
+		var err error
+
+		switch name {
+		case "nth-child", "nth-last-child", "nth-of-type", "nth-last-of-type":
+			pseudoClass.A, pseudoClass.B, err = parseAnPlusB(value.Children)
+		case "not":
+			pseudoClass.Selectors, err = p.ParseSelectors(value.Children)
+		case "is", "where":
+			pseudoClass.Selectors = p.parseForgivingSelectors(value.Children)
+		case "has":
+			pseudoClass.Selectors, err = p.parseRelativeSelectors(value.Children)
+		default:
+			return models.PseudoClass{}, i, fmt.Errorf("unsupported pseudo-class :%s", value)
+		}
+
+		if err != nil {
+			return models.PseudoClass{}, i, fmt.Errorf("invalid :%s: %s", value, err)
+		}
+		return pseudoClass, next, nil
+	}
+
+	return models.PseudoClass{}, i, fmt.Errorf("unsupported pseudo-class :%s", value)
+}
+
+// parseForgivingSelectors parses the argument of :is() or :where(), where invalid
+// selectors are dropped instead of invalidating the whole list
+func (p *CSSParser) parseForgivingSelectors(values []ComponentValue) []models.Selector {
+	selectors := make([]models.Selector, 0)
+
+	for _, group := range splitOnCommas(values) {
+		selector, err := p.ParseSelector(trimWhitespace(group))
+		if err == nil {
+			selectors = append(selectors, selector)
+		}
+	}
+
+	return selectors
+}
+
+// parseRelativeSelectors parses the argument of :has(), where each selector may start
+// with a combinator relating it to the element being matched
+func (p *CSSParser) parseRelativeSelectors(values []ComponentValue) ([]models.Selector, error) {
+	selectors := make([]models.Selector, 0)
+
+	for _, group := range splitOnCommas(values) {
+		group = trimWhitespace(group)
+
+		combinator := models.Descendant
+		if len(group) > 0 {
+			if explicit, ok := parseCombinator(group[0]); ok {
+				combinator = explicit
+				group = trimWhitespace(group[1:])
+			}
+		}
+
+		selector, err := p.ParseSelector(group)
+		if err != nil {
+			return nil, err
+		}
+		selector.Parts[0].Combinator = combinator
+		selectors = append(selectors, selector)
+	}
+
+	return selectors, nil
+}
+
+// parseAnPlusB parses the an+b argument of an :nth-*() pseudo-class, including odd and even
+func parseAnPlusB(values []ComponentValue) (int, int, error) {
+	var sb strings.Builder
+
+	for _, value := range trimWhitespace(values) {
+		token := value.Token
+		switch {
+		case value.Is(WhitespaceToken):
+			continue
+		case value.IsDelim("+") || value.IsDelim("-"):
+			sb.WriteString(token.Value)
+		case value.Is(IdentToken):
+			sb.WriteString(token.Value)
+		case value.Is(NumberToken) && token.IsInteger:
+			// a number after n needs a sign to be an offset; the tokenizer doesn't keep a leading +
+			if sb.Len() > 0 && !strings.HasSuffix(sb.String(), "+") && !strings.HasSuffix(sb.String(), "-") && token.Number >= 0 {
+				sb.WriteString("+")
+			}
+			sb.WriteString(formatTokenNumber(token.Number))
+		case value.Is(DimensionToken) && token.IsInteger:
+			sb.WriteString(formatTokenNumber(token.Number) + token.Unit)
+		default:
+			return 0, 0, fmt.Errorf("unexpected %s", value)
+		}
+	}
+
+	expression := strings.ToLower(sb.String())
+	switch expression {
+	case "odd":
+		return 2, 1, nil
+	case "even":
+		return 2, 0, nil
+	}
+
+	match := anPlusBPattern.FindStringSubmatch(expression)
+	if expression == "" || match == nil {
+		return 0, 0, fmt.Errorf("invalid an+b expression %q", serializeComponentValues(values))
+	}
+
+	a := 0
+	if strings.Contains(expression, "n") {
+		switch match[1] {
+		case "", "+":
+			a = 1
+		case "-":
+			a = -1
+		default:
+			a, _ = strconv.Atoi(match[1])
+		}
+	}
+
+	b := 0
+	if match[2] != "" {
+		b, _ = strconv.Atoi(match[2])
+	}
+
+	return a, b, nil
+}
+
+// MatchesPseudoClass returns true if a node matches a PseudoClass
+func MatchesPseudoClass(node *models.NodeRef, pseudoClass models.PseudoClass) bool {
+	switch pseudoClass.Name {
+	case "root":
+		return node.Parent == nil
+	case "empty":
+		for _, child := range node.Node.Children {
+			if child.NodeType == models.Element || (child.Text != nil && *child.Text != "") {
+				return false
+			}
+		}
+		return true
+	case "first-child":
+		return siblingPosition(node, false, false) == 1
+	case "last-child":
+		return siblingPosition(node, true, false) == 1
+	case "only-child":
+		return siblingPosition(node, false, false) == 1 && siblingPosition(node, true, false) == 1
+	case "first-of-type":
+		return siblingPosition(node, false, true) == 1
+	case "last-of-type":
+		return siblingPosition(node, true, true) == 1
+	case "only-of-type":
+		return siblingPosition(node, false, true) == 1 && siblingPosition(node, true, true) == 1
+	case "nth-child":
+		return matchesAnPlusB(pseudoClass.A, pseudoClass.B, siblingPosition(node, false, false))
+	case "nth-last-child":
+		return matchesAnPlusB(pseudoClass.A, pseudoClass.B, siblingPosition(node, true, false))
+	case "nth-of-type":
+		return matchesAnPlusB(pseudoClass.A, pseudoClass.B, siblingPosition(node, false, true))
+	case "nth-last-of-type":
+		return matchesAnPlusB(pseudoClass.A, pseudoClass.B, siblingPosition(node, true, true))
+	case "not":
+		return !matchesAny(node, pseudoClass.Selectors)
+	case "is", "where":
+		return matchesAny(node, pseudoClass.Selectors)
+	case "has":
+		return matchesRelative(node, pseudoClass.Selectors)
+	}
+
+	return false
+}
+
+func matchesAny(node *models.NodeRef, selectors []models.Selector) bool {
+	for _, selector := range selectors {
+		if Matches(node, selector) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAnPlusB returns true if a 1-based position is a*n+b for some n >= 0
+func matchesAnPlusB(a, b, position int) bool {
+	if a == 0 {
+		return position == b
+	}
+
+	steps := position - b
+	return steps%a == 0 && steps/a >= 0
+}
+
+// siblingPosition returns the 1-based position of a node among its element siblings,
+// counting from the end if fromEnd is set and only counting its own tag name if ofType is set
+func siblingPosition(node *models.NodeRef, fromEnd, ofType bool) int {
+	if node.Parent == nil {
+		return 1
+	}
+
+	siblings := node.Parent.Node.Children
+	position := 1
+	step := -1
+	if fromEnd {
+		step = 1
+	}
+
+	for i := node.Index + step; i >= 0 && i < len(siblings); i += step {
+		sibling := siblings[i]
+		if sibling.NodeType != models.Element {
+			continue
+		}
+		if ofType && sibling.Element.TagName != node.Node.Element.TagName {
+			continue
+		}
+		position++
+	}
+
+	return position
+}
+
+// matchesRelative returns true if any element relative to a node matches one of the relative
+// selectors of :has()
+func matchesRelative(node *models.NodeRef, selectors []models.Selector) bool {
+	for _, selector := range selectors {
+		switch selector.Parts[0].Combinator {
+		case models.Descendant, models.Child:
+			if anyDescendantMatches(node, selector.Parts, node) {
+				return true
+			}
+		case models.NextSibling, models.SubsequentSibling:
+			if node.Parent == nil {
+				continue
+			}
+			for i := node.Index + 1; i < len(node.Parent.Node.Children); i++ {
+				sibling := node.Parent.Child(i)
+				if matchesParts(sibling, selector.Parts, node) || anyDescendantMatches(sibling, selector.Parts, node) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// anyDescendantMatches returns true if any descendant of a node matches a relative selector anchored at anchor
+func anyDescendantMatches(node *models.NodeRef, parts []models.SelectorPart, anchor *models.NodeRef) bool {
+	for i := range node.Node.Children {
+		child := node.Child(i)
+		if matchesParts(child, parts, anchor) || anyDescendantMatches(child, parts, anchor) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,652 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bern/go-browse/cmd/go-browse/models"
+)
+
+// shorthand describes a property that sets several longhands at once
+type shorthand struct {
+	longhands []string
+	// expand returns a value for each longhand, in the same order
+	expand func(value models.Value) ([]models.Value, error)
+}
+
+// sides are the physical sides of a box, in the order the box shorthands list them
+var sides = []string{"top", "right", "bottom", "left"}
+
+// shorthands is the registry of the shorthand properties we expand
+var shorthands = map[string]shorthand{
+	"margin":        {longhands: sideLonghands("margin-%s"), expand: expandSides},
+	"padding":       {longhands: sideLonghands("padding-%s"), expand: expandSides},
+	"inset":         {longhands: sideLonghands("%s"), expand: expandSides},
+	"border-width":  {longhands: sideLonghands("border-%s-width"), expand: expandSides},
+	"border-style":  {longhands: sideLonghands("border-%s-style"), expand: expandSides},
+	"border-color":  {longhands: sideLonghands("border-%s-color"), expand: expandSides},
+	"border-top":    {longhands: borderLonghands("top"), expand: expandBorderSide},
+	"border-right":  {longhands: borderLonghands("right"), expand: expandBorderSide},
+	"border-bottom": {longhands: borderLonghands("bottom"), expand: expandBorderSide},
+	"border-left":   {longhands: borderLonghands("left"), expand: expandBorderSide},
+	"border":        {longhands: borderLonghands(sides...), expand: expandBorder},
+	"background":    {longhands: backgroundLonghands, expand: expandBackground},
+	"font":          {longhands: fontLonghands, expand: expandFont},
+	"flex":          {longhands: []string{"flex-grow", "flex-shrink", "flex-basis"}, expand: expandFlex},
+	"flex-flow":     {longhands: []string{"flex-direction", "flex-wrap"}, expand: expandFlexFlow},
+	"gap":           {longhands: []string{"row-gap", "column-gap"}, expand: expandGap},
+	"grid-row":      {longhands: []string{"grid-row-start", "grid-row-end"}, expand: expandGridLine},
+	"grid-column":   {longhands: []string{"grid-column-start", "grid-column-end"}, expand: expandGridLine},
+	"grid-area": {
+		longhands: []string{"grid-row-start", "grid-column-start", "grid-row-end", "grid-column-end"},
+		expand:    expandGridArea,
+	},
+}
+
+var backgroundLonghands = []string{
+	"background-color", "background-image", "background-position", "background-size",
+	"background-repeat", "background-attachment", "background-origin", "background-clip",
+}
+
+var fontLonghands = []string{
+	"font-style", "font-variant", "font-weight", "font-stretch", "font-size", "line-height", "font-family",
+}
+
+func sideLonghands(pattern string) []string {
+	longhands := make([]string, 0, len(sides))
+	for _, side := range sides {
+		longhands = append(longhands, fmt.Sprintf(pattern, side))
+	}
+	return longhands
+}
+
+func borderLonghands(sides ...string) []string {
+	longhands := make([]string, 0, len(sides)*3)
+	for _, side := range sides {
+		longhands = append(longhands, "border-"+side+"-width", "border-"+side+"-style", "border-"+side+"-color")
+	}
+	return longhands
+}
+
+// ExpandShorthand replaces a shorthand declaration with a declaration for each of its
+// longhands. Longhands the shorthand leaves out are reset to their initial values, and a
+// CSS-wide keyword like inherit applies to all of them. Other declarations are returned as is.
+func ExpandShorthand(declaration models.Declaration) ([]models.Declaration, error) {
+	property, ok := shorthands[declaration.Name]
+	if !ok {
+		return []models.Declaration{declaration}, nil
+	}
+
+	var values []models.Value
+	if isCSSWideKeyword(declaration.Value) {
+		values = make([]models.Value, len(property.longhands))
+		for i := range values {
+			values[i] = declaration.Value
+		}
+	} else {
+		var err error
+		values, err = property.expand(declaration.Value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	declarations := make([]models.Declaration, 0, len(values))
+	for i, value := range values {
+		declarations = append(declarations, models.Declaration{
+			Name:      property.longhands[i],
+			Value:     value,
+			Important: declaration.Important,
+		})
+	}
+	return declarations, nil
+}
+
+// isCSSWideKeyword returns true for the keywords every property accepts
+func isCSSWideKeyword(value models.Value) bool {
+	switch {
+	case value.IsKeyword("inherit"), value.IsKeyword("initial"), value.IsKeyword("unset"), value.IsKeyword("revert"):
+		return true
+	}
+	return false
+}
+
+// initialValue returns the initial value of a longhand, which the registry always has
+func initialValue(name string) models.Value {
+	value, _ := models.InitialValue(name)
+	return value
+}
+
+// spaceSeparated returns the items of a single space-separated group, failing on commas and slashes
+func spaceSeparated(value models.Value) ([]models.Value, error) {
+	if value.ValueType == models.ListValue && value.Separator != models.SpaceSeparated {
+		return nil, fmt.Errorf("unexpected %s", value)
+	}
+	return value.Items(), nil
+}
+
+// expandSides expands one to four values into top, right, bottom and left: one value applies
+// to every side, two to the vertical then horizontal sides, and three to the top, the
+// horizontal sides and the bottom
+func expandSides(value models.Value) ([]models.Value, error) {
+	items, err := spaceSeparated(value)
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(items) {
+	case 1:
+		return []models.Value{items[0], items[0], items[0], items[0]}, nil
+	case 2:
+		return []models.Value{items[0], items[1], items[0], items[1]}, nil
+	case 3:
+		return []models.Value{items[0], items[1], items[2], items[1]}, nil
+	case 4:
+		return items, nil
+	}
+	return nil, fmt.Errorf("expected 1 to 4 values but found %d", len(items))
+}
+
+// borderStyles are the keywords of the border-style properties
+var borderStyles = map[string]bool{
+	"none": true, "hidden": true, "dotted": true, "dashed": true, "solid": true,
+	"double": true, "groove": true, "ridge": true, "inset": true, "outset": true,
+}
+
+// expandBorderSide expands a width, style and color, in any order, into the longhands of
+// one side of a border
+func expandBorderSide(value models.Value) ([]models.Value, error) {
+	items, err := spaceSeparated(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var width, style, color *models.Value
+	for i := range items {
+		item := &items[i]
+		switch {
+		case width == nil && isLineWidth(*item):
+			width = item
+		case style == nil && item.ValueType == models.KeywordValue && borderStyles[item.Keyword]:
+			style = item
+		case color == nil && isColor(*item):
+			color = item
+		default:
+			return nil, fmt.Errorf("unexpected %s", item)
+		}
+	}
+
+	values := []models.Value{initialValue("border-top-width"), initialValue("border-top-style"), initialValue("border-top-color")}
+	for i, v := range []*models.Value{width, style, color} {
+		if v != nil {
+			values[i] = *v
+		}
+	}
+	return values, nil
+}
+
+// expandBorder applies the same width, style and color to every side of a border
+func expandBorder(value models.Value) ([]models.Value, error) {
+	side, err := expandBorderSide(value)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]models.Value, 0, len(side)*len(sides))
+	for range sides {
+		values = append(values, side...)
+	}
+	return values, nil
+}
+
+// isLineWidth returns true for the values of the border width properties
+func isLineWidth(value models.Value) bool {
+	switch {
+	case value.IsKeyword("thin"), value.IsKeyword("medium"), value.IsKeyword("thick"):
+		return true
+	}
+	return isLength(value)
+}
+
+// isLength returns true for lengths, unitless zero and math functions. Grid fractions aren't
+// lengths.
+func isLength(value models.Value) bool {
+	switch value.ValueType {
+	case models.LengthValue:
+		return value.Unit != models.Fr
+	case models.CalcValue:
+		return true
+	case models.NumberValue:
+		return value.Number == 0
+	}
+	return false
+}
+
+// isLengthPercentage returns true for lengths and percentages
+func isLengthPercentage(value models.Value) bool {
+	return isLength(value) || value.ValueType == models.PercentageValue
+}
+
+// isColor returns true for colors and color keywords
+func isColor(value models.Value) bool {
+	if value.ValueType == models.ColorValue || value.IsKeyword("currentcolor") {
+		return true
+	}
+	if value.ValueType == models.KeywordValue {
+		_, ok := models.NamedColor(value.Keyword)
+		return ok
+	}
+	return false
+}
+
+// slash stands in for the / between two parts of a shorthand once its value is flattened
+var slash = models.Value{ValueType: models.ListValue, Separator: models.SlashSeparated}
+
+// flattenSlash turns one comma-separated group of a shorthand into its items, with slash
+// marking where the / was
+func flattenSlash(value models.Value) ([]models.Value, error) {
+	if value.ValueType != models.ListValue || value.Separator != models.SlashSeparated {
+		return spaceSeparated(value)
+	}
+	if len(value.Values) != 2 {
+		return nil, errors.New("unexpected /")
+	}
+
+	before, err := spaceSeparated(value.Values[0])
+	if err != nil {
+		return nil, err
+	}
+	after, err := spaceSeparated(value.Values[1])
+	if err != nil {
+		return nil, err
+	}
+
+	items := append(make([]models.Value, 0, len(before)+len(after)+1), before...)
+	items = append(items, slash)
+	return append(items, after...), nil
+}
+
+func isSlash(value models.Value) bool {
+	return value.ValueType == models.ListValue && value.Separator == models.SlashSeparated && len(value.Values) == 0
+}
+
+// backgroundLayer holds the longhand values of one layer of a background
+type backgroundLayer struct {
+	color, image, position, size, repeat, attachment, origin, clip *models.Value
+}
+
+// expandBackground expands comma-separated background layers. Each longhand gets a comma
+// list with an item per layer, and only the last layer can have a color.
+func expandBackground(value models.Value) ([]models.Value, error) {
+	groups := []models.Value{value}
+	if value.ValueType == models.ListValue && value.Separator == models.CommaSeparated {
+		groups = value.Values
+	}
+
+	layers := make([]backgroundLayer, 0, len(groups))
+	for i, group := range groups {
+		layer, err := parseBackgroundLayer(group, i == len(groups)-1)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, layer)
+	}
+
+	values := make([]models.Value, 0, len(backgroundLonghands))
+	for _, name := range backgroundLonghands {
+		items := make([]models.Value, 0, len(layers))
+		for _, layer := range layers {
+			v := layer.value(name)
+			if v == nil {
+				items = append(items, initialValue(name))
+			} else {
+				items = append(items, *v)
+			}
+		}
+
+		switch {
+		case name == "background-color":
+			items = items[len(items)-1:]
+		case len(items) > 1:
+			items = []models.Value{models.NewList(models.CommaSeparated, items)}
+		}
+		values = append(values, items[0])
+	}
+	return values, nil
+}
+
+func (l backgroundLayer) value(name string) *models.Value {
+	switch name {
+	case "background-color":
+		return l.color
+	case "background-image":
+		return l.image
+	case "background-position":
+		return l.position
+	case "background-size":
+		return l.size
+	case "background-repeat":
+		return l.repeat
+	case "background-attachment":
+		return l.attachment
+	case "background-origin":
+		return l.origin
+	case "background-clip":
+		return l.clip
+	}
+	return nil
+}
+
+// parseBackgroundLayer reads the components of one background layer, which can come in any
+// order apart from the size following the position after a /
+func parseBackgroundLayer(value models.Value, final bool) (backgroundLayer, error) {
+	items, err := flattenSlash(value)
+	if err != nil {
+		return backgroundLayer{}, err
+	}
+
+	layer := backgroundLayer{}
+	boxes := 0
+	for i := 0; i < len(items); i++ {
+		item := items[i]
+		switch {
+		case layer.color == nil && final && isColor(item):
+			layer.color = &items[i]
+		case layer.image == nil && (item.ValueType == models.URLValue || item.IsKeyword("none")):
+			layer.image = &items[i]
+		case layer.repeat == nil && isRepeatKeyword(item):
+			repeat := takeWhile(items[i:], 2, isRepeatKeyword)
+			layer.repeat = &repeat
+			i += len(repeat.Items()) - 1
+		case layer.attachment == nil && (item.IsKeyword("scroll") || item.IsKeyword("fixed") || item.IsKeyword("local")):
+			layer.attachment = &items[i]
+		case boxes < 2 && (item.IsKeyword("border-box") || item.IsKeyword("padding-box") || item.IsKeyword("content-box")):
+			if boxes == 0 {
+				layer.origin = &items[i]
+			}
+			layer.clip = &items[i]
+			boxes++
+		case layer.position == nil && isPositionComponent(item):
+			position := takeWhile(items[i:], 4, isPositionComponent)
+			layer.position = &position
+			i += len(position.Items())
+
+			if i < len(items) && isSlash(items[i]) {
+				size := takeWhile(items[i+1:], 2, isSizeComponent)
+				if len(size.Items()) == 0 {
+					return backgroundLayer{}, errors.New("expected a size after /")
+				}
+				layer.size = &size
+				i += len(size.Items())
+			} else {
+				i--
+			}
+		default:
+			return backgroundLayer{}, fmt.Errorf("unexpected %s", item)
+		}
+	}
+
+	return layer, nil
+}
+
+// takeWhile collects up to max leading items that satisfy a predicate into a single value
+func takeWhile(items []models.Value, max int, predicate func(models.Value) bool) models.Value {
+	taken := make([]models.Value, 0, max)
+	for _, item := range items {
+		if len(taken) == max || isSlash(item) || !predicate(item) {
+			break
+		}
+		taken = append(taken, item)
+	}
+
+	if len(taken) == 1 {
+		return taken[0]
+	}
+	return models.NewList(models.SpaceSeparated, taken)
+}
+
+func isRepeatKeyword(value models.Value) bool {
+	switch {
+	case value.IsKeyword("repeat"), value.IsKeyword("repeat-x"), value.IsKeyword("repeat-y"),
+		value.IsKeyword("no-repeat"), value.IsKeyword("space"), value.IsKeyword("round"):
+		return true
+	}
+	return false
+}
+
+func isPositionComponent(value models.Value) bool {
+	switch {
+	case value.IsKeyword("left"), value.IsKeyword("right"), value.IsKeyword("top"),
+		value.IsKeyword("bottom"), value.IsKeyword("center"):
+		return true
+	}
+	return isLengthPercentage(value)
+}
+
+func isSizeComponent(value models.Value) bool {
+	switch {
+	case value.IsKeyword("auto"), value.IsKeyword("cover"), value.IsKeyword("contain"):
+		return true
+	}
+	return isLengthPercentage(value)
+}
+
+// fontSizeKeywords are the keywords of font-size
+var fontSizeKeywords = map[string]bool{
+	"xx-small": true, "x-small": true, "small": true, "medium": true, "large": true,
+	"x-large": true, "xx-large": true, "xxx-large": true, "larger": true, "smaller": true,
+}
+
+// indexes of the longhands in fontLonghands
+const (
+	fontStyle = iota
+	fontVariant
+	fontWeight
+	fontStretch
+	fontSize
+	fontLineHeight
+	fontFamily
+)
+
+// fontStretchKeywords are the keywords of font-stretch
+var fontStretchKeywords = map[string]bool{
+	"ultra-condensed": true, "extra-condensed": true, "condensed": true, "semi-condensed": true,
+	"semi-expanded": true, "expanded": true, "extra-expanded": true, "ultra-expanded": true,
+}
+
+// expandFont expands the font shorthand: optional style, variant, weight and stretch in any
+// order, then a required size with an optional line-height after a /, then the family list
+func expandFont(value models.Value) ([]models.Value, error) {
+	groups := []models.Value{value}
+	if value.ValueType == models.ListValue && value.Separator == models.CommaSeparated {
+		groups = value.Values
+	}
+
+	items, err := flattenSlash(groups[0])
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]models.Value, 0, len(fontLonghands))
+	for _, name := range fontLonghands {
+		values = append(values, initialValue(name))
+	}
+
+	// normal can stand for any of the properties before the size
+	set := make(map[int]bool)
+	normals := 0
+	i := 0
+	for ; i < len(items) && !isFontSize(items[i]); i++ {
+		item := items[i]
+		if len(set)+normals == 4 {
+			return nil, errors.New("too many values before the font size")
+		}
+
+		property := -1
+		switch {
+		case item.IsKeyword("normal"):
+			normals++
+			continue
+		case item.IsKeyword("italic"), item.IsKeyword("oblique"):
+			property = fontStyle
+		case item.IsKeyword("small-caps"):
+			property = fontVariant
+		case item.IsKeyword("bold"), item.IsKeyword("bolder"), item.IsKeyword("lighter"):
+			property = fontWeight
+		case item.ValueType == models.NumberValue && item.Number >= 1 && item.Number <= 1000:
+			property = fontWeight
+		case item.ValueType == models.KeywordValue && fontStretchKeywords[item.Keyword]:
+			property = fontStretch
+		}
+		if property < 0 || set[property] {
+			return nil, fmt.Errorf("unexpected %s", item)
+		}
+		set[property] = true
+		values[property] = item
+	}
+
+	if i == len(items) {
+		return nil, errors.New("missing font size")
+	}
+	values[fontSize] = items[i]
+	i++
+
+	if i < len(items) && isSlash(items[i]) {
+		if i+1 == len(items) {
+			return nil, errors.New("expected a line-height after /")
+		}
+		values[fontLineHeight] = items[i+1]
+		i += 2
+	}
+
+	families := make([]models.Value, 0, len(groups))
+	switch rest := items[i:]; len(rest) {
+	case 0:
+		return nil, errors.New("missing font family")
+	case 1:
+		families = append(families, rest[0])
+	default:
+		families = append(families, models.NewList(models.SpaceSeparated, rest))
+	}
+	for _, group := range groups[1:] {
+		if _, err := spaceSeparated(group); err != nil {
+			return nil, err
+		}
+		families = append(families, group)
+	}
+
+	values[fontFamily] = families[0]
+	if len(families) > 1 {
+		values[fontFamily] = models.NewList(models.CommaSeparated, families)
+	}
+	return values, nil
+}
+
+// isFontSize returns true for the values font-size accepts
+func isFontSize(value models.Value) bool {
+	if value.ValueType == models.KeywordValue {
+		return fontSizeKeywords[value.Keyword]
+	}
+	return isLengthPercentage(value)
+}
+
+// expandFlex expands the flex shorthand into a grow factor, a shrink factor and a basis.
+// The keywords none and auto are 0 0 auto and 1 1 auto. Factors left out are 1 and a basis
+// left out is 0%.
+func expandFlex(value models.Value) ([]models.Value, error) {
+	switch {
+	case value.IsKeyword("none"):
+		return []models.Value{models.NewNumber(0), models.NewNumber(0), models.NewKeyword("auto")}, nil
+	case value.IsKeyword("auto"):
+		return []models.Value{models.NewNumber(1), models.NewNumber(1), models.NewKeyword("auto")}, nil
+	}
+
+	items, err := spaceSeparated(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) > 3 {
+		return nil, fmt.Errorf("expected 1 to 3 values but found %d", len(items))
+	}
+
+	var grow, shrink, basis *models.Value
+	for i := range items {
+		item := &items[i]
+		switch {
+		// a zero after both factors is the basis
+		case item.ValueType == models.NumberValue && grow == nil:
+			grow = item
+		case item.ValueType == models.NumberValue && shrink == nil && i > 0 && items[i-1].ValueType == models.NumberValue:
+			shrink = item
+		case basis == nil && (isLengthPercentage(*item) || item.IsKeyword("auto") || item.IsKeyword("content")):
+			basis = item
+		default:
+			return nil, fmt.Errorf("unexpected %s", item)
+		}
+	}
+	if (grow != nil && grow.Number < 0) || (shrink != nil && shrink.Number < 0) {
+		return nil, errors.New("flex factors can't be negative")
+	}
+
+	values := []models.Value{models.NewNumber(1), models.NewNumber(1), models.NewPercentage(0)}
+	if grow != nil {
+		values[0] = *grow
+	}
+	if shrink != nil {
+		values[1] = *shrink
+	}
+	if basis != nil {
+		values[2] = *basis
+	}
+	return values, nil
+}
+
+// expandFlexFlow expands the flex-flow shorthand into a direction and a wrap mode, in either
+// order, leaving out whichever isn't given
+func expandFlexFlow(value models.Value) ([]models.Value, error) {
+	items, err := spaceSeparated(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) > 2 {
+		return nil, fmt.Errorf("expected 1 or 2 values but found %d", len(items))
+	}
+
+	values := []models.Value{initialValue("flex-direction"), initialValue("flex-wrap")}
+	var direction, wrap bool
+	for _, item := range items {
+		switch {
+		case !direction && (item.IsKeyword("row") || item.IsKeyword("row-reverse") ||
+			item.IsKeyword("column") || item.IsKeyword("column-reverse")):
+			values[0], direction = item, true
+		case !wrap && (item.IsKeyword("nowrap") || item.IsKeyword("wrap") || item.IsKeyword("wrap-reverse")):
+			values[1], wrap = item, true
+		default:
+			return nil, fmt.Errorf("unexpected %s", item)
+		}
+	}
+	return values, nil
+}
+
+// expandGap expands the gap shorthand into a row gap and a column gap. A single value is
+// used for both.
+func expandGap(value models.Value) ([]models.Value, error) {
+	items, err := spaceSeparated(value)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		if !isLengthPercentage(item) && !item.IsKeyword("normal") {
+			return nil, fmt.Errorf("unexpected %s", item)
+		}
+	}
+
+	switch len(items) {
+	case 1:
+		return []models.Value{items[0], items[0]}, nil
+	case 2:
+		return items, nil
+	}
+	return nil, fmt.Errorf("expected 1 or 2 values but found %d", len(items))
+}
@@ -39,58 +39,102 @@ func (a BySpecificity) Swap(i, j int) {
 	a[i], a[j] = a[j], a[i]
 }
 
-// ByMatchedRuleSpecificityAscending sorts a slice of rules with the LOWEST specificity first
-type ByMatchedRuleSpecificityAscending []models.MatchedRule
+// ByCascadeOrder sorts a slice of rules with the LOWEST precedence first: by origin, then
+// inline styles over selectors, then specificity, then source order
+type ByCascadeOrder []models.MatchedRule
 
-func (a ByMatchedRuleSpecificityAscending) Len() int {
+func (a ByCascadeOrder) Len() int {
 	return len(a)
 }
 
-func (a ByMatchedRuleSpecificityAscending) Less(i, j int) bool {
-	specI := a[i].Specificity
-	specJ := a[j].Specificity
-
-	if specI.IDSpecificity < specJ.IDSpecificity {
-		return true
-	} else if specI.IDSpecificity > specJ.IDSpecificity {
-		return false
+func (a ByCascadeOrder) Less(i, j int) bool {
+	if a[i].Origin != a[j].Origin {
+		return a[i].Origin < a[j].Origin
 	}
 
-	if specI.ClassSpecificity < specJ.ClassSpecificity {
-		return true
-	} else if specI.ClassSpecificity > specJ.ClassSpecificity {
-		return false
+	if a[i].Inline != a[j].Inline {
+		return a[j].Inline
 	}
 
-	if specI.ElementSpecificity < specJ.ElementSpecificity {
-		return true
-	} else if specI.ElementSpecificity > specJ.ElementSpecificity {
-		return false
+	if specificity := CompareSpecificity(a[i].Specificity, a[j].Specificity); specificity != 0 {
+		return specificity < 0
 	}
 
-	// must be sorted by source order
-	return false
+	return a[i].Order < a[j].Order
 }
 
-func (a ByMatchedRuleSpecificityAscending) Swap(i, j int) {
+func (a ByCascadeOrder) Swap(i, j int) {
 	a[i], a[j] = a[j], a[i]
 }
 
-// CalculateSpecificity returns the Specificity block for a given selector
+// CalculateSpecificity returns the Specificity block for a given selector, summed across its compound selectors
 func CalculateSpecificity(s models.Selector) models.Specificity {
+	specificity := models.Specificity{}
+
+	for _, part := range s.Parts {
+		compound := CalculateCompoundSpecificity(part.Compound)
+		specificity.IDSpecificity += compound.IDSpecificity
+		specificity.ClassSpecificity += compound.ClassSpecificity
+		specificity.ElementSpecificity += compound.ElementSpecificity
+	}
+
+	return specificity
+}
+
+// MostSpecific returns the highest Specificity among a list of selectors
+func MostSpecific(selectors []models.Selector) models.Specificity {
+	most := models.Specificity{}
+	for _, selector := range selectors {
+		specificity := CalculateSpecificity(selector)
+		if CompareSpecificity(specificity, most) > 0 {
+			most = specificity
+		}
+	}
+	return most
+}
+
+// CompareSpecificity returns a positive number if a is more specific than b, a negative number
+// if it is less specific, and 0 if they are equal
+func CompareSpecificity(a, b models.Specificity) int {
+	if a.IDSpecificity != b.IDSpecificity {
+		return a.IDSpecificity - b.IDSpecificity
+	}
+	if a.ClassSpecificity != b.ClassSpecificity {
+		return a.ClassSpecificity - b.ClassSpecificity
+	}
+	return a.ElementSpecificity - b.ElementSpecificity
+}
+
+// CalculateCompoundSpecificity returns the Specificity block for a single compound selector
+func CalculateCompoundSpecificity(c models.CompoundSelector) models.Specificity {
 	idSpecificity := 0
 	classSpecificity := 0
 	elementSpecificity := 0
 
-	if s.ID != nil {
+	if c.ID != nil {
 		idSpecificity = 1
 	}
 
-	if s.Classes != nil {
-		classSpecificity = len(*s.Classes)
+	if c.Classes != nil {
+		classSpecificity = len(*c.Classes)
+	}
+	classSpecificity += len(c.Attributes)
+
+	for _, pseudoClass := range c.PseudoClasses {
+		switch pseudoClass.Name {
+		case "where":
+			// :where() never adds specificity
+		case "not", "is", "has":
+			argument := MostSpecific(pseudoClass.Selectors)
+			idSpecificity += argument.IDSpecificity
+			classSpecificity += argument.ClassSpecificity
+			elementSpecificity += argument.ElementSpecificity
+		default:
+			classSpecificity++
+		}
 	}
 
-	if s.TagName != nil {
+	if c.TagName != nil {
 		elementSpecificity = 1
 	}
 
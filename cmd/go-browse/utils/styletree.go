@@ -8,8 +8,82 @@ import (
 	"github.com/bern/go-browse/cmd/go-browse/models"
 )
 
-// Matches returns true if a given ElementData matches a Selector
-func Matches(element models.ElementData, selector models.Selector) bool {
+// Matches returns true if the node a NodeRef points at matches a Selector. The selector is
+// matched right to left: the subject against the node, then each combinator against its
+// ancestors or preceding siblings.
+func Matches(node *models.NodeRef, selector models.Selector) bool {
+	if len(selector.Parts) == 0 {
+		return false
+	}
+	return matchesParts(node, selector.Parts, nil)
+}
+
+// matchesParts checks the last of a selector's parts against a node and the rest against its
+// relatives. For the relative selectors of :has() the first part must also be related to anchor.
+func matchesParts(node *models.NodeRef, parts []models.SelectorPart, anchor *models.NodeRef) bool {
+	last := parts[len(parts)-1]
+	if node.Node.NodeType != models.Element || !MatchesCompound(node, last.Compound) {
+		return false
+	}
+
+	rest := parts[:len(parts)-1]
+	if len(rest) == 0 {
+		return anchor == nil || isRelated(node, last.Combinator, anchor)
+	}
+
+	switch last.Combinator {
+	case models.Descendant:
+		for ancestor := node.ParentElement(); ancestor != nil; ancestor = ancestor.ParentElement() {
+			if matchesParts(ancestor, rest, anchor) {
+				return true
+			}
+		}
+	case models.Child:
+		parent := node.ParentElement()
+		return parent != nil && matchesParts(parent, rest, anchor)
+	case models.NextSibling:
+		sibling := node.PreviousElementSibling()
+		return sibling != nil && matchesParts(sibling, rest, anchor)
+	case models.SubsequentSibling:
+		for sibling := node.PreviousElementSibling(); sibling != nil; sibling = sibling.PreviousElementSibling() {
+			if matchesParts(sibling, rest, anchor) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// isRelated returns true if a node relates to another node through a combinator
+func isRelated(node *models.NodeRef, combinator models.Combinator, other *models.NodeRef) bool {
+	switch combinator {
+	case models.Descendant:
+		for ancestor := node.ParentElement(); ancestor != nil; ancestor = ancestor.ParentElement() {
+			if ancestor.Node == other.Node {
+				return true
+			}
+		}
+	case models.Child:
+		parent := node.ParentElement()
+		return parent != nil && parent.Node == other.Node
+	case models.NextSibling:
+		sibling := node.PreviousElementSibling()
+		return sibling != nil && sibling.Node == other.Node
+	case models.SubsequentSibling:
+		for sibling := node.PreviousElementSibling(); sibling != nil; sibling = sibling.PreviousElementSibling() {
+			if sibling.Node == other.Node {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MatchesCompound returns true if a node's element matches every simple selector in a CompoundSelector
+func MatchesCompound(node *models.NodeRef, selector models.CompoundSelector) bool {
+	element := *node.Node.Element
+
 	if selector.TagName != nil {
 		if element.TagName != *selector.TagName {
 			return false
@@ -17,7 +91,7 @@ func Matches(element models.ElementData, selector models.Selector) bool {
 	}
 
 	if selector.ID != nil {
-		if element.ID() == nil || element.ID() != selector.ID {
+		if element.ID() == nil || *element.ID() != *selector.ID {
 			return false
 		}
 	}
@@ -41,13 +115,66 @@ func Matches(element models.ElementData, selector models.Selector) bool {
 		}
 	}
 
+	for _, attribute := range selector.Attributes {
+		if !MatchesAttribute(element, attribute) {
+			return false
+		}
+	}
+
+	for _, pseudoClass := range selector.PseudoClasses {
+		if !MatchesPseudoClass(node, pseudoClass) {
+			return false
+		}
+	}
+
 	return true
 }
 
-// MatchRule determines the highest specificity selector through which a rule applies to an element
-func MatchRule(element models.ElementData, rule models.Rule) *models.MatchedRule {
+// MatchesAttribute returns true if an element has an attribute matching an AttributeSelector
+func MatchesAttribute(element models.ElementData, selector models.AttributeSelector) bool {
+	actual, ok := element.Attributes[selector.Name]
+	if !ok {
+		return false
+	}
+
+	expected := selector.Value
+	if selector.CaseInsensitive {
+		actual = strings.ToLower(actual)
+		expected = strings.ToLower(expected)
+	}
+
+	switch selector.Matcher {
+	case models.AttributeExists:
+		return true
+	case models.AttributeEquals:
+		return actual == expected
+	case models.AttributeIncludes:
+		if expected == "" || strings.ContainsAny(expected, " \t\n\f\r") {
+			return false
+		}
+		for _, word := range strings.Fields(actual) {
+			if word == expected {
+				return true
+			}
+		}
+		return false
+	case models.AttributeDashMatch:
+		return actual == expected || strings.HasPrefix(actual, expected+"-")
+	case models.AttributePrefix:
+		return expected != "" && strings.HasPrefix(actual, expected)
+	case models.AttributeSuffix:
+		return expected != "" && strings.HasSuffix(actual, expected)
+	case models.AttributeSubstring:
+		return expected != "" && strings.Contains(actual, expected)
+	}
+
+	return false
+}
+
+// MatchRule determines the highest specificity selector through which a rule applies to a node
+func MatchRule(node *models.NodeRef, rule models.Rule) *models.MatchedRule {
 	for _, selector := range rule.Selectors {
-		if Matches(element, selector) {
+		if Matches(node, selector) {
 			return &models.MatchedRule{
 				Rule:        rule,
 				Specificity: CalculateSpecificity(selector),
@@ -57,55 +184,209 @@ func MatchRule(element models.ElementData, rule models.Rule) *models.MatchedRule
 	return nil
 }
 
-// MatchingRules determines all rules in a stylesheet that apply to an element
-func MatchingRules(element models.ElementData, stylesheet models.Stylesheet) []models.MatchedRule {
+// MatchingRules determines all rules in a set of stylesheets that apply to a node
+func MatchingRules(node *models.NodeRef, stylesheets ...models.Stylesheet) []models.MatchedRule {
 	matchingRules := make([]models.MatchedRule, 0)
 
-	for _, rule := range stylesheet.Rules {
-		matchedRule := MatchRule(element, rule)
+	order := 0
+	for _, stylesheet := range stylesheets {
+		for _, rule := range stylesheet.Rules {
+			matchedRule := MatchRule(node, rule)
 
-		if matchedRule != nil {
-			matchingRules = append(matchingRules, *matchedRule)
+			if matchedRule != nil {
+				matchedRule.Origin = stylesheet.Origin
+				matchedRule.Order = order
+				matchingRules = append(matchingRules, *matchedRule)
+			}
+			order++
 		}
 	}
 
 	return matchingRules
 }
 
-// SpecifiedValues sorts a set of rules that apply to an element by specificity and map them to property values
-func SpecifiedValues(element models.ElementData, stylesheet models.Stylesheet) models.PropertyMap {
-	rules := MatchingRules(element, stylesheet)
-	values := make(map[string]string)
+// SpecifiedValues cascades the rules that apply to a node and maps them to property values.
+// Normal declarations are applied by origin, specificity and source order, then !important
+// declarations are applied on top with the origins reversed.
+func SpecifiedValues(node *models.NodeRef, stylesheets ...models.Stylesheet) models.PropertyMap {
+	rules := MatchingRules(node, stylesheets...)
+	if inlineStyle := InlineStyle(node); inlineStyle != nil {
+		rules = append(rules, *inlineStyle)
+	}
+	values := make(models.PropertyMap)
+
+	sort.Stable(ByCascadeOrder(rules))
+
+	// revert rolls a property back to what the lower origins gave it
+	reverted := make(map[models.Origin]models.PropertyMap)
+
+	for origin := models.UserAgentOrigin; origin <= models.AuthorOrigin; origin++ {
+		reverted[origin] = copyPropertyMap(values)
+		for _, rule := range rules {
+			if rule.Origin == origin {
+				applyDeclarations(values, rule.Rule.Declarations, false, reverted[origin])
+			}
+		}
+	}
 
-	sort.Sort(ByMatchedRuleSpecificityAscending(rules))
-	for _, rule := range rules {
-		for _, declaration := range rule.Rule.Declarations {
-			values[declaration.Name] = declaration.Value
+	for origin := models.AuthorOrigin; origin >= models.UserAgentOrigin; origin-- {
+		for _, rule := range rules {
+			if rule.Origin == origin {
+				applyDeclarations(values, rule.Rule.Declarations, true, reverted[origin])
+			}
 		}
 	}
 
 	return values
 }
 
-// StyleTree takes a root node of the DOM and recursively applies a stylesheet to it
-func StyleTree(root models.Node, stylesheet models.Stylesheet) models.StyledNode {
-	specifiedValues := make(map[string]string, 0)
-	if root.NodeType == models.Element && root.Element != nil {
-		specifiedValues = SpecifiedValues(*root.Element, stylesheet)
+// InlineStyle returns the declarations of a node's style attribute as an author-level rule
+// that wins over any selector, or nil if the node has no style attribute. Invalid
+// declarations are dropped.
+func InlineStyle(node *models.NodeRef) *models.MatchedRule {
+	if node.Node.Element == nil {
+		return nil
+	}
+
+	style, ok := node.Node.Element.Attributes["style"]
+	if !ok {
+		return nil
+	}
+
+	declarations, _ := ParseStyleAttribute(style)
+	return &models.MatchedRule{
+		Rule:   models.Rule{Declarations: declarations},
+		Origin: models.AuthorOrigin,
+		Inline: true,
+	}
+}
+
+// applyDeclarations sets the normal or !important declarations of a rule on a property map.
+// Shorthands are expanded so the map only ever holds longhands.
+func applyDeclarations(values models.PropertyMap, declarations []models.Declaration, important bool, reverted models.PropertyMap) {
+	for _, declaration := range declarations {
+		if declaration.Important != important {
+			continue
+		}
+
+		longhands, err := ExpandShorthand(declaration)
+		if err != nil {
+			continue
+		}
+
+		for _, longhand := range longhands {
+			if !longhand.Value.IsKeyword("revert") {
+				values[longhand.Name] = longhand.Value
+			} else if value, ok := reverted[longhand.Name]; ok {
+				values[longhand.Name] = value
+			} else {
+				delete(values, longhand.Name)
+			}
+		}
+	}
+}
+
+func copyPropertyMap(values models.PropertyMap) models.PropertyMap {
+	copied := make(models.PropertyMap, len(values))
+	for name, value := range values {
+		copied[name] = value
+	}
+	return copied
+}
+
+// StyleTree takes a root node of the DOM and recursively applies a set of stylesheets to it,
+// beneath the built-in user agent stylesheet
+func StyleTree(root models.Node, stylesheets ...models.Stylesheet) models.StyledNode {
+	stylesheets = append([]models.Stylesheet{UserAgentStylesheet()}, stylesheets...)
+	return styleTree(&models.NodeRef{Node: &root}, stylesheets, nil, 0)
+}
+
+// styleTree styles a node and its descendants, inheriting from the parent's values. Lengths
+// are computed relative to the node's font and the root's font size, which is zero until the
+// root has been styled.
+func styleTree(node *models.NodeRef, stylesheets []models.Stylesheet, parent models.PropertyMap, rootFontSize float64) models.StyledNode {
+	specifiedValues := make(models.PropertyMap)
+	isElement := node.Node.NodeType == models.Element && node.Node.Element != nil
+	if isElement {
+		specifiedValues = SpecifiedValues(node, stylesheets...)
+	}
+	values := InheritValues(specifiedValues, parent)
+
+	// text inherits values that are already computed
+	if isElement {
+		models.ComputeValues(values, parent, rootFontSize)
+		if rootFontSize == 0 {
+			rootFontSize = models.FontSize(values)
+		}
 	}
 
 	children := make([]models.StyledNode, 0)
-	for _, child := range root.Children {
-		children = append(children, StyleTree(child, stylesheet))
+	for i := range node.Node.Children {
+		children = append(children, styleTree(node.Child(i), stylesheets, values, rootFontSize))
 	}
 
 	return models.StyledNode{
-		Node:            root,
-		SpecifiedValues: specifiedValues,
+		Node:            *node.Node,
+		SpecifiedValues: values,
 		Children:        children,
 	}
 }
 
+// InheritValues resolves the inherit, initial and unset keywords in a node's
+// cascaded values, then fills in any inherited properties it doesn't set from its
+// parent's values. The root node has a nil parent.
+func InheritValues(cascaded, parent models.PropertyMap) models.PropertyMap {
+	values := make(models.PropertyMap, len(cascaded))
+
+	for name, value := range cascaded {
+		keyword := ""
+		if value.ValueType == models.KeywordValue {
+			keyword = value.Keyword
+		}
+
+		// color: currentcolor means the parent's color
+		if name == "color" && keyword == "currentcolor" {
+			keyword = "inherit"
+		}
+
+		if keyword == "unset" {
+			keyword = "initial"
+			if models.IsInherited(name) {
+				keyword = "inherit"
+			}
+		}
+
+		switch keyword {
+		case "inherit":
+			if inherited, ok := parent[name]; ok {
+				values[name] = inherited
+			} else if initial, ok := models.InitialValue(name); ok {
+				values[name] = initial
+			}
+		case "initial":
+			if initial, ok := models.InitialValue(name); ok {
+				values[name] = initial
+			}
+		default:
+			values[name] = value
+		}
+	}
+
+	for name, property := range models.Properties {
+		if !property.Inherited {
+			continue
+		}
+		if _, ok := values[name]; ok {
+			continue
+		}
+		if inherited, ok := parent[name]; ok {
+			values[name] = inherited
+		}
+	}
+
+	return values
+}
+
 // PrintStyledNode recurses down a StyledNode, printing all elements and their associated styles
 func PrintStyledNode(root models.StyledNode, level int) {
 	printedValue := ""
@@ -117,7 +398,7 @@ func PrintStyledNode(root models.StyledNode, level int) {
 	nodeType := root.Node.NodeType
 	switch nodeType {
 	case models.Text:
-		printedValue += fmt.Sprintf("TextNode(\"%s\")", *root.Node.Text)
+		printedValue += fmt.Sprintf("TextNode(%q)", *root.Node.Text)
 		break
 	case models.Element:
 		printedValue += fmt.Sprintf("ElementNode(\"%s\"", root.Node.Element.TagName)
@@ -133,7 +414,7 @@ func PrintStyledNode(root models.StyledNode, level int) {
 	printedValue += " ("
 
 	for name, value := range root.SpecifiedValues {
-		printedValue += name + ":" + value + " "
+		printedValue += name + ":" + value.String() + " "
 	}
 
 	printedValue = strings.TrimRight(printedValue, " ")
@@ -3,7 +3,6 @@ package utils
 import (
 	"fmt"
 	"strconv"
-	"strings"
 
 	"github.com/bern/go-browse/cmd/go-browse/models"
 )
@@ -40,7 +39,7 @@ func PrintNode(root models.Node, level int) {
 	nodeType := root.NodeType
 	switch nodeType {
 	case models.Text:
-		printedValue += fmt.Sprintf("TextNode(\"%s\")", *root.Text)
+		printedValue += fmt.Sprintf("TextNode(%q)", *root.Text)
 		break
 	case models.Element:
 		printedValue += fmt.Sprintf("ElementNode(\"%s\"", root.Element.TagName)
@@ -60,11 +59,27 @@ func PrintNode(root models.Node, level int) {
 	}
 }
 
+// PrintParseErrors prints each of the recoverable errors returned by a parser
+func PrintParseErrors(err error) {
+	if list, ok := err.(ParseErrorList); ok {
+		for _, parseError := range list {
+			fmt.Println("Warning:", parseError)
+		}
+		return
+	}
+	if err != nil {
+		fmt.Println("Warning:", err)
+	}
+}
+
 // PrintStylesheet will crawl down a stylesheet and print every rule
 func PrintStylesheet(sheet models.Stylesheet) {
 	for i, rule := range sheet.Rules {
 		PrintRule(rule, i)
 	}
+	for _, warning := range sheet.Warnings {
+		fmt.Println("Warning:", warning)
+	}
 }
 
 // PrintRule takes a rule and prints outs its selectors and declarations
@@ -72,26 +87,17 @@ func PrintRule(rule models.Rule, index int) {
 	fmt.Printf("**Rule #%s**\n", strconv.Itoa(index))
 	fmt.Println("Selectors")
 	for _, selector := range rule.Selectors {
-		if selector.TagName != nil {
-			fmt.Println("Type:", *selector.TagName)
-		} else {
-			fmt.Println("Type: universal")
-		}
-
-		if selector.ID != nil {
-			fmt.Println("ID:", *selector.ID)
-		}
-
-		if selector.Classes != nil {
-			fmt.Println("Classes:", strings.Join(*selector.Classes, ", "))
-		}
-
-		fmt.Println()
+		fmt.Println(selector)
 	}
+	fmt.Println()
 	fmt.Println("Declarations")
 	for _, declaration := range rule.Declarations {
 		fmt.Println("Name:", declaration.Name)
-		fmt.Println("Value:", declaration.Value)
+		if declaration.Important {
+			fmt.Println("Value:", declaration.Value, "!important")
+		} else {
+			fmt.Println("Value:", declaration.Value)
+		}
 		fmt.Println()
 	}
 }
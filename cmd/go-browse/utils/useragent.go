@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"github.com/bern/go-browse/cmd/go-browse/models"
+)
+
+// userAgentCSS is the browser's own stylesheet, loosely following the rendering section of
+// the HTML standard.
+const userAgentCSS = `
+/* hidden elements */
+[hidden], area, base, basefont, datalist, head, link, meta, noembed, noframes,
+param, rp, script, style, template, title {
+  display: none;
+}
+
+/* block-level elements */
+html, body, address, blockquote, center, dialog, div, figure, figcaption, footer,
+form, header, hr, legend, listing, main, p, plaintext, pre, search, xmp,
+article, aside, h1, h2, h3, h4, h5, h6, hgroup, nav, section,
+dir, dd, dl, dt, menu, ol, ul, details, summary, fieldset, optgroup {
+  display: block;
+}
+
+li {
+  display: list-item;
+}
+
+table {
+  display: table;
+}
+
+caption {
+  display: table-caption;
+}
+
+colgroup {
+  display: table-column-group;
+}
+
+col {
+  display: table-column;
+}
+
+thead {
+  display: table-header-group;
+}
+
+tbody {
+  display: table-row-group;
+}
+
+tfoot {
+  display: table-footer-group;
+}
+
+tr {
+  display: table-row;
+}
+
+td, th {
+  display: table-cell;
+}
+
+/* margins */
+body {
+  margin: 8px;
+}
+
+blockquote, figure, listing, p, plaintext, pre, xmp, dl, dir, menu, ol, ul {
+  margin-top: 1em;
+  margin-bottom: 1em;
+}
+
+blockquote, figure {
+  margin-left: 40px;
+  margin-right: 40px;
+}
+
+dd {
+  margin-left: 40px;
+}
+
+dir, menu, ol, ul {
+  padding-left: 40px;
+}
+
+:is(dir, dl, menu, ol, ul) :is(dir, dl, menu, ol, ul) {
+  margin-top: 0;
+  margin-bottom: 0;
+}
+
+ol {
+  list-style-type: decimal;
+}
+
+/* headings */
+h1 {
+  font-size: 2em;
+  margin-top: 0.67em;
+  margin-bottom: 0.67em;
+}
+
+h2 {
+  font-size: 1.5em;
+  margin-top: 0.83em;
+  margin-bottom: 0.83em;
+}
+
+h3 {
+  font-size: 1.17em;
+  margin-top: 1em;
+  margin-bottom: 1em;
+}
+
+h4 {
+  margin-top: 1.33em;
+  margin-bottom: 1.33em;
+}
+
+h5 {
+  font-size: 0.83em;
+  margin-top: 1.67em;
+  margin-bottom: 1.67em;
+}
+
+h6 {
+  font-size: 0.67em;
+  margin-top: 2.33em;
+  margin-bottom: 2.33em;
+}
+
+h1, h2, h3, h4, h5, h6, b, strong, th, dt {
+  font-weight: bold;
+}
+
+/* phrasing content */
+address, cite, dfn, em, i, var {
+  font-style: italic;
+}
+
+code, kbd, listing, plaintext, pre, samp, tt, xmp {
+  font-family: monospace;
+}
+
+big {
+  font-size: larger;
+}
+
+small, sub, sup {
+  font-size: smaller;
+}
+
+pre, listing, plaintext, xmp {
+  white-space: pre;
+}
+
+center, th {
+  text-align: center;
+}
+
+hr {
+  margin-top: 0.5em;
+  margin-bottom: 0.5em;
+  border: 1px inset;
+  color: gray;
+}
+
+a[href] {
+  color: #0000ee;
+}
+
+mark {
+  background-color: yellow;
+  color: black;
+}
+`
+
+// userAgentStylesheet is parsed once and shared by every StyleTree
+var userAgentStylesheet = parseUserAgentStylesheet()
+
+func parseUserAgentStylesheet() models.Stylesheet {
+	stylesheet := ParseCSS("user-agent.css", userAgentCSS)
+	stylesheet.Origin = models.UserAgentOrigin
+	return stylesheet
+}
+
+// UserAgentStylesheet returns the built-in stylesheet applied beneath every page's styles
+func UserAgentStylesheet() models.Stylesheet {
+	return userAgentStylesheet
+}
@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bern/go-browse/cmd/go-browse/models"
+)
+
+// ParseValue converts the raw text of a declaration's value into a typed Value
+func ParseValue(input string) (models.Value, error) {
+	return ParseComponentValues(trimWhitespace(parseComponentList(input)))
+}
+
+// parseComponentList tokenizes a string into a list of component values
+func parseComponentList(src string) []ComponentValue {
+	p := newCSSParser("", src)
+
+	values := make([]ComponentValue, 0)
+	for p.nextToken().TokenType != EOFToken {
+		values = append(values, p.consumeComponentValue())
+	}
+	return values
+}
+
+// ParseComponentValues converts the component values of a declaration into a typed Value.
+// Commas bind loosest, then slashes, then spaces, so "12px/1.5 serif, monospace" is a comma
+// list whose first item is a slash list.
+func ParseComponentValues(values []ComponentValue) (models.Value, error) {
+	groups := make([]models.Value, 0)
+
+	for _, group := range splitOnCommas(values) {
+		parts := make([]models.Value, 0)
+
+		for _, part := range splitOnSlashes(group) {
+			value, err := parseSpaceSeparated(part)
+			if err != nil {
+				return models.Value{}, err
+			}
+			parts = append(parts, value)
+		}
+
+		if len(parts) == 1 {
+			groups = append(groups, parts[0])
+		} else {
+			groups = append(groups, models.NewList(models.SlashSeparated, parts))
+		}
+	}
+
+	if len(groups) == 1 {
+		return groups[0], nil
+	}
+	return models.NewList(models.CommaSeparated, groups), nil
+}
+
+// parseSpaceSeparated parses a run of component values separated by whitespace
+func parseSpaceSeparated(values []ComponentValue) (models.Value, error) {
+	components := make([]models.Value, 0)
+
+	for _, value := range values {
+		if value.Is(WhitespaceToken) {
+			continue
+		}
+
+		component, err := parseComponentValue(value)
+		if err != nil {
+			return models.Value{}, err
+		}
+		components = append(components, component)
+	}
+
+	switch len(components) {
+	case 0:
+		return models.Value{}, errors.New("empty value")
+	case 1:
+		return components[0], nil
+	}
+	return models.NewList(models.SpaceSeparated, components), nil
+}
+
+// splitOnSlashes splits a list of component values on its top-level / delimiters
+func splitOnSlashes(values []ComponentValue) [][]ComponentValue {
+	parts := make([][]ComponentValue, 0)
+	part := make([]ComponentValue, 0)
+
+	for _, value := range values {
+		if value.IsDelim("/") {
+			parts = append(parts, part)
+			part = make([]ComponentValue, 0)
+			continue
+		}
+		part = append(part, value)
+	}
+
+	return append(parts, part)
+}
+
+// parseComponentValue parses a single keyword, number, string, color or function
+func parseComponentValue(value ComponentValue) (models.Value, error) {
+	token := value.Token
+
+	switch token.TokenType {
+	case IdentToken:
+		return models.NewKeyword(strings.ToLower(token.Value)), nil
+	case NumberToken:
+		return models.NewNumber(token.Number), nil
+	case PercentageToken:
+		return models.NewPercentage(token.Number), nil
+	case DimensionToken:
+		unit, ok := models.ParseUnit(token.Unit)
+		if !ok {
+			return models.Value{}, fmt.Errorf("unknown unit %s", token)
+		}
+		return models.NewLength(token.Number, unit), nil
+	case StringToken:
+		return models.NewString(token.Value), nil
+	case URLToken:
+		return models.NewURL(token.Value), nil
+	case HashToken:
+		color := parseHexColor(token.Value)
+		if color == nil {
+			return models.Value{}, fmt.Errorf("invalid hex color %s", token)
+		}
+		return models.NewColor(*color), nil
+	case FunctionToken:
+		return parseFunctionValue(value)
+	case OpenSquareToken:
+		return parseLineNames(value)
+	}
+
+	return models.Value{}, fmt.Errorf("unexpected %s", value)
+}
+
+// parseFunctionValue evaluates a function appearing in a declaration's value
+func parseFunctionValue(function ComponentValue) (models.Value, error) {
+	name := strings.ToLower(function.Token.Value)
+
+	if isColorFunction(name) {
+		color, err := parseColorFunction(name, function.Children)
+		if err != nil {
+			return models.Value{}, err
+		}
+		return models.NewColor(*color), nil
+	}
+
+	if isMathFunction(name) {
+		return parseMathFunction(name, function.Children)
+	}
+
+	if isGridFunction(name) {
+		return parseGridFunction(name, function.Children)
+	}
+
+	// url() with a quoted argument is a function rather than a url token
+	if name == "url" {
+		args := trimWhitespace(function.Children)
+		if len(args) != 1 || !args[0].Is(StringToken) {
+			return models.Value{}, errors.New("invalid url()")
+		}
+		return models.NewURL(args[0].Token.Value), nil
+	}
+
+	return models.Value{}, fmt.Errorf("unsupported function %s)", function.Token)
+}